@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/accrualfake"
+)
+
+type config struct {
+	RunAddress      string        `env:"RUN_ADDRESS" envDefault:"localhost:8080"`
+	RegisteredDelay time.Duration `env:"REGISTERED_DELAY" envDefault:"1s"`
+	ProcessingDelay time.Duration `env:"PROCESSING_DELAY" envDefault:"2s"`
+	RateLimit       int           `env:"RATE_LIMIT" envDefault:"0"`
+	RetryAfter      time.Duration `env:"RETRY_AFTER" envDefault:"60s"`
+}
+
+func main() {
+	var cfg config
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	flag.StringVar(&cfg.RunAddress, "a",
+		cfg.RunAddress, "Address and port to start the service")
+	flag.DurationVar(&cfg.RegisteredDelay, "registered-delay",
+		cfg.RegisteredDelay, "Time an order stays REGISTERED")
+	flag.DurationVar(&cfg.ProcessingDelay, "processing-delay",
+		cfg.ProcessingDelay, "Time an order stays PROCESSING")
+	flag.IntVar(&cfg.RateLimit, "rate-limit",
+		cfg.RateLimit, "Maximum order status requests per minute, 0 for unlimited")
+	flag.DurationVar(&cfg.RetryAfter, "retry-after",
+		cfg.RetryAfter, "Retry-After value for rate limited responses")
+	flag.Parse()
+
+	srv := accrualfake.NewServer(accrualfake.Config{
+		RegisteredDelay: cfg.RegisteredDelay,
+		ProcessingDelay: cfg.ProcessingDelay,
+		RateLimit:       cfg.RateLimit,
+		RetryAfter:      cfg.RetryAfter,
+	})
+	log.Fatal(http.ListenAndServe(cfg.RunAddress, srv))
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"github.com/lipandr/yandex-practicum-diploma/internal/types"
 	"log"
 
 	"github.com/caarlos0/env/v6"
@@ -10,20 +9,52 @@ import (
 	"github.com/lipandr/yandex-practicum-diploma/internal/client"
 	"github.com/lipandr/yandex-practicum-diploma/internal/config"
 	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/events"
+	"github.com/lipandr/yandex-practicum-diploma/internal/ledger"
+	"github.com/lipandr/yandex-practicum-diploma/internal/outbox"
 	"github.com/lipandr/yandex-practicum-diploma/internal/service"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+	"github.com/lipandr/yandex-practicum-diploma/internal/webhook"
 )
 
 func main() {
+	var createAdmin string
 	var cfg config.Config
 	if err := env.Parse(&cfg); err != nil {
 		log.Fatal(err)
 	}
 	flag.StringVar(&cfg.RunAddress, "a",
 		cfg.RunAddress, "Address and port to start the service")
+	flag.StringVar(&cfg.MetricsAddress, "m",
+		cfg.MetricsAddress, "Internal address for metrics, empty to disable")
 	flag.StringVar(&cfg.DatabaseURI, "d",
 		cfg.DatabaseURI, "Database connection address")
 	flag.StringVar(&cfg.AccrualSystemAddress, "r",
 		cfg.AccrualSystemAddress, "Address of the accrual system")
+	flag.StringVar(&cfg.AccrualProviders, "p",
+		cfg.AccrualProviders, "Path to the accrual providers configuration file")
+	flag.IntVar(&cfg.AccrualWorkers, "accrual-workers",
+		cfg.AccrualWorkers, "Minimum number of accrual workers")
+	flag.IntVar(&cfg.AccrualMaxWorkers, "accrual-max-workers",
+		cfg.AccrualMaxWorkers, "Maximum number of accrual workers")
+	flag.IntVar(&cfg.AccrualBatchSize, "accrual-batch-size",
+		cfg.AccrualBatchSize, "Number of orders fetched for processing at once")
+	flag.DurationVar(&cfg.AccrualPollInterval, "accrual-poll-interval",
+		cfg.AccrualPollInterval, "Pause between polls when there are no orders to process")
+	flag.DurationVar(&cfg.AccrualCallbackDeadline, "accrual-callback-deadline",
+		cfg.AccrualCallbackDeadline, "Time to wait for an accrual callback before polling the order")
+	flag.DurationVar(&cfg.AccrualCallbackMaxAge, "accrual-callback-max-age",
+		cfg.AccrualCallbackMaxAge, "Maximum age of a signed accrual callback")
+	flag.BoolVar(&cfg.AccrualRegisterOrders, "accrual-register-orders",
+		cfg.AccrualRegisterOrders, "Register uploaded orders with the accrual system")
+	flag.IntVar(&cfg.OrdersBatchLimit, "b",
+		cfg.OrdersBatchLimit, "Maximum number of orders in a batch upload")
+	flag.StringVar(&cfg.RateLimitStore, "rate-limit-store",
+		cfg.RateLimitStore, "Rate limit buckets store: memory or postgres")
+	flag.StringVar(&cfg.EventsSink, "e",
+		cfg.EventsSink, "Domain events sink: stdout, file:<path> or nats://host:port")
+	flag.StringVar(&createAdmin, "create-admin",
+		"", "Create an administrator with this login and the ADMIN_PASSWORD password, then exit")
 	flag.Parse()
 
 	db, err := dao.NewDAO(cfg.DatabaseURI)
@@ -31,14 +62,66 @@ func main() {
 		log.Fatal("Can't start application:", err)
 	}
 
-	cl := client.NewAccrualProcessor(db, cfg.AccrualSystemAddress, types.WorkersPoolSize)
+	hub, err := events.NewHub(db)
+	if err != nil {
+		log.Fatal("Can't start application:", err)
+	}
+
+	svc, err := service.NewService(cfg, db, hub)
+	if err != nil {
+		log.Fatal("Can't start application:", err)
+	}
+	if createAdmin != "" {
+		if err = svc.CreateAdmin(&types.UserRequest{Login: createAdmin, Password: cfg.AdminPassword}); err != nil {
+			log.Fatal("Can't create administrator:", err)
+		}
+		log.Printf("Administrator %q created", createAdmin)
+		return
+	}
+
+	httpOpts := client.NewHTTPOptions(cfg)
+	source := client.NewHTTPSource("default", cfg.AccrualSystemAddress, httpOpts)
+	if cfg.AccrualProviders != "" {
+		if source, err = client.LoadAccrualSources(cfg.AccrualProviders, httpOpts); err != nil {
+			log.Fatal("Can't start application:", err)
+		}
+	}
+	cl := client.NewAccrualProcessor(db, hub, source, client.NewPoolOptions(cfg))
 	cl.Run()
+	if cfg.AccrualRegisterOrders {
+		client.NewRegistrar(db, source, cfg.AccrualRegisterAttempts, cfg.AccrualRegisterBackoff).Run()
+	}
+
+	ledger.NewScheduler(db, ledger.NewOptions(cfg)).Run()
+
+	wd := webhook.NewDispatcher(db, webhook.NewClient(cfg.WebhookTimeout),
+		cfg.WebhookMaxAttempts, cfg.WebhookBackoff)
+	wd.Run()
+
+	pub, err := outbox.NewPublisher(cfg.EventsSink, cfg.EventsSubject)
+	if err != nil {
+		log.Fatal("Can't start application:", err)
+	}
+	outbox.NewRelay(db, pub).Run()
 
-	svc, err := service.NewService(db)
+	urlApp, err := app.NewApp(cfg, svc)
 	if err != nil {
 		log.Fatal("Can't start application:", err)
 	}
-	urlApp := app.NewApp(cfg, svc)
+	switch cfg.RateLimitStore {
+	case "memory":
+	case "postgres":
+		urlApp.SetRateLimitStore(db)
+	default:
+		log.Fatalf("Can't start application: unknown rate limit store %q", cfg.RateLimitStore)
+	}
+	urlApp.AddReadinessCheck("accrual", cl.Ready)
+	urlApp.SetAccrualCallback(cl.Push)
+	if cfg.MetricsAddress != "" {
+		go func() {
+			log.Println("metrics:", urlApp.RunMetrics())
+		}()
+	}
 
 	log.Fatal(urlApp.Run())
 }
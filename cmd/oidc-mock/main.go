@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/oidcmock"
+)
+
+type config struct {
+	RunAddress   string        `env:"RUN_ADDRESS" envDefault:"localhost:8090"`
+	Issuer       string        `env:"OIDC_ISSUER" envDefault:"http://localhost:8090"`
+	ClientID     string        `env:"OIDC_CLIENT_ID" envDefault:"gophermart"`
+	ClientSecret string        `env:"OIDC_CLIENT_SECRET" envDefault:"secret"`
+	TokenTTL     time.Duration `env:"TOKEN_TTL" envDefault:"1h"`
+}
+
+func main() {
+	var cfg config
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	flag.StringVar(&cfg.RunAddress, "a",
+		cfg.RunAddress, "Address and port to start the service")
+	flag.StringVar(&cfg.Issuer, "issuer",
+		cfg.Issuer, "Issuer URL clients use to reach the provider")
+	flag.StringVar(&cfg.ClientID, "client-id",
+		cfg.ClientID, "Registered client identifier")
+	flag.StringVar(&cfg.ClientSecret, "client-secret",
+		cfg.ClientSecret, "Registered client secret")
+	flag.DurationVar(&cfg.TokenTTL, "token-ttl",
+		cfg.TokenTTL, "Lifetime of issued ID tokens")
+	flag.Parse()
+
+	srv, err := oidcmock.NewServer(oidcmock.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		TokenTTL:     cfg.TokenTTL,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(http.ListenAndServe(cfg.RunAddress, srv))
+}
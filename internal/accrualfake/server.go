@@ -0,0 +1,309 @@
+// Package accrualfake реализует имитацию системы расчета начислений баллов лояльности
+// для локальной разработки и интеграционных тестов.
+package accrualfake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/joeljunstrom/go-luhn"
+)
+
+// Статусы расчета начислений.
+const (
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Типы вознаграждения.
+const (
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+const tooManyRequestTemplate = "No more than %d requests per minute allowed"
+
+var (
+	ErrOrderExists  = errors.New("order already registered")
+	ErrRewardExists = errors.New("reward already registered")
+	ErrInvalidOrder = errors.New("invalid order number")
+	ErrInvalidGoods = errors.New("invalid reward")
+)
+
+// Config настройки имитации системы начислений.
+type Config struct {
+	// RegisteredDelay время, в течение которого заказ находится в статусе REGISTERED.
+	RegisteredDelay time.Duration
+	// ProcessingDelay время, в течение которого заказ находится в статусе PROCESSING.
+	ProcessingDelay time.Duration
+	// RateLimit максимальное количество запросов GET /api/orders/{number} в минуту, 0 — без ограничений.
+	RateLimit int
+	// RetryAfter значение заголовка Retry-After в ответе 429.
+	RetryAfter time.Duration
+}
+
+// Reward механика вознаграждения за товары, в описании которых встречается Match.
+type Reward struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+// Good товар в составе заказа.
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// OrderRequest запрос регистрации заказа.
+type OrderRequest struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+// OrderState ответ о состоянии расчета начислений по заказу.
+type OrderState struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+type order struct {
+	registeredAt time.Time
+	goods        []Good
+	// fixed заданный вручную итоговый статус, минующий расчет
+	fixed *OrderState
+}
+
+// Server имитация системы расчета начислений, реализует http.Handler.
+type Server struct {
+	cfg    Config
+	router *mux.Router
+
+	mu          sync.Mutex
+	rewards     []Reward
+	orders      map[string]*order
+	throttle    int
+	windowStart time.Time
+	windowCount int
+
+	// Now источник текущего времени, может быть подменен в тестах.
+	Now func() time.Time
+}
+
+// NewServer метод-конструктор имитации системы начислений.
+func NewServer(cfg Config) *Server {
+	s := &Server{
+		cfg:    cfg,
+		orders: make(map[string]*order),
+		Now:    time.Now,
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/goods", s.handleRegisterReward).Methods(http.MethodPost)
+	r.HandleFunc("/api/orders", s.handleRegisterOrder).Methods(http.MethodPost)
+	r.HandleFunc("/api/orders/{number}", s.handleGetOrder).Methods(http.MethodGet)
+	s.router = r
+	return s
+}
+
+// ServeHTTP метод обработки HTTP-запросов к имитации.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// AddReward метод регистрации механики вознаграждения.
+func (s *Server) AddReward(rw Reward) error {
+	if rw.Match == "" || rw.Reward <= 0 || (rw.RewardType != RewardPercent && rw.RewardType != RewardPoints) {
+		return ErrInvalidGoods
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.rewards {
+		if existing.Match == rw.Match {
+			return ErrRewardExists
+		}
+	}
+	s.rewards = append(s.rewards, rw)
+	return nil
+}
+
+// RegisterOrder метод регистрации заказа для расчета начислений.
+func (s *Server) RegisterOrder(number string, goods []Good) error {
+	if number == "" || !luhn.Valid(number) {
+		return ErrInvalidOrder
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[number]; ok {
+		return ErrOrderExists
+	}
+	s.orders[number] = &order{
+		registeredAt: s.Now(),
+		goods:        goods,
+	}
+	return nil
+}
+
+// SetOrderState метод принудительной установки состояния заказа, минуя расчет.
+// Позволяет получить в тестах любой, в том числе INVALID, результат.
+func (s *Server) SetOrderState(number, status string, accrual float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &OrderState{Order: number, Status: status}
+	if status == StatusProcessed {
+		st.Accrual = &accrual
+	}
+	o, ok := s.orders[number]
+	if !ok {
+		o = &order{registeredAt: s.Now()}
+		s.orders[number] = o
+	}
+	o.fixed = st
+}
+
+// ThrottleNext метод, заставляющий следующие n запросов состояния заказа вернуть 429.
+func (s *Server) ThrottleNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.throttle = n
+}
+
+// OrderState метод получения текущего состояния заказа. Возвращает false для неизвестного заказа.
+func (s *Server) OrderState(number string) (*OrderState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		return nil, false
+	}
+	if o.fixed != nil {
+		st := *o.fixed
+		return &st, true
+	}
+	elapsed := s.Now().Sub(o.registeredAt)
+	switch {
+	case elapsed < s.cfg.RegisteredDelay:
+		return &OrderState{Order: number, Status: StatusRegistered}, true
+	case elapsed < s.cfg.RegisteredDelay+s.cfg.ProcessingDelay:
+		return &OrderState{Order: number, Status: StatusProcessing}, true
+	}
+	accrual, matched := s.calculate(o.goods)
+	if !matched {
+		return &OrderState{Order: number, Status: StatusInvalid}, true
+	}
+	return &OrderState{Order: number, Status: StatusProcessed, Accrual: &accrual}, true
+}
+
+// calculate метод расчета начисления по составу заказа, вызывается под блокировкой.
+func (s *Server) calculate(goods []Good) (float64, bool) {
+	var accrual float64
+	var matched bool
+	for _, g := range goods {
+		for _, rw := range s.rewards {
+			if !strings.Contains(g.Description, rw.Match) {
+				continue
+			}
+			matched = true
+			if rw.RewardType == RewardPercent {
+				accrual += g.Price * rw.Reward / 100
+			} else {
+				accrual += rw.Reward
+			}
+			break
+		}
+	}
+	return math.Round(accrual*100) / 100, matched
+}
+
+// allow метод проверки ограничения количества запросов.
+func (s *Server) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.throttle > 0 {
+		s.throttle--
+		return false
+	}
+	if s.cfg.RateLimit <= 0 {
+		return true
+	}
+	now := s.Now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+	return s.windowCount <= s.cfg.RateLimit
+}
+
+func (s *Server) handleRegisterReward(w http.ResponseWriter, r *http.Request) {
+	var rw Reward
+	if err := json.NewDecoder(r.Body).Decode(&rw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.AddReward(rw); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrRewardExists) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleRegisterOrder(w http.ResponseWriter, r *http.Request) {
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.RegisterOrder(req.Order, req.Goods); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrOrderExists) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	if !s.allow() {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.cfg.RetryAfter.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		// без настроенного лимита отказ вызван ThrottleNext и лимит в ответе не указывается
+		if s.cfg.RateLimit > 0 {
+			_, _ = fmt.Fprintf(w, tooManyRequestTemplate, s.cfg.RateLimit)
+		} else {
+			_, _ = fmt.Fprint(w, "Too many requests")
+		}
+		return
+	}
+	st, ok := s.OrderState(mux.Vars(r)["number"])
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(st)
+}
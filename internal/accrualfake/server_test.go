@@ -0,0 +1,178 @@
+package accrualfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock подменяемое текущее время для Server.Now.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestServer(cfg Config) (*Server, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	s := NewServer(cfg)
+	s.Now = clock.Now
+	return s, clock
+}
+
+func getOrder(s *Server, number string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/orders/"+number, nil))
+	return w
+}
+
+func TestRateLimitWindow(t *testing.T) {
+	s, clock := newTestServer(Config{RateLimit: 2, RetryAfter: 30 * time.Second})
+	steps := []struct {
+		advance time.Duration
+		want    int
+	}{
+		{0, http.StatusNoContent},
+		{10 * time.Second, http.StatusNoContent},
+		{10 * time.Second, http.StatusTooManyRequests},
+		{39 * time.Second, http.StatusTooManyRequests},
+		{time.Second, http.StatusNoContent},
+		{0, http.StatusNoContent},
+		{0, http.StatusTooManyRequests},
+	}
+	for i, st := range steps {
+		clock.now = clock.now.Add(st.advance)
+		w := getOrder(s, "79927398713")
+		if w.Code != st.want {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, st.want)
+		}
+		if w.Code != http.StatusTooManyRequests {
+			continue
+		}
+		if got := w.Header().Get("Retry-After"); got != "30" {
+			t.Errorf("request %d: Retry-After = %q, want 30", i, got)
+		}
+		if got := w.Body.String(); got != "No more than 2 requests per minute allowed" {
+			t.Errorf("request %d: body = %q", i, got)
+		}
+	}
+}
+
+func TestThrottleNext(t *testing.T) {
+	tests := []struct {
+		name      string
+		rateLimit int
+		wantBody  string
+	}{
+		{"no rate limit", 0, "Too many requests"},
+		{"with rate limit", 100, "No more than 100 requests per minute allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(Config{RateLimit: tt.rateLimit})
+			s.ThrottleNext(2)
+			for i := 0; i < 2; i++ {
+				w := getOrder(s, "79927398713")
+				if w.Code != http.StatusTooManyRequests {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusTooManyRequests)
+				}
+				if got := w.Body.String(); got != tt.wantBody {
+					t.Errorf("request %d: body = %q, want %q", i, got, tt.wantBody)
+				}
+			}
+			if w := getOrder(s, "79927398713"); w.Code != http.StatusNoContent {
+				t.Errorf("status after throttling = %d, want %d", w.Code, http.StatusNoContent)
+			}
+		})
+	}
+}
+
+func TestOrderStatusScript(t *testing.T) {
+	s, clock := newTestServer(Config{RegisteredDelay: time.Second, ProcessingDelay: 2 * time.Second})
+	if err := s.AddReward(Reward{Match: "Bork", Reward: 10, RewardType: RewardPercent}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddReward(Reward{Match: "LG", Reward: 50, RewardType: RewardPoints}); err != nil {
+		t.Fatal(err)
+	}
+	register := func(number, goods string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		body := `{"order":"` + number + `","goods":` + goods + `}`
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body)))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("register %s: status = %d, want %d", number, w.Code, http.StatusAccepted)
+		}
+	}
+	register("79927398713", `[{"description":"Чайник Bork","price":7000},{"description":"Телевизор LG","price":50000}]`)
+	register("12345678903", `[{"description":"Кружка","price":300}]`)
+	s.SetOrderState("4561261212345467", StatusInvalid, 0)
+
+	tests := []struct {
+		name        string
+		advance     time.Duration
+		number      string
+		wantCode    int
+		wantStatus  string
+		wantAccrual float64
+	}{
+		{"registered", 0, "79927398713", http.StatusOK, StatusRegistered, 0},
+		{"processing", time.Second, "79927398713", http.StatusOK, StatusProcessing, 0},
+		{"processed", 2 * time.Second, "79927398713", http.StatusOK, StatusProcessed, 750},
+		{"no reward matched", 0, "12345678903", http.StatusOK, StatusInvalid, 0},
+		{"fixed state", 0, "4561261212345467", http.StatusOK, StatusInvalid, 0},
+		{"unknown order", 0, "4532015112830366", http.StatusNoContent, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = clock.now.Add(tt.advance)
+			w := getOrder(s, tt.number)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var st OrderState
+			if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+				t.Fatal(err)
+			}
+			if st.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", st.Status, tt.wantStatus)
+			}
+			var accrual float64
+			if st.Accrual != nil {
+				accrual = *st.Accrual
+			}
+			if accrual != tt.wantAccrual {
+				t.Errorf("accrual = %v, want %v", accrual, tt.wantAccrual)
+			}
+		})
+	}
+}
+
+func TestRegisterOrderErrors(t *testing.T) {
+	s, _ := newTestServer(Config{})
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"registered", `{"order":"79927398713","goods":[]}`, http.StatusAccepted},
+		{"duplicate", `{"order":"79927398713","goods":[]}`, http.StatusConflict},
+		{"invalid number", `{"order":"79927398714","goods":[]}`, http.StatusBadRequest},
+		{"malformed", `{"order":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -1,52 +1,204 @@
 package app
 
 import (
+	"net"
 	"net/http"
 
 	"github.com/gorilla/mux"
 	"github.com/lipandr/yandex-practicum-diploma/internal/config"
 	"github.com/lipandr/yandex-practicum-diploma/internal/service"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
 )
 
 // Application интерфейс приложения.
 type Application interface {
 	Run() error
+	RunMetrics() error
+	Serve(l net.Listener) error
+	AddReadinessCheck(name string, check func() error)
+	SetAccrualCallback(fn func(state *types.AccrualOrderState) error)
+	SetRateLimitStore(store RateLimitStore)
+	Readiness(w http.ResponseWriter, r *http.Request)
 	UserRegistration(w http.ResponseWriter, r *http.Request)
 	UserAuthentication(w http.ResponseWriter, r *http.Request)
+	OIDCLogin(w http.ResponseWriter, r *http.Request)
+	OIDCLink(w http.ResponseWriter, r *http.Request)
+	OIDCCallback(w http.ResponseWriter, r *http.Request)
+	TwoFactorLogin(w http.ResponseWriter, r *http.Request)
+	EnrollTwoFactor(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactor(w http.ResponseWriter, r *http.Request)
+	DisableTwoFactor(w http.ResponseWriter, r *http.Request)
 	ReceiveOrder(w http.ResponseWriter, r *http.Request)
+	ReceiveOrdersBatch(w http.ResponseWriter, r *http.Request)
 	GetOrders(w http.ResponseWriter, r *http.Request)
+	GetOrder(w http.ResponseWriter, r *http.Request)
+	OrderEvents(w http.ResponseWriter, r *http.Request)
 	GetBalance(w http.ResponseWriter, r *http.Request)
+	GetBalanceHistory(w http.ResponseWriter, r *http.Request)
 	WithdrawRequest(w http.ResponseWriter, r *http.Request)
+	TransferPoints(w http.ResponseWriter, r *http.Request)
 	GetWithdrawals(w http.ResponseWriter, r *http.Request)
+	CancelWithdrawal(w http.ResponseWriter, r *http.Request)
+	RegisterWebhook(w http.ResponseWriter, r *http.Request)
+	GetWebhooks(w http.ResponseWriter, r *http.Request)
+	DeleteWebhook(w http.ResponseWriter, r *http.Request)
+	GetWebhookDeliveries(w http.ResponseWriter, r *http.Request)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	GetAPIKeys(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKey(w http.ResponseWriter, r *http.Request)
+	AccrualCallback(w http.ResponseWriter, r *http.Request)
+	AdminSearchUsers(w http.ResponseWriter, r *http.Request)
+	AdminGetUser(w http.ResponseWriter, r *http.Request)
+	AdminGetUserOrders(w http.ResponseWriter, r *http.Request)
+	AdminGetUserWithdrawals(w http.ResponseWriter, r *http.Request)
+	AdminGetUserBalance(w http.ResponseWriter, r *http.Request)
+	AdminBlockUser(w http.ResponseWriter, r *http.Request)
+	AdminUnblockUser(w http.ResponseWriter, r *http.Request)
+	AdminSetUserRole(w http.ResponseWriter, r *http.Request)
+	AdminAdjustBalance(w http.ResponseWriter, r *http.Request)
+	AdminGetAdjustments(w http.ResponseWriter, r *http.Request)
+	AdminRepollOrder(w http.ResponseWriter, r *http.Request)
+	AdminInvalidateOrder(w http.ResponseWriter, r *http.Request)
+	AdminReverseWithdrawal(w http.ResponseWriter, r *http.Request)
+	AdminReturnOrder(w http.ResponseWriter, r *http.Request)
 }
 
 type application struct {
-	cfg config.Config
-	svc service.Service
+	cfg    config.Config
+	svc    service.Service
+	checks map[string]func() error
+
+	limiter         *rateLimiter
+	accrualCallback func(state *types.AccrualOrderState) error
 }
 
 // NewApp метод конструктор приложения.
-func NewApp(cfg config.Config, svc service.Service) Application {
-	return &application{
-		cfg: cfg,
-		svc: svc,
+func NewApp(cfg config.Config, svc service.Service) (Application, error) {
+	limiter, err := newRateLimiter(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return &application{
+		cfg:     cfg,
+		svc:     svc,
+		limiter: limiter,
+		checks: map[string]func() error{
+			"database": svc.Ping,
+		},
+	}, nil
+}
+
+// AddReadinessCheck метод регистрации проверки готовности приложения.
+func (a *application) AddReadinessCheck(name string, check func() error) {
+	a.checks[name] = check
+}
+
+// SetAccrualCallback метод регистрации обработчика уведомлений системы начислений.
+func (a *application) SetAccrualCallback(fn func(state *types.AccrualOrderState) error) {
+	a.accrualCallback = fn
+}
+
+// SetRateLimitStore метод замены хранилища ограничений частоты запросов на общее для всех реплик.
+func (a *application) SetRateLimitStore(store RateLimitStore) {
+	a.limiter.setStore(store)
 }
 
 // Run метод запуска сервера приложения.
 func (a *application) Run() error {
-	r := mux.NewRouter()
+	return http.ListenAndServe(a.cfg.RunAddress, a.router())
+}
 
-	r.Use(GzipMiddleware, AuthMiddleware(a.svc))
+// Serve метод запуска сервера приложения на заранее открытом listener.
+func (a *application) Serve(l net.Listener) error {
+	return http.Serve(l, a.router())
+}
 
-	r.HandleFunc("/api/user/register", a.UserRegistration).Methods(http.MethodPost)
-	r.HandleFunc("/api/user/login", a.UserAuthentication).Methods(http.MethodPost)
+// permPublic разрешение маршрутов, доступных без аутентификации.
+const permPublic = ""
 
-	r.HandleFunc("/api/user/orders", a.ReceiveOrder).Methods(http.MethodPost)
-	r.HandleFunc("/api/user/orders", a.GetOrders).Methods(http.MethodGet)
-	r.HandleFunc("/api/user/balance", a.GetBalance).Methods(http.MethodGet)
-	r.HandleFunc("/api/user/balance/withdraw", a.WithdrawRequest).Methods(http.MethodPost)
-	r.HandleFunc("/api/user/withdrawals", a.GetWithdrawals).Methods(http.MethodGet)
+// route объявление маршрута с разрешением, необходимым для доступа к нему.
+type route struct {
+	method  string
+	path    string
+	perm    string
+	handler http.HandlerFunc
+}
 
-	return http.ListenAndServe(a.cfg.RunAddress, r)
+// routes метод объявления маршрутов приложения.
+func (a *application) routes() []route {
+	return []route{
+		{http.MethodGet, "/health/ready", permPublic, a.Readiness},
+		// уведомления системы начислений аутентифицируются подписью запроса
+		{http.MethodPost, "/internal/accrual/callback", permPublic, a.AccrualCallback},
+
+		{http.MethodPost, "/api/user/register", permPublic, a.UserRegistration},
+		{http.MethodPost, "/api/user/login", permPublic, a.UserAuthentication},
+		{http.MethodPost, "/api/user/login/2fa", permPublic, a.TwoFactorLogin},
+		{http.MethodGet, "/api/user/oidc/login", permPublic, a.OIDCLogin},
+		{http.MethodGet, "/api/user/oidc/callback", permPublic, a.OIDCCallback},
+		{http.MethodPost, "/api/user/oidc/link", types.PermIdentities, a.OIDCLink},
+		{http.MethodPost, "/api/user/2fa/enroll", types.PermTwoFactor, a.EnrollTwoFactor},
+		{http.MethodPost, "/api/user/2fa/confirm", types.PermTwoFactor, a.ConfirmTwoFactor},
+		{http.MethodPost, "/api/user/2fa/disable", types.PermTwoFactor, a.DisableTwoFactor},
+
+		{http.MethodPost, "/api/user/orders", types.PermOrdersWrite, a.ReceiveOrder},
+		{http.MethodGet, "/api/user/orders", types.PermOrdersRead, a.GetOrders},
+		{http.MethodPost, "/api/user/orders/batch", types.PermOrdersWrite, a.ReceiveOrdersBatch},
+		{http.MethodGet, "/api/user/orders/events", types.PermOrdersRead, a.OrderEvents},
+		{http.MethodGet, "/api/user/orders/{number:[0-9]+}", types.PermOrdersRead, a.GetOrder},
+		{http.MethodGet, "/api/user/balance", types.PermBalanceRead, a.GetBalance},
+		{http.MethodGet, "/api/user/balance/history", types.PermBalanceRead, a.GetBalanceHistory},
+		{http.MethodPost, "/api/user/balance/withdraw", types.PermBalanceWrite, a.WithdrawRequest},
+		{http.MethodPost, "/api/user/balance/transfer", types.PermTransfer, a.TransferPoints},
+		{http.MethodGet, "/api/user/withdrawals", types.PermBalanceRead, a.GetWithdrawals},
+		{http.MethodPost, "/api/user/withdrawals/{number:[0-9]+}/cancel", types.PermBalanceWrite, a.CancelWithdrawal},
+
+		{http.MethodPost, "/api/user/webhooks", types.PermWebhooks, a.RegisterWebhook},
+		{http.MethodGet, "/api/user/webhooks", types.PermWebhooks, a.GetWebhooks},
+		{http.MethodDelete, "/api/user/webhooks/{id:[0-9]+}", types.PermWebhooks, a.DeleteWebhook},
+		{http.MethodGet, "/api/user/webhooks/{id:[0-9]+}/deliveries", types.PermWebhooks, a.GetWebhookDeliveries},
+
+		{http.MethodPost, "/api/user/api-keys", types.PermAPIKeys, a.CreateAPIKey},
+		{http.MethodGet, "/api/user/api-keys", types.PermAPIKeys, a.GetAPIKeys},
+		{http.MethodDelete, "/api/user/api-keys/{id:[0-9]+}", types.PermAPIKeys, a.RevokeAPIKey},
+
+		{http.MethodGet, "/admin/api/users", types.PermSupportRead, a.AdminSearchUsers},
+		{http.MethodGet, "/admin/api/users/{id:[0-9]+}", types.PermSupportRead, a.AdminGetUser},
+		{http.MethodGet, "/admin/api/users/{id:[0-9]+}/orders", types.PermSupportRead, a.AdminGetUserOrders},
+		{http.MethodGet, "/admin/api/users/{id:[0-9]+}/withdrawals", types.PermSupportRead, a.AdminGetUserWithdrawals},
+		{http.MethodGet, "/admin/api/users/{id:[0-9]+}/balance", types.PermSupportRead, a.AdminGetUserBalance},
+		{http.MethodGet, "/admin/api/users/{id:[0-9]+}/adjustments", types.PermSupportRead, a.AdminGetAdjustments},
+		{http.MethodPost, "/admin/api/users/{id:[0-9]+}/block", types.PermSupportUsers, a.AdminBlockUser},
+		{http.MethodPost, "/admin/api/users/{id:[0-9]+}/unblock", types.PermSupportUsers, a.AdminUnblockUser},
+		{http.MethodPut, "/admin/api/users/{id:[0-9]+}/role", types.PermRolesManage, a.AdminSetUserRole},
+		{http.MethodPost, "/admin/api/users/{id:[0-9]+}/adjustments", types.PermBalanceAdjust, a.AdminAdjustBalance},
+		{http.MethodPost, "/admin/api/orders/{number:[0-9]+}/repoll", types.PermSupportOrders, a.AdminRepollOrder},
+		{http.MethodPost, "/admin/api/orders/{number:[0-9]+}/invalidate", types.PermSupportOrders, a.AdminInvalidateOrder},
+		{http.MethodPost, "/admin/api/orders/{number:[0-9]+}/return", types.PermOrdersReturn, a.AdminReturnOrder},
+		{http.MethodPost, "/admin/api/withdrawals/{number:[0-9]+}/reverse", types.PermBalanceAdjust, a.AdminReverseWithdrawal},
+	}
+}
+
+// router метод построения маршрутизатора приложения.
+// Все маршруты оборачиваются в ограничение частоты запросов по IP-адресу клиента и по субъекту,
+// маршруты, требующие разрешения, - дополнительно в AuthMiddleware с этим разрешением между ними,
+// маршруты создания заказов и списаний - в IdempotencyMiddleware.
+func (a *application) router() http.Handler {
+	r := mux.NewRouter()
+
+	r.Use(GzipMiddleware)
+
+	for _, rt := range a.routes() {
+		var h http.Handler = rt.handler
+		if idempotentRoutes[rt.method+" "+rt.path] {
+			h = IdempotencyMiddleware(a.svc)(h)
+		}
+		h = a.limiter.middleware(rt)(h)
+		if rt.perm != permPublic {
+			h = AuthMiddleware(a.svc, rt.perm)(h)
+		}
+		h = a.limiter.ipMiddleware(rt)(h)
+		r.Handle(rt.path, h).Methods(rt.method)
+	}
+	return r
 }
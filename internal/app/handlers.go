@@ -4,9 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/joeljunstrom/go-luhn"
 	"github.com/lipandr/yandex-practicum-diploma/internal/types"
 )
@@ -37,6 +42,7 @@ func (a *application) UserRegistration(w http.ResponseWriter, r *http.Request) {
 }
 
 // UserAuthentication Handler аутентификация зарегистрированного пользователя.
+// Если у пользователя включена двухфакторная аутентификация, отвечает 202 с challenge для TwoFactorLogin.
 func (a *application) UserAuthentication(w http.ResponseWriter, r *http.Request) {
 	var user types.UserRequest
 
@@ -49,6 +55,10 @@ func (a *application) UserAuthentication(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	if res.TwoFactorRequired {
+		writeJSON(w, http.StatusAccepted, res)
+		return
+	}
 	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", res.Token))
 
 	if err := json.NewEncoder(w).Encode(res); err != nil {
@@ -58,22 +68,39 @@ func (a *application) UserAuthentication(w http.ResponseWriter, r *http.Request)
 }
 
 // ReceiveOrder Handler принятие в обработку нового заказа.
+// Принимает номер заказа текстом либо JSON с номером и составом заказа.
 func (a *application) ReceiveOrder(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(types.UserID).(int)
+	userID := principal(r).UserID
 
 	value, err := ioutil.ReadAll(r.Body)
 	defer func() { _ = r.Body.Close() }()
 
-	if err != nil || len(value) == 0 {
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	orderNumber := string(value)
+	if len(value) == 0 {
+		http.Error(w, types.ErrOrderNumberInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+	upload := types.OrderUpload{Order: string(value)}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		upload = types.OrderUpload{}
+		if err := json.Unmarshal(value, &upload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateGoods(upload.Goods); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	orderNumber := upload.Order
 	if err := ValidateOrderNumber(orderNumber); err != nil {
 		http.Error(w, types.ErrOrderNumberInvalid.Error(), http.StatusUnprocessableEntity)
 		return
 	}
-	if err := a.svc.ReceiveOrder(userID, orderNumber); err != nil {
+	if err := a.svc.ReceiveOrder(userID, orderNumber, upload.Goods); err != nil {
 		status := http.StatusInternalServerError
 		if errors.Is(err, types.ErrOrderUploadedByUser) {
 			status = http.StatusOK
@@ -87,9 +114,62 @@ func (a *application) ReceiveOrder(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// ReceiveOrdersBatch Handler пакетное принятие в обработку новых заказов.
+// Принимает JSON-массив номеров либо список номеров, разделенных переводом строки.
+func (a *application) ReceiveOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	orderNumbers, err := parseOrdersBatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(orderNumbers) == 0 {
+		http.Error(w, types.ErrOrdersBatchEmpty.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(orderNumbers) > a.cfg.OrdersBatchLimit {
+		http.Error(w, types.ErrOrdersBatchTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	res := make([]types.BatchOrderResult, len(orderNumbers))
+	var valid []string
+	var validIdx []int
+	for i, orderNumber := range orderNumbers {
+		if err := ValidateOrderNumber(orderNumber); err != nil {
+			res[i] = types.BatchOrderResult{
+				Number: orderNumber,
+				Status: http.StatusUnprocessableEntity,
+				Result: types.BatchOrderInvalid,
+				Error:  err.Error(),
+			}
+			continue
+		}
+		valid = append(valid, orderNumber)
+		validIdx = append(validIdx, i)
+	}
+	if len(valid) > 0 {
+		accepted, err := a.svc.ReceiveOrders(userID, valid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i, idx := range validIdx {
+			res[idx] = accepted[i]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // GetOrders Handler получение списка загруженных заказов для начисления.
 func (a *application) GetOrders(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(types.UserID).(int)
+	userID := principal(r).UserID
 
 	orders, err := a.svc.GetOrders(userID)
 	if err != nil {
@@ -109,19 +189,144 @@ func (a *application) GetOrders(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetBalance Handler получение текущего баланса пользователя.
+// GetOrder Handler получение информации о заказе пользователя.
+func (a *application) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+	orderNumber := mux.Vars(r)["number"]
+
+	order, err := a.svc.GetOrder(userID, orderNumber)
+	if err != nil {
+		if errors.Is(err, types.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// OrderEvents Handler поток событий изменения заказов пользователя (Server-Sent Events).
+// Поддерживает возобновление потока по заголовку Last-Event-ID.
+func (a *application) OrderEvents(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+	// подписка оформляется до чтения пропущенных событий, чтобы не потерять события между ними
+	ch, unsubscribe := a.svc.SubscribeOrderEvents(userID)
+	defer unsubscribe()
+
+	var missed []types.OrderEvent
+	if lastID > 0 {
+		var err error
+		missed, err = a.svc.GetOrderEvents(userID, lastID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for i := range missed {
+		if err := writeOrderEvent(w, &missed[i]); err != nil {
+			return
+		}
+		lastID = missed[i].ID
+	}
+	flusher.Flush()
+
+	// при EVENTS_HEARTBEAT <= 0 комментарии-пульс не отправляются
+	var heartbeat <-chan time.Time
+	if a.cfg.EventsHeartbeat > 0 {
+		t := time.NewTicker(a.cfg.EventsHeartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.ID <= lastID {
+				continue
+			}
+			if err := writeOrderEvent(w, e); err != nil {
+				return
+			}
+			lastID = e.ID
+		}
+		flusher.Flush()
+	}
+}
+
+// Метод-helper OrderEvents записи события в формате Server-Sent Events.
+func writeOrderEvent(w io.Writer, e *types.OrderEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: order\ndata: %s\n\n", e.ID, data)
+	return err
+}
+
+// GetBalance Handler получение текущего баланса пользователя: доступных баллов, баллов на удержании
+// и баллов, которые скоро сгорят.
 func (a *application) GetBalance(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(types.UserID).(int)
+	userID := principal(r).UserID
 
 	crnt, wthd, err := a.svc.GetBalance(userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	pending, err := a.svc.GetPendingPoints(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expiring, err := a.svc.GetExpiringPoints(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	res := types.JSONBalance{
-		Current:   crnt,
-		Withdrawn: wthd,
+		Current:      crnt,
+		Pending:      pending,
+		Withdrawn:    wthd,
+		ExpiringSoon: expiring,
 	}
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
@@ -131,9 +336,25 @@ func (a *application) GetBalance(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// GetBalanceHistory Handler получение истории начислений, списаний, корректировок и сгорания баллов.
+func (a *application) GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	entries, err := a.svc.GetBalanceHistory(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
 // WithdrawRequest Handler запрос на списание начислений.
 func (a *application) WithdrawRequest(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(types.UserID).(int)
+	userID := principal(r).UserID
 
 	var req types.JSONWithdrawRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -154,9 +375,37 @@ func (a *application) WithdrawRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// TransferPoints Handler перевод баллов другому пользователю.
+func (a *application) TransferPoints(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	var req types.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, err := a.svc.TransferPoints(userID, &req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, types.ErrInsufficientAccruals):
+			status = http.StatusPaymentRequired
+		case errors.Is(err, types.ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, types.ErrTransferLimitExceeded):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, types.ErrTransferInvalid), errors.Is(err, types.ErrUserBlocked):
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
 // GetWithdrawals Handler получение списка списаний начислений.
 func (a *application) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(types.UserID).(int)
+	userID := principal(r).UserID
 
 	wthd, err := a.svc.GetWithdrawals(userID)
 	if err != nil {
@@ -176,6 +425,70 @@ func (a *application) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CancelWithdrawal Handler отмена списания, срок отмены которого не истек.
+func (a *application) CancelWithdrawal(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	wthd, err := a.svc.CancelWithdrawal(userID, mux.Vars(r)["number"])
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, types.ErrWithdrawalNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, types.ErrWithdrawalNotCancellable):
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, wthd)
+}
+
+// Метод-helper ReceiveOrdersBatch разбора списка номеров заказов из тела запроса.
+func parseOrdersBatch(r *http.Request) ([]string, error) {
+	defer func() { _ = r.Body.Close() }()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var orderNumbers []string
+		if err := json.NewDecoder(r.Body).Decode(&orderNumbers); err != nil {
+			return nil, err
+		}
+		return orderNumbers, nil
+	}
+	value, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var orderNumbers []string
+	for _, line := range strings.Split(string(value), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			orderNumbers = append(orderNumbers, line)
+		}
+	}
+	return orderNumbers, nil
+}
+
+// Readiness Handler проверка готовности приложения к обслуживанию запросов.
+func (a *application) Readiness(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	res := make(map[string]string, len(a.checks))
+	for name, check := range a.checks {
+		if err := check(); err != nil {
+			res[name] = err.Error()
+			status = http.StatusServiceUnavailable
+		} else {
+			res[name] = "ok"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // ValidateOrderNumber метод-helper для валидации номеров заказов по алгоритму Луна.
 func ValidateOrderNumber(orderID string) error {
 	if ok := luhn.Valid(orderID); !ok {
@@ -186,3 +499,13 @@ func ValidateOrderNumber(orderID string) error {
 	}
 	return nil
 }
+
+// validateGoods метод-helper для валидации состава заказа.
+func validateGoods(goods []types.Good) error {
+	for _, g := range goods {
+		if strings.TrimSpace(g.Description) == "" || g.Price < 0 {
+			return types.ErrGoodsInvalid
+		}
+	}
+	return nil
+}
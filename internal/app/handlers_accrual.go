@@ -0,0 +1,64 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+	"github.com/lipandr/yandex-practicum-diploma/internal/webhook"
+)
+
+// AccrualSignatureHeader заголовок подписи уведомления системы начислений.
+const AccrualSignatureHeader = "X-Accrual-Signature"
+
+// accrualStatuses статусы, которые может прислать система начислений.
+var accrualStatuses = map[string]interface{}{
+	"REGISTERED": nil,
+	"PROCESSING": nil,
+	"INVALID":    nil,
+	"PROCESSED":  nil,
+}
+
+// AccrualCallback Handler прием уведомления системы начислений об изменении состояния заказа.
+// Тело запроса вместе с меткой времени подписывается HMAC-SHA256 с секретом ACCRUAL_CALLBACK_SECRET
+// в заголовке AccrualSignatureHeader в формате "t=<unix>,sha256=<hex>" (см. webhook.SignTimestamped).
+// Уведомления старше ACCRUAL_CALLBACK_MAX_AGE отклоняются, повторные уведомления по заказу
+// в окончательном статусе его не меняют.
+func (a *application) AccrualCallback(w http.ResponseWriter, r *http.Request) {
+	if a.cfg.AccrualCallbackSecret == "" || a.accrualCallback == nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = webhook.VerifyTimestamped(a.cfg.AccrualCallbackSecret, body, r.Header.Get(AccrualSignatureHeader),
+		a.cfg.AccrualCallbackMaxAge, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var state types.AccrualOrderState
+	if err = json.Unmarshal(body, &state); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := accrualStatuses[state.Status]; !ok || state.Order == "" {
+		http.Error(w, types.ErrAccrualStateInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = a.accrualCallback(&state); err != nil {
+		if errors.Is(err, types.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,268 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// AdminSearchUsers Handler поиск пользователей по вхождению строки в логин.
+func (a *application) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.svc.SearchUsers(r.URL.Query().Get("login"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(users) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// AdminGetUser Handler получение сведений о пользователе.
+func (a *application) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	u, err := a.svc.GetAdminUser(userID)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// AdminGetUserOrders Handler получение списка заказов пользователя.
+func (a *application) AdminGetUserOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	orders, err := a.svc.GetOrders(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(orders) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, orders)
+}
+
+// AdminGetUserWithdrawals Handler получение списка списаний пользователя.
+func (a *application) AdminGetUserWithdrawals(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	withdrawals, err := a.svc.GetWithdrawals(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(withdrawals) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, withdrawals)
+}
+
+// AdminGetUserBalance Handler получение баланса пользователя.
+func (a *application) AdminGetUserBalance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	crnt, wthd, err := a.svc.GetBalance(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pending, err := a.svc.GetPendingPoints(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.JSONBalance{
+		Current:   crnt,
+		Pending:   pending,
+		Withdrawn: wthd,
+	})
+}
+
+// AdminBlockUser Handler блокировка пользователя.
+func (a *application) AdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	a.setUserBlocked(w, r, true)
+}
+
+// AdminUnblockUser Handler разблокировка пользователя.
+func (a *application) AdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	a.setUserBlocked(w, r, false)
+}
+
+func (a *application) setUserBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.svc.SetUserBlocked(userID, blocked); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminSetUserRole Handler назначение роли пользователю.
+func (a *application) AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req types.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.svc.SetUserRole(userID, req.Role); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminAdjustBalance Handler ручная корректировка баланса пользователя.
+func (a *application) AdminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	operatorID := principal(r).UserID
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req types.AdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	adj, err := a.svc.AdjustBalance(operatorID, userID, &req)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, adj)
+}
+
+// AdminGetAdjustments Handler получение списка корректировок баланса пользователя.
+func (a *application) AdminGetAdjustments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	adjs, err := a.svc.GetBalanceAdjustments(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(adjs) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, adjs)
+}
+
+// AdminRepollOrder Handler постановка заказа на внеочередной опрос системы начислений.
+func (a *application) AdminRepollOrder(w http.ResponseWriter, r *http.Request) {
+	if err := a.svc.RepollOrder(mux.Vars(r)["number"]); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AdminInvalidateOrder Handler ручной перевод заказа в статус INVALID.
+func (a *application) AdminInvalidateOrder(w http.ResponseWriter, r *http.Request) {
+	if err := a.svc.InvalidateOrder(mux.Vars(r)["number"]); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminReverseWithdrawal Handler сторнирование завершенного списания с возвратом баллов пользователю.
+func (a *application) AdminReverseWithdrawal(w http.ResponseWriter, r *http.Request) {
+	operatorID := principal(r).UserID
+
+	var req types.ReversalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wthd, err := a.svc.ReverseWithdrawal(operatorID, mux.Vars(r)["number"], &req)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, wthd)
+}
+
+// AdminReturnOrder Handler полный или частичный возврат заказа с отзывом начисленных баллов.
+func (a *application) AdminReturnOrder(w http.ResponseWriter, r *http.Request) {
+	operatorID := principal(r).UserID
+
+	var req types.ReturnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ret, err := a.svc.ReturnOrder(operatorID, mux.Vars(r)["number"], &req)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, ret)
+}
+
+// pathUserID метод-helper получения идентификатора пользователя из пути запроса.
+func pathUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
+
+// writeAdminError метод-helper отправки ответа с кодом, соответствующим ошибке административного запроса.
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, types.ErrUserNotFound), errors.Is(err, types.ErrOrderNotFound),
+		errors.Is(err, types.ErrWithdrawalNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, types.ErrOrderAlreadyProcessed), errors.Is(err, types.ErrWithdrawalNotReversible),
+		errors.Is(err, types.ErrOrderNotProcessed):
+		status = http.StatusConflict
+	case errors.Is(err, types.ErrAdjustmentInvalid), errors.Is(err, types.ErrRoleUnknown),
+		errors.Is(err, types.ErrReversalInvalid), errors.Is(err, types.ErrReturnInvalid),
+		errors.Is(err, types.ErrGoodsUnavailable), errors.Is(err, types.ErrGoodsReturned):
+		status = http.StatusUnprocessableEntity
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writeJSON метод-helper отправки ответа в формате JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// CreateAPIKey Handler выпуск API-ключа пользователя для интеграции.
+func (a *application) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	var req types.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	k, err := a.svc.CreateAPIKey(userID, &req)
+	if err != nil {
+		if errors.Is(err, types.ErrAPIKeyScopeUnknown) || errors.Is(err, types.ErrAPIKeyExpiryInvalid) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, k)
+}
+
+// GetAPIKeys Handler получение списка API-ключей пользователя.
+func (a *application) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	keys, err := a.svc.GetAPIKeys(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(keys) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey Handler отзыв API-ключа пользователя.
+func (a *application) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	keyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = a.svc.RevokeAPIKey(userID, keyID); err != nil {
+		if errors.Is(err, types.ErrAPIKeyNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const (
+	// oidcStateCookie cookie, привязывающая начатый вход через внешнего провайдера к браузеру.
+	oidcStateCookie = "gophermart_oidc_state"
+	// oidcStateCookiePath путь, для которого браузер отправляет cookie с state.
+	oidcStateCookiePath = "/api/user/oidc/callback"
+	// oidcStateCookieTTL время жизни cookie с state, равное времени, отведенному на вход.
+	oidcStateCookieTTL = 10 * time.Minute
+)
+
+// OIDCLogin Handler начало входа через внешнего провайдера: перенаправление на страницу авторизации.
+func (a *application) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	u, state, err := a.svc.OIDCAuthURL(0)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	a.setOIDCStateCookie(w, state, int(oidcStateCookieTTL.Seconds()))
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// OIDCLink Handler начало привязки внешней учетной записи к текущему пользователю.
+// Адрес авторизации действует только в браузере, получившем ответ, поэтому пересланная
+// другому пользователю ссылка не привяжет его учетную запись к текущему пользователю.
+func (a *application) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	u, state, err := a.svc.OIDCAuthURL(userID)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	a.setOIDCStateCookie(w, state, int(oidcStateCookieTTL.Seconds()))
+	writeJSON(w, http.StatusOK, types.AuthURLResponse{AuthorizationURL: u})
+}
+
+// OIDCCallback Handler завершение входа через внешнего провайдера и выдача токена авторизации.
+func (a *application) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, fmt.Sprintf("%s: %s", e, q.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+	// state удаляется в любом случае: повторно он не используется
+	a.setOIDCStateCookie(w, "", -1)
+	if !oidcStateMatches(r, q.Get("state")) {
+		writeOIDCError(w, types.ErrOIDCStateInvalid)
+		return
+	}
+	res, err := a.svc.OIDCCallback(q.Get("code"), q.Get("state"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	if res.TwoFactorRequired {
+		writeJSON(w, http.StatusAccepted, res)
+		return
+	}
+	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", res.Token))
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// setOIDCStateCookie метод-helper установки cookie с state входа; при maxAge < 0 cookie удаляется.
+// Cookie с SameSite=Lax отправляется при переходе со страницы провайдера на адрес возврата.
+func (a *application) setOIDCStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.cfg.OIDCRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcStateMatches метод-helper проверки, что state из адреса возврата совпадает с state из cookie браузера.
+func oidcStateMatches(r *http.Request, state string) bool {
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil || c.Value == "" || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) == 1
+}
+
+// writeOIDCError метод-helper отправки ответа с кодом, соответствующим ошибке входа через внешнего провайдера.
+// Ошибки обмена кода и проверки ID-токена считаются ошибками аутентификации.
+func writeOIDCError(w http.ResponseWriter, err error) {
+	status := http.StatusUnauthorized
+	switch {
+	case errors.Is(err, types.ErrOIDCDisabled):
+		status = http.StatusNotFound
+	case errors.Is(err, types.ErrIdentityLinked):
+		status = http.StatusConflict
+	case errors.Is(err, types.ErrUserBlocked):
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
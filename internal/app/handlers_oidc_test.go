@@ -0,0 +1,32 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOIDCStateMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+		want   bool
+	}{
+		{"matching state", "abc", "abc", true},
+		{"no cookie", "", "abc", false},
+		{"state from another browser", "abc", "xyz", false},
+		{"empty state", "abc", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/oidc/callback?state="+tt.state, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			if got := oidcStateMatches(r, tt.state); got != tt.want {
+				t.Errorf("oidcStateMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
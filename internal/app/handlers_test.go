@@ -0,0 +1,615 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
+	"github.com/lipandr/yandex-practicum-diploma/internal/service"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// tokenPrincipal аутентификация тестовых запросов: токен "<роль>:<id пользователя>" дает субъекта
+// с этой ролью, токен "blocked" - заблокированного пользователя.
+func tokenPrincipal(token string) (*types.Principal, error) {
+	if token == "blocked" {
+		return nil, types.ErrUserBlocked
+	}
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return nil, types.ErrUsersNotAuthenticated
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, types.ErrUsersNotAuthenticated
+	}
+	return &types.Principal{UserID: userID, Role: parts[0]}, nil
+}
+
+// testRouter маршрутизатор приложения над svc с настройками cfg.
+func testRouter(t *testing.T, cfg config.Config, svc service.Service) http.Handler {
+	t.Helper()
+	a, err := NewApp(cfg, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*application).router()
+}
+
+// serve метод-helper выполнения запроса к маршрутизатору h с токеном token.
+func serve(h http.Handler, method, path, token, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// orderService Service с заказом 79927398713 пользователя 1.
+type orderService struct {
+	fakeService
+}
+
+func (s *orderService) GetOrder(userID int, orderNumber string) (*types.OrderInfo, error) {
+	if userID != 1 || orderNumber != "79927398713" {
+		return nil, types.ErrOrderNotFound
+	}
+	return &types.OrderInfo{
+		Order: types.Order{
+			OrderNumber: orderNumber,
+			Status:      "PROCESSED",
+			Accrual:     &types.NullFloat64{Float64: 500, Valid: true},
+			UploadedAt:  "2024-01-01T12:00:00+03:00",
+		},
+		PolledAt:        "2024-01-01T12:00:05+03:00",
+		AccrualAttempts: 2,
+	}, nil
+}
+
+func TestGetOrder(t *testing.T) {
+	h := testRouter(t, config.Config{}, &orderService{fakeService{principal: tokenPrincipal}})
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"own order", "/api/user/orders/79927398713", "user:1", http.StatusOK},
+		{"order of another user", "/api/user/orders/79927398713", "user:2", http.StatusNotFound},
+		{"unknown order", "/api/user/orders/12345678903", "user:1", http.StatusNotFound},
+		{"not a number", "/api/user/orders/abc", "user:1", http.StatusNotFound},
+		{"without token", "/api/user/orders/79927398713", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, http.MethodGet, tt.path, tt.token, "", "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]interface{}{
+				"number":           "79927398713",
+				"status":           "PROCESSED",
+				"accrual":          500.0,
+				"uploaded_at":      "2024-01-01T12:00:00+03:00",
+				"polled_at":        "2024-01-01T12:00:05+03:00",
+				"accrual_attempts": 2.0,
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+// uploadService Service, запоминающий принятый заказ и его состав.
+type uploadService struct {
+	fakeService
+	order string
+	goods []types.Good
+}
+
+func (s *uploadService) ReceiveOrder(userID int, orderNumber string, goods []types.Good) error {
+	s.order, s.goods = orderNumber, goods
+	return nil
+}
+
+func TestReceiveOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantGoods   int
+	}{
+		{name: "number as text", contentType: "text/plain", body: "79927398713", want: http.StatusAccepted},
+		{
+			name:        "json with goods",
+			contentType: "application/json",
+			body:        `{"order":"79927398713","goods":[{"description":"Чайник Bork","price":7000},{"description":"Кружка","price":300}]}`,
+			want:        http.StatusAccepted,
+			wantGoods:   2,
+		},
+		{name: "json without goods", contentType: "application/json", body: `{"order":"79927398713"}`, want: http.StatusAccepted},
+		{
+			name:        "goods without description",
+			contentType: "application/json",
+			body:        `{"order":"79927398713","goods":[{"description":" ","price":7000}]}`,
+			want:        http.StatusBadRequest,
+		},
+		{
+			name:        "negative price",
+			contentType: "application/json",
+			body:        `{"order":"79927398713","goods":[{"description":"Кружка","price":-1}]}`,
+			want:        http.StatusBadRequest,
+		},
+		{name: "malformed json", contentType: "application/json", body: `{"order":`, want: http.StatusBadRequest},
+		{name: "invalid number", contentType: "application/json", body: `{"order":"79927398714"}`, want: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &uploadService{fakeService: fakeService{principal: tokenPrincipal}}
+			h := testRouter(t, config.Config{}, svc)
+			w := serve(h, http.MethodPost, "/api/user/orders", "user:1", tt.contentType, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusAccepted {
+				if svc.order != "" {
+					t.Errorf("order %s sent to service, want none", svc.order)
+				}
+				return
+			}
+			if svc.order != "79927398713" || len(svc.goods) != tt.wantGoods {
+				t.Errorf("sent to service %s with %d goods, want 79927398713 with %d", svc.order, len(svc.goods), tt.wantGoods)
+			}
+		})
+	}
+}
+
+// batchService Service, принимающий пакет заказов: номер 79927398713 уже загружен пользователем,
+// номер 12345678903 - другим пользователем, остальные принимаются.
+type batchService struct {
+	fakeService
+	received []string
+}
+
+func (s *batchService) ReceiveOrders(userID int, orderNumbers []string) ([]types.BatchOrderResult, error) {
+	s.received = orderNumbers
+	res := make([]types.BatchOrderResult, len(orderNumbers))
+	for i, n := range orderNumbers {
+		res[i] = types.BatchOrderResult{Number: n, Status: http.StatusAccepted, Result: types.BatchOrderAccepted}
+		switch n {
+		case "79927398713":
+			res[i].Status, res[i].Result = http.StatusOK, types.BatchOrderUploadedByUser
+		case "12345678903":
+			res[i].Status, res[i].Result = http.StatusConflict, types.BatchOrderUploadedByAnother
+		}
+	}
+	return res, nil
+}
+
+func TestReceiveOrdersBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantResults []int
+		wantSent    []string
+	}{
+		{
+			name:        "json array",
+			contentType: "application/json",
+			body:        `["2377225624","79927398713","12345678903"]`,
+			want:        http.StatusMultiStatus,
+			wantResults: []int{http.StatusAccepted, http.StatusOK, http.StatusConflict},
+			wantSent:    []string{"2377225624", "79927398713", "12345678903"},
+		},
+		{
+			name:        "newline list with invalid number",
+			contentType: "text/plain",
+			body:        "2377225624\n\n79927398714\n 79927398713 \n",
+			want:        http.StatusMultiStatus,
+			wantResults: []int{http.StatusAccepted, http.StatusUnprocessableEntity, http.StatusOK},
+			wantSent:    []string{"2377225624", "79927398713"},
+		},
+		{
+			name:        "only invalid numbers",
+			contentType: "text/plain",
+			body:        "79927398714\nabc",
+			want:        http.StatusMultiStatus,
+			wantResults: []int{http.StatusUnprocessableEntity, http.StatusUnprocessableEntity},
+		},
+		{name: "empty", contentType: "application/json", body: `[]`, want: http.StatusBadRequest},
+		{name: "malformed json", contentType: "application/json", body: `["1"`, want: http.StatusBadRequest},
+		{
+			name:        "too large",
+			contentType: "text/plain",
+			body:        "2377225624\n79927398713\n12345678903\n4532015112830366",
+			want:        http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &batchService{fakeService: fakeService{principal: tokenPrincipal}}
+			h := testRouter(t, config.Config{OrdersBatchLimit: 3}, svc)
+			w := serve(h, http.MethodPost, "/api/user/orders/batch", "user:1", tt.contentType, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if strings.Join(svc.received, ",") != strings.Join(tt.wantSent, ",") {
+				t.Errorf("sent to service %v, want %v", svc.received, tt.wantSent)
+			}
+			if w.Code != http.StatusMultiStatus {
+				return
+			}
+			var res []types.BatchOrderResult
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != len(tt.wantResults) {
+				t.Fatalf("results = %+v, want %d items", res, len(tt.wantResults))
+			}
+			for i, code := range tt.wantResults {
+				if res[i].Status != code {
+					t.Errorf("item %d (%s): status = %d, want %d", i, res[i].Number, res[i].Status, code)
+				}
+			}
+		})
+	}
+}
+
+// eventsService Service с событиями 1-3 по заказам пользователя 1 и каналом новых событий live.
+type eventsService struct {
+	fakeService
+	live chan *types.OrderEvent
+}
+
+func (s *eventsService) GetOrderEvents(userID int, afterID int64) ([]types.OrderEvent, error) {
+	var res []types.OrderEvent
+	for id := afterID + 1; id <= 3; id++ {
+		res = append(res, types.OrderEvent{ID: id, UserID: userID, OrderNumber: "79927398713", Status: "PROCESSING"})
+	}
+	return res, nil
+}
+
+func (s *eventsService) SubscribeOrderEvents(int) (<-chan *types.OrderEvent, func()) {
+	return s.live, func() {}
+}
+
+func TestOrderEvents(t *testing.T) {
+	svc := &eventsService{fakeService: fakeService{principal: tokenPrincipal}, live: make(chan *types.OrderEvent, 4)}
+	ts := httptest.NewServer(testRouter(t, config.Config{EventsHeartbeat: 20 * time.Millisecond}, svc))
+	defer ts.Close()
+
+	open := func(lastEventID string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/orders/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer user:1")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		res := open("abc")
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("resume and live events", func(t *testing.T) {
+		res := open("1")
+		defer func() { _ = res.Body.Close() }()
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("status = %d, content type %q", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		// событие 3 уже отправлено как пропущенное и не повторяется
+		svc.live <- &types.OrderEvent{ID: 3, UserID: 1, OrderNumber: "79927398713", Status: "PROCESSING"}
+		svc.live <- &types.OrderEvent{ID: 4, UserID: 1, OrderNumber: "79927398713", Status: "PROCESSED", Accrual: 500}
+
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			sc := bufio.NewScanner(res.Body)
+			for sc.Scan() {
+				lines <- sc.Text()
+			}
+		}()
+		var ids []string
+		heartbeat := false
+		deadline := time.After(2 * time.Second)
+		for len(ids) < 3 || !heartbeat {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("stream closed, ids %v", ids)
+				}
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					ids = append(ids, strings.TrimPrefix(line, "id: "))
+				case line == ": heartbeat":
+					heartbeat = true
+				}
+			case <-deadline:
+				t.Fatalf("ids = %v, heartbeat %v", ids, heartbeat)
+			}
+		}
+		if got := strings.Join(ids, ","); got != "2,3,4" {
+			t.Errorf("event ids = %s, want 2,3,4", got)
+		}
+	})
+}
+
+// adminService Service административного API, запоминающий вызовы и возвращающий ошибку err.
+type adminService struct {
+	fakeService
+	err   error
+	calls []string
+}
+
+func (s *adminService) record(format string, args ...interface{}) error {
+	s.calls = append(s.calls, fmt.Sprintf(format, args...))
+	return s.err
+}
+
+func (s *adminService) GetAdminUser(userID int) (*types.AdminUser, error) {
+	if err := s.record("get %d", userID); err != nil {
+		return nil, err
+	}
+	return &types.AdminUser{ID: userID, Login: "user"}, nil
+}
+
+func (s *adminService) SetUserBlocked(userID int, blocked bool) error {
+	return s.record("block %d %v", userID, blocked)
+}
+
+func (s *adminService) SetUserRole(userID int, role string) error {
+	return s.record("role %d %s", userID, role)
+}
+
+func (s *adminService) AdjustBalance(operatorID, userID int, req *types.AdjustmentRequest) (*types.BalanceAdjustment, error) {
+	if err := s.record("adjust %d %d %v", operatorID, userID, req.Amount); err != nil {
+		return nil, err
+	}
+	return &types.BalanceAdjustment{UserID: userID, Amount: req.Amount, Reason: req.Reason, OperatorID: operatorID}, nil
+}
+
+func (s *adminService) RepollOrder(orderNumber string) error {
+	return s.record("repoll %s", orderNumber)
+}
+
+func (s *adminService) InvalidateOrder(orderNumber string) error {
+	return s.record("invalidate %s", orderNumber)
+}
+
+func (s *adminService) ReverseWithdrawal(operatorID int, orderNumber string, req *types.ReversalRequest) (*types.Withdraw, error) {
+	if err := s.record("reverse %d %s", operatorID, orderNumber); err != nil {
+		return nil, err
+	}
+	return &types.Withdraw{OrderNumber: orderNumber}, nil
+}
+
+func TestAdminHandlers(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		method   string
+		path     string
+		body     string
+		err      error
+		want     int
+		wantCall string
+	}{
+		{name: "get user", method: http.MethodGet, path: "/admin/api/users/5", want: http.StatusOK, wantCall: "get 5"},
+		{name: "unknown user", method: http.MethodGet, path: "/admin/api/users/5", err: types.ErrUserNotFound, want: http.StatusNotFound, wantCall: "get 5"},
+		{name: "block", method: http.MethodPost, path: "/admin/api/users/5/block", want: http.StatusNoContent, wantCall: "block 5 true"},
+		{name: "unblock", method: http.MethodPost, path: "/admin/api/users/5/unblock", want: http.StatusNoContent, wantCall: "block 5 false"},
+		{name: "set role", method: http.MethodPut, path: "/admin/api/users/5/role", body: `{"role":"support"}`, want: http.StatusNoContent, wantCall: "role 5 support"},
+		{name: "unknown role", method: http.MethodPut, path: "/admin/api/users/5/role", body: `{"role":"owner"}`, err: types.ErrRoleUnknown, want: http.StatusUnprocessableEntity, wantCall: "role 5 owner"},
+		{name: "malformed role", method: http.MethodPut, path: "/admin/api/users/5/role", body: `{"role":`, want: http.StatusBadRequest},
+		{name: "adjust balance", method: http.MethodPost, path: "/admin/api/users/5/adjustments", body: `{"amount":-50,"reason":"ошибка"}`, want: http.StatusCreated, wantCall: "adjust 9 5 -50"},
+		{name: "invalid adjustment", method: http.MethodPost, path: "/admin/api/users/5/adjustments", body: `{"amount":0}`, err: types.ErrAdjustmentInvalid, want: http.StatusUnprocessableEntity, wantCall: "adjust 9 5 0"},
+		{name: "repoll", method: http.MethodPost, path: "/admin/api/orders/79927398713/repoll", want: http.StatusAccepted, wantCall: "repoll 79927398713"},
+		{name: "invalidate", method: http.MethodPost, path: "/admin/api/orders/79927398713/invalidate", want: http.StatusNoContent, wantCall: "invalidate 79927398713"},
+		{name: "invalidate processed order", method: http.MethodPost, path: "/admin/api/orders/79927398713/invalidate", err: types.ErrOrderAlreadyProcessed, want: http.StatusConflict, wantCall: "invalidate 79927398713"},
+		{name: "reverse withdrawal", method: http.MethodPost, path: "/admin/api/withdrawals/79927398713/reverse", body: `{"reason":"ошибка"}`, want: http.StatusOK, wantCall: "reverse 9 79927398713"},
+		{name: "reversal without reason", method: http.MethodPost, path: "/admin/api/withdrawals/79927398713/reverse", body: `{}`, err: types.ErrReversalInvalid, want: http.StatusUnprocessableEntity, wantCall: "reverse 9 79927398713"},
+		{name: "blocked operator", token: "blocked", method: http.MethodPost, path: "/admin/api/users/5/block", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &adminService{fakeService: fakeService{principal: tokenPrincipal}, err: tt.err}
+			token := tt.token
+			if token == "" {
+				token = types.RoleAdmin + ":9"
+			}
+			w := serve(testRouter(t, config.Config{}, svc), tt.method, tt.path, token, "application/json", tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if got := strings.Join(svc.calls, ";"); got != tt.wantCall {
+				t.Errorf("calls = %q, want %q", got, tt.wantCall)
+			}
+		})
+	}
+}
+
+// rbacService Service с пустыми списками заказов, вебхуков и пользователей, запоминающий пользователя запроса.
+type rbacService struct {
+	fakeService
+	userID int
+}
+
+func (s *rbacService) GetOrders(userID int) ([]types.Order, error) {
+	s.userID = userID
+	return nil, nil
+}
+
+func (s *rbacService) GetWebhooks(userID int) ([]types.Webhook, error) {
+	s.userID = userID
+	return nil, nil
+}
+
+func (s *rbacService) SearchUsers(string) ([]types.AdminUser, error) {
+	return nil, nil
+}
+
+func (s *rbacService) SetUserRole(int, string) error {
+	return nil
+}
+
+func TestRoutePermissions(t *testing.T) {
+	const (
+		orders   = "GET /api/user/orders"
+		webhooks = "GET /api/user/webhooks"
+		search   = "GET /admin/api/users"
+		setRole  = "PUT /admin/api/users/5/role"
+	)
+	tests := []struct {
+		token string
+		want  map[string]int
+	}{
+		{"", map[string]int{orders: http.StatusUnauthorized, webhooks: http.StatusUnauthorized, search: http.StatusUnauthorized, setRole: http.StatusUnauthorized}},
+		{"invalid", map[string]int{orders: http.StatusUnauthorized, webhooks: http.StatusUnauthorized, search: http.StatusUnauthorized, setRole: http.StatusUnauthorized}},
+		{"blocked", map[string]int{orders: http.StatusForbidden, webhooks: http.StatusForbidden, search: http.StatusForbidden, setRole: http.StatusForbidden}},
+		{"owner:7", map[string]int{orders: http.StatusForbidden, webhooks: http.StatusForbidden, search: http.StatusForbidden, setRole: http.StatusForbidden}},
+		{types.RoleUser + ":7", map[string]int{orders: http.StatusNoContent, webhooks: http.StatusNoContent, search: http.StatusForbidden, setRole: http.StatusForbidden}},
+		{types.RoleService + ":7", map[string]int{orders: http.StatusNoContent, webhooks: http.StatusForbidden, search: http.StatusForbidden, setRole: http.StatusForbidden}},
+		{types.RoleSupport + ":7", map[string]int{orders: http.StatusNoContent, webhooks: http.StatusNoContent, search: http.StatusNoContent, setRole: http.StatusForbidden}},
+		{types.RoleAdmin + ":7", map[string]int{orders: http.StatusNoContent, webhooks: http.StatusNoContent, search: http.StatusNoContent, setRole: http.StatusNoContent}},
+	}
+	for _, tt := range tests {
+		for route, want := range tt.want {
+			t.Run(tt.token+" "+route, func(t *testing.T) {
+				svc := &rbacService{fakeService: fakeService{principal: tokenPrincipal}}
+				parts := strings.SplitN(route, " ", 2)
+				w := serve(testRouter(t, config.Config{}, svc), parts[0], parts[1], tt.token, "application/json", `{"role":"support"}`)
+				if w.Code != want {
+					t.Errorf("status = %d, want %d", w.Code, want)
+				}
+				// пользовательские маршруты работают от имени пользователя из токена
+				if w.Code == http.StatusNoContent && strings.HasPrefix(parts[1], "/api/user/") && svc.userID != 7 {
+					t.Errorf("handler got user %d, want the principal's user 7", svc.userID)
+				}
+			})
+		}
+	}
+}
+
+// withdrawalService Service со списаниями пользователя 1: 79927398713 ожидает подтверждения,
+// 12345678903 сторнировано.
+type withdrawalService struct {
+	fakeService
+}
+
+func (s *withdrawalService) GetWithdrawals(userID int) ([]types.Withdraw, error) {
+	if userID != 1 {
+		return nil, nil
+	}
+	return []types.Withdraw{
+		{OrderNumber: "79927398713", Sum: 100, Status: types.WithdrawalPending},
+		{OrderNumber: "12345678903", Sum: 50, Status: types.WithdrawalReversed,
+			Reversal: &types.WithdrawalReversal{AdjustmentID: 3, Reason: "ошибка", OperatorID: 9}},
+	}, nil
+}
+
+func (s *withdrawalService) CancelWithdrawal(userID int, orderNumber string) (*types.Withdraw, error) {
+	switch {
+	case userID != 1:
+		return nil, types.ErrWithdrawalNotFound
+	case orderNumber == "79927398713":
+		return &types.Withdraw{OrderNumber: orderNumber, Sum: 100, Status: types.WithdrawalCancelled}, nil
+	case orderNumber == "12345678903":
+		return nil, types.ErrWithdrawalNotCancellable
+	}
+	return nil, types.ErrWithdrawalNotFound
+}
+
+func TestCancelWithdrawal(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		number string
+		want   int
+	}{
+		{"pending", "user:1", "79927398713", http.StatusOK},
+		{"not cancellable", "user:1", "12345678903", http.StatusConflict},
+		{"unknown withdrawal", "user:1", "2377225624", http.StatusNotFound},
+		{"withdrawal of another user", "user:2", "79927398713", http.StatusNotFound},
+		{"service account", "service:1", "79927398713", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testRouter(t, config.Config{}, &withdrawalService{fakeService{principal: tokenPrincipal}})
+			w := serve(h, http.MethodPost, "/api/user/withdrawals/"+tt.number+"/cancel", tt.token, "", "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var wthd types.Withdraw
+			if err := json.NewDecoder(w.Body).Decode(&wthd); err != nil {
+				t.Fatal(err)
+			}
+			if wthd.Status != types.WithdrawalCancelled {
+				t.Errorf("status = %s, want %s", wthd.Status, types.WithdrawalCancelled)
+			}
+		})
+	}
+}
+
+func TestGetWithdrawalsStatus(t *testing.T) {
+	h := testRouter(t, config.Config{}, &withdrawalService{fakeService{principal: tokenPrincipal}})
+	w := serve(h, http.MethodGet, "/api/user/withdrawals", "user:1", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var res []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0]["status"] != types.WithdrawalPending || res[1]["status"] != types.WithdrawalReversed {
+		t.Fatalf("withdrawals = %v, want statuses %s and %s", res, types.WithdrawalPending, types.WithdrawalReversed)
+	}
+	if _, ok := res[0]["reversal"]; ok {
+		t.Errorf("pending withdrawal has reversal info: %v", res[0])
+	}
+	if rev, ok := res[1]["reversal"].(map[string]interface{}); !ok || rev["reason"] != "ошибка" {
+		t.Errorf("reversed withdrawal = %v, want reversal info", res[1])
+	}
+	if w := serve(h, http.MethodGet, "/api/user/withdrawals", "user:2", "", ""); w.Code != http.StatusNoContent {
+		t.Errorf("status without withdrawals = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
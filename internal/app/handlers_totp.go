@@ -0,0 +1,91 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// EnrollTwoFactor Handler подключение двухфакторной аутентификации: выдача секрета и адреса otpauth://.
+func (a *application) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	res, err := a.svc.EnrollTwoFactor(userID)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// ConfirmTwoFactor Handler подтверждение подключения двухфакторной аутентификации и выдача резервных кодов.
+func (a *application) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	var req types.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	codes, err := a.svc.ConfirmTwoFactor(userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor Handler отключение двухфакторной аутентификации.
+func (a *application) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	var req types.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.svc.DisableTwoFactor(userID, req.Code); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TwoFactorLogin Handler завершение входа одноразовым или резервным кодом и выдача токена авторизации.
+func (a *application) TwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var req types.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := a.svc.CompleteTwoFactorLogin(req.Challenge, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", res.Token))
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// writeTwoFactorError метод-helper отправки ответа с кодом, соответствующим ошибке двухфакторной аутентификации.
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, types.ErrTwoFactorDisabled):
+		status = http.StatusNotFound
+	case errors.Is(err, types.ErrTwoFactorEnabled):
+		status = http.StatusConflict
+	case errors.Is(err, types.ErrTwoFactorNotEnrolled):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, types.ErrTwoFactorCodeInvalid), errors.Is(err, types.ErrChallengeInvalid):
+		status = http.StatusUnauthorized
+	}
+	http.Error(w, err.Error(), status)
+}
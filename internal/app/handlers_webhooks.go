@@ -0,0 +1,112 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// RegisterWebhook Handler регистрация нового вебхука пользователя.
+func (a *application) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	var req types.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wh, err := a.svc.RegisterWebhook(userID, &req)
+	if err != nil {
+		if errors.Is(err, types.ErrWebhookURLInvalid) || errors.Is(err, types.ErrWebhookEventUnknown) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(wh); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetWebhooks Handler получение списка вебхуков пользователя.
+func (a *application) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	webhooks, err := a.svc.GetWebhooks(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(webhooks) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(webhooks); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteWebhook Handler удаление вебхука пользователя.
+func (a *application) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.svc.DeleteWebhook(userID, webhookID); err != nil {
+		if errors.Is(err, types.ErrWebhookNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries Handler получение журнала доставок вебхука.
+func (a *application) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID := principal(r).UserID
+
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	deliveries, err := a.svc.GetWebhookDeliveries(userID, webhookID)
+	if err != nil {
+		if errors.Is(err, types.ErrWebhookNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if len(deliveries) == 0 {
+		http.Error(w, errors.New("the list is empty").Error(), http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
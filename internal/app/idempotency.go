@@ -0,0 +1,134 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/service"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const (
+	// IdempotencyKeyHeader заголовок ключа идемпотентности запроса.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader заголовок, которым отмечается повторно отправленный сохраненный ответ.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyKeyMaxLen = 255
+)
+
+// idempotentRoutes маршруты, поддерживающие заголовок Idempotency-Key.
+var idempotentRoutes = map[string]bool{
+	http.MethodPost + " /api/user/orders":           true,
+	http.MethodPost + " /api/user/orders/batch":     true,
+	http.MethodPost + " /api/user/balance/withdraw": true,
+	http.MethodPost + " /api/user/balance/transfer": true,
+}
+
+// responseRecorder запоминает код и тело ответа, передавая их клиенту.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware middleware метод повторной отправки сохраненного ответа на запрос с тем же Idempotency-Key.
+// Ключ действует в пределах пользователя; повторное использование ключа с другим запросом отклоняется с кодом 422.
+// Ответы с ошибкой сервера не сохраняются, и запрос с тем же ключом выполняется заново. Если не удалось сохранить
+// другой ответ, ключ остается занятым и повтор получает 409, а не выполняется второй раз. Применяется после AuthMiddleware.
+func IdempotencyMiddleware(svc service.Service) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > idempotencyKeyMaxLen {
+				http.Error(w, types.ErrIdempotencyKeyInvalid.Error(), http.StatusBadRequest)
+				return
+			}
+			userID := principal(r).UserID
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			h := sha256.New()
+			_, _ = io.WriteString(h, r.Method+" "+r.URL.Path+"\n"+r.Header.Get("Content-Type")+"\n")
+			h.Write(body)
+
+			saved, err := svc.BeginIdempotentRequest(userID, key, hex.EncodeToString(h.Sum(nil)))
+			if err != nil {
+				status := http.StatusInternalServerError
+				switch {
+				case errors.Is(err, types.ErrIdempotencyKeyMismatch):
+					status = http.StatusUnprocessableEntity
+				case errors.Is(err, types.ErrIdempotencyKeyInProgress):
+					status = http.StatusConflict
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			if saved != nil {
+				if saved.ContentType != "" {
+					w.Header().Set("Content-Type", saved.ContentType)
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(saved.Status)
+				_, _ = w.Write(saved.Body)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w}
+			release := true
+			defer func() {
+				if release {
+					if err := svc.ReleaseIdempotencyKey(userID, key); err != nil {
+						log.Printf("release idempotency key: %v", err)
+					}
+				}
+			}()
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+			// обработчик мог уже выполнить списание или перевод, поэтому ключ не освобождается
+			release = false
+			err = svc.CompleteIdempotentRequest(userID, key, &types.IdempotentResponse{
+				Status:      rec.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			})
+			if err != nil {
+				log.Printf("save idempotent response: %v", err)
+			}
+		})
+	}
+}
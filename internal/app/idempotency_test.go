@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// idempotencyEntry сохраненный в memIdempotency запрос.
+type idempotencyEntry struct {
+	hash string
+	resp *types.IdempotentResponse
+}
+
+// memIdempotency хранилище ключей идемпотентности в памяти с той же семантикой, что у DAO.
+type memIdempotency struct {
+	fakeService
+	mu          sync.Mutex
+	keys        map[string]*idempotencyEntry
+	completeErr error
+}
+
+func (s *memIdempotency) id(userID int, key string) string {
+	return fmt.Sprintf("%d|%s", userID, key)
+}
+
+func (s *memIdempotency) BeginIdempotentRequest(userID int, key, requestHash string) (*types.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.keys[s.id(userID, key)]
+	if !ok {
+		s.keys[s.id(userID, key)] = &idempotencyEntry{hash: requestHash}
+		return nil, nil
+	}
+	if e.hash != requestHash {
+		return nil, types.ErrIdempotencyKeyMismatch
+	}
+	if e.resp == nil {
+		return nil, types.ErrIdempotencyKeyInProgress
+	}
+	return e.resp, nil
+}
+
+func (s *memIdempotency) CompleteIdempotentRequest(userID int, key string, resp *types.IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	s.keys[s.id(userID, key)].resp = resp
+	return nil
+}
+
+func (s *memIdempotency) ReleaseIdempotencyKey(userID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.keys[s.id(userID, key)]; e != nil && e.resp == nil {
+		delete(s.keys, s.id(userID, key))
+	}
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	svc := &memIdempotency{keys: make(map[string]*idempotencyEntry)}
+	calls := 0
+	status := http.StatusOK
+	var inHandler func()
+	h := IdempotencyMiddleware(svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if inHandler != nil {
+			inHandler()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	}))
+	do := func(userID int, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), types.PrincipalKey, &types.Principal{UserID: userID}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	const body = `{"order":"2377225624","sum":751}`
+
+	first := do(1, "k1", body)
+	if first.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("first request: status %d, calls %d", first.Code, calls)
+	}
+	replay := do(1, "k1", body)
+	if calls != 1 {
+		t.Errorf("replay executed the handler again")
+	}
+	if replay.Code != first.Code || replay.Body.String() != first.Body.String() ||
+		replay.Header().Get(IdempotentReplayedHeader) != "true" ||
+		replay.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replay = %d %q %v, want the saved response", replay.Code, replay.Body.String(), replay.Header())
+	}
+	if w := do(1, "k1", `{"order":"2377225624","sum":752}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key with another body: status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if w := do(2, "k1", body); w.Code != http.StatusOK || calls != 2 {
+		t.Errorf("same key of another user: status %d, calls %d", w.Code, calls)
+	}
+	if w := do(1, "", body); w.Code != http.StatusOK || calls != 3 {
+		t.Errorf("request without key: status %d, calls %d", w.Code, calls)
+	}
+	if w := do(1, strings.Repeat("k", idempotencyKeyMaxLen+1), body); w.Code != http.StatusBadRequest {
+		t.Errorf("too long key: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	t.Run("in progress", func(t *testing.T) {
+		var nested *httptest.ResponseRecorder
+		inHandler = func() {
+			inHandler = nil
+			nested = do(1, "k2", body)
+		}
+		do(1, "k2", body)
+		if nested == nil || nested.Code != http.StatusConflict {
+			t.Errorf("concurrent request with the same key: %v, want %d", nested, http.StatusConflict)
+		}
+	})
+
+	t.Run("server error is not saved", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		before := calls
+		if w := do(1, "k3", body); w.Code != http.StatusInternalServerError {
+			t.Fatalf("status %d", w.Code)
+		}
+		status = http.StatusOK
+		if w := do(1, "k3", body); w.Code != http.StatusOK || calls != before+2 {
+			t.Errorf("retry after server error: status %d, calls %d, want the handler to run again", w.Code, calls-before)
+		}
+	})
+	t.Run("unsaved response is not executed again", func(t *testing.T) {
+		svc.completeErr = errors.New("connection reset")
+		before := calls
+		if w := do(1, "k4", body); w.Code != http.StatusOK {
+			t.Fatalf("status %d", w.Code)
+		}
+		svc.completeErr = nil
+		if w := do(1, "k4", body); w.Code != http.StatusConflict || calls != before+1 {
+			t.Errorf("retry after failed save: status %d, calls %d, want %d without running the handler",
+				w.Code, calls-before, http.StatusConflict)
+		}
+	})
+}
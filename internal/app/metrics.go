@@ -0,0 +1,37 @@
+package app
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// publishedMetrics переменные expvar, доступные на адресе метрик. Стандартные cmdline и memstats
+// не публикуются: аргументы командной строки содержат строку подключения к БД.
+var publishedMetrics = []string{"accrual"}
+
+// RunMetrics метод запуска сервера метрик на отдельном внутреннем адресе cfg.MetricsAddress.
+func (a *application) RunMetrics() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vars", metricsHandler)
+	return http.ListenAndServe(a.cfg.MetricsAddress, mux)
+}
+
+// metricsHandler Handler отправки метрик из publishedMetrics в формате expvar.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprint(w, "{")
+	first := true
+	for _, name := range publishedMetrics {
+		v := expvar.Get(name)
+		if v == nil {
+			continue
+		}
+		if !first {
+			fmt.Fprint(w, ",")
+		}
+		first = false
+		fmt.Fprintf(w, "\n%q: %s", name, v.String())
+	}
+	fmt.Fprint(w, "\n}\n")
+}
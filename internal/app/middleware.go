@@ -16,10 +16,8 @@ import (
 
 const authorizationScheme = "Bearer"
 
-var noAuth = map[string]interface{}{
-	"/api/user/register": nil,
-	"/api/user/login":    nil,
-}
+// APIKeyHeader заголовок аутентификации по API-ключу.
+const APIKeyHeader = "X-API-Key"
 
 type gzipWriter struct {
 	http.ResponseWriter
@@ -30,6 +28,16 @@ func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
+// Flush сбрасывает сжатые данные клиенту, необходим для потоковых ответов.
+func (w gzipWriter) Flush() {
+	if gz, ok := w.Writer.(*gzip.Writer); ok {
+		_ = gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // GzipMiddleware middleware метод обрабатывающий сжатие gzip.
 func GzipMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -72,31 +80,48 @@ func GzipMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// AuthMiddleware middleware метода аутентификации/авторизации пользователя.
-func AuthMiddleware(svc service.Service) func(handler http.Handler) http.Handler {
+// AuthMiddleware middleware метода аутентификации/авторизации пользователя по токену или API-ключу.
+// Сохраняет в контексте запроса types.Principal и отвечает 403, если у него нет разрешения perm.
+func AuthMiddleware(svc service.Service, perm string) func(handler http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if _, ok := noAuth[r.RequestURI]; ok {
-				next.ServeHTTP(w, r)
-				return
+			var p *types.Principal
+			var err error
+			if key := r.Header.Get(APIKeyHeader); key != "" {
+				p, err = svc.GetPrincipalByAPIKey(key)
+			} else {
+				var token string
+				token, err = getTokenFromAuthHeader(r.Header.Get("Authorization"))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				p, err = svc.GetPrincipal(token)
 			}
-			token, err := getTokenFromAuthHeader(r.Header.Get("Authorization"))
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				status := http.StatusUnauthorized
+				if errors.Is(err, types.ErrUserBlocked) {
+					status = http.StatusForbidden
+				}
+				http.Error(w, err.Error(), status)
 				return
 			}
-			id, err := svc.GetUserIDByToken(token)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+			if !p.Can(perm) {
+				http.Error(w, types.ErrForbidden.Error(), http.StatusForbidden)
 				return
 			}
-			ctx := context.WithValue(r.Context(), types.UserID, id)
+			ctx := context.WithValue(r.Context(), types.PrincipalKey, p)
 			req := r.WithContext(ctx)
 			next.ServeHTTP(w, req)
 		})
 	}
 }
 
+// principal метод-helper получения аутентифицированного субъекта запроса.
+func principal(r *http.Request) *types.Principal {
+	return r.Context().Value(types.PrincipalKey).(*types.Principal)
+}
+
 // Метод-helper AuthMiddleware получения токена из заголовка запроса.
 func getTokenFromAuthHeader(headerVal string) (string, error) {
 	var token string
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/service"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// fakeService Service с подменяемыми методами; вызов остальных методов приводит к панике.
+type fakeService struct {
+	service.Service
+	principalByAPIKey func(key string) (*types.Principal, error)
+	principal         func(token string) (*types.Principal, error)
+}
+
+func (s *fakeService) GetPrincipalByAPIKey(key string) (*types.Principal, error) {
+	return s.principalByAPIKey(key)
+}
+
+func (s *fakeService) GetPrincipal(token string) (*types.Principal, error) {
+	return s.principal(token)
+}
+
+func (s *fakeService) Ping() error {
+	return nil
+}
+
+func TestAuthMiddlewareAPIKey(t *testing.T) {
+	svc := &fakeService{
+		principalByAPIKey: func(key string) (*types.Principal, error) {
+			if key != "gm_valid" {
+				return nil, types.ErrAPIKeyInvalid
+			}
+			return &types.Principal{UserID: 1, Role: types.RoleUser, APIKeyID: 7,
+				Scopes: []string{types.PermOrdersRead, types.PermBalanceWrite}}, nil
+		},
+	}
+	tests := []struct {
+		name string
+		key  string
+		perm string
+		want int
+	}{
+		{"scope granted", "gm_valid", types.PermOrdersRead, http.StatusOK},
+		{"scope missing", "gm_valid", types.PermWebhooks, http.StatusForbidden},
+		{"transfer is never granted to keys", "gm_valid", types.PermTransfer, http.StatusForbidden},
+		{"unknown key", "gm_other", types.PermOrdersRead, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := AuthMiddleware(svc, tt.perm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if p := principal(r); p.APIKeyID != 7 {
+					t.Errorf("principal = %+v, want API key 7", p)
+				}
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			r.Header.Set(APIKeyHeader, tt.key)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
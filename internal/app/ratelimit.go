@@ -0,0 +1,330 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// RateLimitStore хранилище корзин маркеров, общее для всех реплик приложения.
+// TakeToken пополняет корзину key со скоростью perSecond до burst маркеров и забирает из нее маркер,
+// если он есть. Возвращает число маркеров, оставшихся в корзине, и признак того, что маркер был получен.
+// ReturnToken возвращает в корзину key маркер, полученный для запроса, который был отклонен другой корзиной.
+type RateLimitStore interface {
+	TakeToken(key string, perSecond, burst float64) (float64, bool, error)
+	ReturnToken(key string, burst float64) error
+}
+
+// rateLimitExempt маршруты, к которым ограничение частоты запросов не применяется.
+var rateLimitExempt = map[string]bool{
+	"/health/ready":              true,
+	"/internal/accrual/callback": true,
+}
+
+// quota ограничение limit запросов за period.
+type quota struct {
+	limit  int
+	period time.Duration
+}
+
+func (q quota) perSecond() float64 {
+	return float64(q.limit) / q.period.Seconds()
+}
+
+// parseQuota метод-helper разбора ограничения в формате "60/m"; период задается единицей s, m или h.
+// Пустая строка и "0" означают отсутствие ограничения.
+func parseQuota(s string) (*quota, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return nil, nil
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid rate limit %q", s)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid rate limit %q", s)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("invalid rate limit period %q", s)
+	}
+	return &quota{limit: limit, period: period}, nil
+}
+
+// rateLimiter ограничение частоты запросов алгоритмом корзины маркеров.
+// Каждый запрос расходует маркер из общей корзины субъекта и, если для маршрута задана квота, из корзины маршрута;
+// если запрос отклонен одной из корзин, маркер возвращается в остальные.
+// Субъект запроса - API-ключ, пользователь либо, для запросов без аутентификации, IP-адрес клиента.
+// Кроме того, до аутентификации каждый запрос расходует маркер из корзины IP-адреса клиента.
+type rateLimiter struct {
+	global *quota
+	apiKey *quota
+	ip     *quota
+	routes map[string]*quota
+
+	mu    sync.RWMutex
+	store RateLimitStore
+}
+
+// newRateLimiter метод-конструктор rateLimiter по настройкам приложения, корзины по умолчанию хранятся в памяти.
+// Квоты маршрутов задаются в cfg.RateLimitRoutes в формате "POST /api/user/orders=60/m".
+func newRateLimiter(cfg config.Config) (*rateLimiter, error) {
+	global, err := parseQuota(cfg.RateLimitDefault)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := parseQuota(cfg.RateLimitIP)
+	if err != nil {
+		return nil, err
+	}
+	l := &rateLimiter{
+		global: global,
+		ip:     ip,
+		routes: make(map[string]*quota),
+		store:  newMemoryRateLimitStore(),
+	}
+	if cfg.APIKeyRateLimit > 0 {
+		l.apiKey = &quota{limit: cfg.APIKeyRateLimit, period: time.Minute}
+	}
+	for _, rule := range cfg.RateLimitRoutes {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || len(strings.Fields(parts[0])) != 2 {
+			return nil, fmt.Errorf("invalid route rate limit %q", rule)
+		}
+		q, err := parseQuota(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		l.routes[strings.Join(strings.Fields(parts[0]), " ")] = q
+	}
+	return l, nil
+}
+
+func (l *rateLimiter) setStore(store RateLimitStore) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.store = store
+}
+
+// bucketState состояние корзины key после запроса.
+type bucketState struct {
+	key     string
+	quota   *quota
+	tokens  float64
+	allowed bool
+}
+
+func (l *rateLimiter) take(key string, q *quota) bucketState {
+	l.mu.RLock()
+	store := l.store
+	l.mu.RUnlock()
+
+	tokens, ok, err := store.TakeToken(key, q.perSecond(), float64(q.limit))
+	if err != nil {
+		// недоступность хранилища не должна останавливать обслуживание запросов
+		log.Printf("rate limit store: %v", err)
+		return bucketState{key: key, quota: q, tokens: float64(q.limit), allowed: true}
+	}
+	return bucketState{key: key, quota: q, tokens: tokens, allowed: ok}
+}
+
+// refund метод возврата маркеров, полученных из корзин states, если запрос отклонен какой-либо из корзин,
+// чтобы отклоненные запросы к одному маршруту не расходовали общую квоту субъекта.
+func (l *rateLimiter) refund(states []bucketState) {
+	rejected := false
+	for _, st := range states {
+		rejected = rejected || !st.allowed
+	}
+	if !rejected {
+		return
+	}
+	l.mu.RLock()
+	store := l.store
+	l.mu.RUnlock()
+
+	for i, st := range states {
+		if !st.allowed {
+			continue
+		}
+		if err := store.ReturnToken(st.key, float64(st.quota.limit)); err != nil {
+			log.Printf("rate limit store: %v", err)
+			continue
+		}
+		states[i].tokens = math.Min(float64(st.quota.limit), st.tokens+1)
+	}
+}
+
+// middleware метод ограничения частоты запросов к маршруту rt.
+// Для маршрутов с аутентификацией применяется после AuthMiddleware, чтобы учитывать запросы по субъекту.
+func (l *rateLimiter) middleware(rt route) func(http.Handler) http.Handler {
+	routeKey := rt.method + " " + rt.path
+	routeQuota := l.routes[routeKey]
+	return func(next http.Handler) http.Handler {
+		if rateLimitExempt[rt.path] {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject, q := l.subject(r)
+			var states []bucketState
+			if q != nil {
+				states = append(states, l.take("*|"+subject, q))
+			}
+			if routeQuota != nil {
+				states = append(states, l.take(routeKey+"|"+subject, routeQuota))
+			}
+			l.refund(states)
+			if admit(w, states) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// ipMiddleware метод ограничения частоты запросов к маршруту rt по IP-адресу клиента.
+// Применяется до AuthMiddleware, чтобы запросы с неверными токенами тоже ограничивались
+// и не нагружали БД проверкой токенов.
+func (l *rateLimiter) ipMiddleware(rt route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l.ip == nil || rateLimitExempt[rt.path] {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if admit(w, []bucketState{l.take("ip|"+clientIP(r), l.ip)}) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// admit метод-helper выбора самой исчерпанной из корзин states и отправки ее состояния в заголовках.
+// Если маркер в какой-то из корзин не получен, отвечает 429 и возвращает false.
+func admit(w http.ResponseWriter, states []bucketState) bool {
+	if len(states) == 0 {
+		return true
+	}
+	tightest := states[0]
+	for _, st := range states[1:] {
+		if !st.allowed || (tightest.allowed && st.tokens < tightest.tokens) {
+			tightest = st
+		}
+	}
+	writeRateLimitHeaders(w, tightest)
+	if !tightest.allowed {
+		retry := (1 - tightest.tokens) / tightest.quota.perSecond()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry))))
+		http.Error(w, types.ErrTooManyRequests.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// subject метод определения субъекта запроса и его общей квоты.
+func (l *rateLimiter) subject(r *http.Request) (string, *quota) {
+	if p, ok := r.Context().Value(types.PrincipalKey).(*types.Principal); ok {
+		if p.APIKeyID != 0 {
+			return fmt.Sprintf("key:%d", p.APIKeyID), l.apiKey
+		}
+		return fmt.Sprintf("user:%d", p.UserID), l.global
+	}
+	return "ip:" + clientIP(r), l.global
+}
+
+// clientIP метод-helper получения IP-адреса клиента.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeRateLimitHeaders метод-helper отправки заголовков RateLimit-* о состоянии корзины.
+func writeRateLimitHeaders(w http.ResponseWriter, st bucketState) {
+	q := st.quota
+	remaining := math.Max(0, math.Floor(st.tokens))
+	reset := (float64(q.limit) - st.tokens) / q.perSecond()
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", q.limit, int(q.period.Seconds())))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(q.limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset))))
+}
+
+// memoryRateLimitStore хранилище корзин маркеров в памяти процесса.
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens    float64
+	burst     float64
+	perSecond float64
+	updatedAt time.Time
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		buckets:   make(map[string]*memoryBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// TakeToken метод получения маркера из корзины key.
+func (s *memoryRateLimitStore) TakeToken(key string, perSecond, burst float64) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: burst, updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.burst, b.perSecond = burst, perSecond
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*perSecond)
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+// ReturnToken метод возврата маркера в корзину key.
+func (s *memoryRateLimitStore) ReturnToken(key string, burst float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.tokens = math.Min(burst, b.tokens+1)
+	}
+	return nil
+}
+
+// sweep метод удаления полностью пополнившихся корзин, не более одного раза в минуту.
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*b.perSecond >= b.burst {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *quota
+		wantErr bool
+	}{
+		{"60/m", &quota{limit: 60, period: time.Minute}, false},
+		{" 5/s ", &quota{limit: 5, period: time.Second}, false},
+		{"1000/h", &quota{limit: 1000, period: time.Hour}, false},
+		{"", nil, false},
+		{"0", nil, false},
+		{"60", nil, true},
+		{"60/d", nil, true},
+		{"-1/m", nil, true},
+		{"0/m", nil, true},
+		{"x/m", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseQuota(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseQuota(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseQuota(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPMiddlewareBeforeAuth(t *testing.T) {
+	l, err := newRateLimiter(config.Config{RateLimitIP: "2/m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookups := 0
+	// auth имитирует AuthMiddleware, отклоняющий неверный токен после обращения к хранилищу токенов
+	auth := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	h := l.ipMiddleware(route{method: http.MethodGet, path: "/api/user/orders"})(auth)
+
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+		r.RemoteAddr = "203.0.113.7:5000"
+		r.Header.Set("Authorization", "Bearer wrong")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("codes = %v, want %v", codes, want)
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("token lookups = %d, want 2", lookups)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+	r.RemoteAddr = "198.51.100.1:5000"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("another client got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRouteQuotaKeepsGlobalTokens(t *testing.T) {
+	l, err := newRateLimiter(config.Config{
+		RateLimitDefault: "3/m",
+		RateLimitRoutes:  []string{"POST /api/user/orders=1/m"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	upload := l.middleware(route{method: http.MethodPost, path: "/api/user/orders"})(ok)
+	list := l.middleware(route{method: http.MethodGet, path: "/api/user/orders"})(ok)
+	do := func(h http.Handler, method string) int {
+		r := httptest.NewRequest(method, "/api/user/orders", nil)
+		r = r.WithContext(context.WithValue(r.Context(), types.PrincipalKey, &types.Principal{UserID: 1}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	steps := []struct {
+		name   string
+		h      http.Handler
+		method string
+		want   int
+	}{
+		{"upload", upload, http.MethodPost, http.StatusOK},
+		{"upload over route quota", upload, http.MethodPost, http.StatusTooManyRequests},
+		{"upload over route quota again", upload, http.MethodPost, http.StatusTooManyRequests},
+		{"upload over route quota once more", upload, http.MethodPost, http.StatusTooManyRequests},
+		// отклоненные загрузки не расходуют общую квоту: остаются два маркера из трех
+		{"list", list, http.MethodGet, http.StatusOK},
+		{"list again", list, http.MethodGet, http.StatusOK},
+		{"list over global quota", list, http.MethodGet, http.StatusTooManyRequests},
+	}
+	for _, st := range steps {
+		if got := do(st.h, st.method); got != st.want {
+			t.Fatalf("%s: status = %d, want %d", st.name, got, st.want)
+		}
+	}
+}
@@ -2,130 +2,328 @@ package client
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
+	"expvar"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
 	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/events"
 	"github.com/lipandr/yandex-practicum-diploma/internal/types"
-
-	"golang.org/x/time/rate"
 )
 
-const tooManyRequestTemplate = "No more than %d requests per minute allowed"
-
 // AccrualProcessor интерфейс взаимодействия с системой начислений.
 type AccrualProcessor interface {
 	GetOrderStatus(orderID string) *types.AccrualOrderState
+	Push(state *types.AccrualOrderState) error
+	Ready() error
 	Run()
 }
 
+// PoolOptions настройки пула обработчиков заказов.
+type PoolOptions struct {
+	// MinWorkers и MaxWorkers границы размера пула при подстройке под количество необработанных заказов.
+	MinWorkers int
+	MaxWorkers int
+	// BatchSize количество заказов, выбираемых из БД за один раз.
+	BatchSize int
+	// PollInterval пауза между опросами БД при отсутствии заказов.
+	PollInterval time.Duration
+	// ThrottleCooldown время после ответа 429, в течение которого пул не увеличивается.
+	ThrottleCooldown time.Duration
+	// CallbackDeadline время ожидания уведомления от системы начислений, после которого заказ опрашивается.
+	// Нулевое значение означает, что уведомления не используются и заказы опрашиваются сразу.
+	CallbackDeadline time.Duration
+	// Lots правила для партий баллов, начисленных по обработанным заказам.
+	Lots types.LotPolicy
+}
+
+// NewPoolOptions метод получения настроек пула обработчиков из конфигурации.
+// Ожидание уведомлений включается только при заданном секрете уведомлений.
+func NewPoolOptions(cfg config.Config) PoolOptions {
+	opts := PoolOptions{
+		MinWorkers:       cfg.AccrualWorkers,
+		MaxWorkers:       cfg.AccrualMaxWorkers,
+		BatchSize:        cfg.AccrualBatchSize,
+		PollInterval:     cfg.AccrualPollInterval,
+		ThrottleCooldown: cfg.AccrualThrottleCooldown,
+		Lots: types.LotPolicy{
+			ExpiryMonths: cfg.PointsExpiryMonths,
+			HoldPeriod:   cfg.AccrualHoldPeriod,
+		},
+	}
+	if cfg.AccrualCallbackSecret != "" {
+		opts.CallbackDeadline = cfg.AccrualCallbackDeadline
+	}
+	return opts
+}
+
+// accrualProcessor конвейер обработки заказов: producer выбирает заказы из БД в ограниченную очередь,
+// пул обработчиков опрашивает систему начислений, а единственный writer сохраняет результаты.
+// Заказ, уже находящийся в конвейере, повторно в очередь не ставится.
 type accrualProcessor struct {
-	address   string
-	rateLimit int
-	poolSize  int
-	limiter   *rate.Limiter
-	dao       *dao.DAO
+	source AccrualSource
+	opts   PoolOptions
+	dao    *dao.DAO
+	hub    events.Hub
+
+	mu          sync.Mutex
+	workers     []context.CancelFunc
+	throttledAt time.Time
+	backlog     expvar.Int
+
+	inflightMu sync.Mutex
+	inflight   map[string]struct{}
+
+	queue   chan string
+	results chan accrualResult
+}
 
-	OrderQueue chan string
+// accrualResult результат опроса системы начислений по заказу, state равен nil при неудаче.
+type accrualResult struct {
+	orderID string
+	state   *types.AccrualOrderState
 }
 
 // NewAccrualProcessor метод-конструктор взаимодействия с сервисом расчета начислений.
-func NewAccrualProcessor(dao *dao.DAO, addr string, poolSize int) AccrualProcessor {
-	ap := &accrualProcessor{
-		dao:        dao,
-		address:    addr,
-		poolSize:   poolSize,
-		OrderQueue: make(chan string, poolSize),
+func NewAccrualProcessor(dao *dao.DAO, hub events.Hub, source AccrualSource, opts PoolOptions) AccrualProcessor {
+	if opts.MinWorkers < 1 {
+		opts.MinWorkers = 1
+	}
+	if opts.MaxWorkers < opts.MinWorkers {
+		opts.MaxWorkers = opts.MinWorkers
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
 	}
-	for i := 0; i < poolSize; i++ {
-		go ap.queueWorker()
+	ap := &accrualProcessor{
+		dao:      dao,
+		hub:      hub,
+		source:   source,
+		opts:     opts,
+		inflight: make(map[string]struct{}),
+		queue:    make(chan string, opts.BatchSize),
+		results:  make(chan accrualResult, opts.BatchSize),
 	}
+	ap.setWorkers(opts.MinWorkers)
+
+	metrics.Set("workers", expvar.Func(func() interface{} {
+		ap.mu.Lock()
+		defer ap.mu.Unlock()
+		return len(ap.workers)
+	}))
+	metrics.Set("backlog", &ap.backlog)
 	return ap
 }
 
-var wg sync.WaitGroup
-
+// Run метод запуска producer и writer конвейера.
 func (a *accrualProcessor) Run() {
-	go func() {
-		for {
-			orderList, err := a.dao.GetOrdersForProcessing(types.WorkersPoolSize)
-			if err != nil || len(orderList) == 0 {
-				time.Sleep(5 * time.Second)
-				continue
+	go a.produce()
+	go a.writeResults()
+}
+
+// produce метод выборки заказов для обработки. Отправка в заполненную очередь блокируется,
+// поэтому producer не опережает обработчиков больше чем на размер очереди.
+func (a *accrualProcessor) produce() {
+	for {
+		backlog, err := a.dao.CountOrdersForProcessing()
+		if err != nil {
+			log.Println(err)
+		} else {
+			a.backlog.Set(int64(backlog))
+			a.resize(backlog)
+		}
+		// выбираем с запасом на заказы, которые уже в конвейере
+		orderList, err := a.dao.GetOrdersForProcessing(
+			a.opts.BatchSize+a.inflightCount(), a.opts.PollInterval, a.opts.CallbackDeadline)
+		if err != nil {
+			log.Println(err)
+		}
+		var queued int
+		for _, orderID := range orderList {
+			if queued == a.opts.BatchSize {
+				break
 			}
-			wg.Add(len(orderList))
-			for _, orderID := range orderList {
-				a.OrderQueue <- orderID
+			if !a.acquire(orderID) {
+				continue
 			}
-			wg.Wait()
+			a.queue <- orderID
+			queued++
+		}
+		if queued == 0 {
+			time.Sleep(a.opts.PollInterval)
 		}
-	}()
+	}
+}
+
+// writeResults метод сохранения результатов опроса и освобождения заказов из конвейера.
+func (a *accrualProcessor) writeResults() {
+	for res := range a.results {
+		a.save(res)
+		a.release(res.orderID)
+	}
+}
+
+// acquire метод постановки заказа в конвейер, возвращает false, если заказ уже обрабатывается.
+func (a *accrualProcessor) acquire(orderID string) bool {
+	a.inflightMu.Lock()
+	defer a.inflightMu.Unlock()
+
+	if _, ok := a.inflight[orderID]; ok {
+		return false
+	}
+	a.inflight[orderID] = struct{}{}
+	return true
+}
+
+func (a *accrualProcessor) release(orderID string) {
+	a.inflightMu.Lock()
+	defer a.inflightMu.Unlock()
+
+	delete(a.inflight, orderID)
+}
+
+func (a *accrualProcessor) inflightCount() int {
+	a.inflightMu.Lock()
+	defer a.inflightMu.Unlock()
+
+	return len(a.inflight)
+}
+
+// resize метод подстройки размера пула под количество необработанных заказов.
+// После ответа 429 пул не увеличивается в течение ThrottleCooldown.
+func (a *accrualProcessor) resize(backlog int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	target := backlog
+	if target > a.opts.MaxWorkers {
+		target = a.opts.MaxWorkers
+	}
+	if target < a.opts.MinWorkers {
+		target = a.opts.MinWorkers
+	}
+	if target > len(a.workers) && time.Since(a.throttledAt) < a.opts.ThrottleCooldown {
+		return
+	}
+	a.setWorkers(target)
+}
+
+// throttle метод уменьшения пула вдвое в ответ на 429 от системы начислений.
+// Повторные 429 в течение ThrottleCooldown пул не уменьшают, так как приходят от уже отправленных запросов.
+func (a *accrualProcessor) throttle() {
+	metrics.Add("throttled", 1)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if time.Since(a.throttledAt) < a.opts.ThrottleCooldown {
+		return
+	}
+	a.throttledAt = time.Now()
+	target := len(a.workers) / 2
+	if target < 1 {
+		target = 1
+	}
+	a.setWorkers(target)
+}
+
+// setWorkers метод запуска или остановки обработчиков, вызывается под блокировкой.
+// Каждый обработчик останавливается своей функцией отмены, поэтому число элементов workers
+// всегда совпадает с числом работающих обработчиков.
+func (a *accrualProcessor) setWorkers(n int) {
+	for len(a.workers) < n {
+		ctx, cancel := context.WithCancel(context.Background())
+		a.workers = append(a.workers, cancel)
+		go a.queueWorker(ctx)
+	}
+	for len(a.workers) > n {
+		last := len(a.workers) - 1
+		a.workers[last]()
+		a.workers = a.workers[:last]
+	}
 }
 
 func (a *accrualProcessor) GetOrderStatus(orderID string) *types.AccrualOrderState {
-	res, err := http.Get(fmt.Sprintf("%s/api/orders/%s", a.address, orderID))
+	state, err := a.source.GetOrderStatus(orderID)
 	if err != nil {
 		log.Println("request error", err)
 		return nil
 	}
-	defer func() { _ = res.Body.Close() }()
+	return state
+}
 
-	if res.StatusCode == http.StatusTooManyRequests {
-		resBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			log.Println(err)
-			return nil
-		}
-		var rl int
-		_, err = fmt.Sscanf(tooManyRequestTemplate, string(resBody), &rl)
-		if err != nil {
-			log.Println(err)
-			return nil
+// Ready метод проверки готовности источника начислений.
+func (a *accrualProcessor) Ready() error {
+	return a.source.Ready()
+}
+
+func (a *accrualProcessor) queueWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case orderID := <-a.queue:
+			a.results <- accrualResult{orderID: orderID, state: a.fetch(orderID)}
 		}
-		a.setLimit(rl)
 	}
-	if res.StatusCode != http.StatusOK {
+}
+
+// fetch метод опроса системы начислений по заказу.
+func (a *accrualProcessor) fetch(orderID string) *types.AccrualOrderState {
+	state, err := a.source.GetOrderStatus(orderID)
+	if err != nil {
+		if errors.Is(err, ErrTooManyRequests) {
+			a.throttle()
+		}
+		log.Println("request error", err)
 		return nil
 	}
-	var aos types.AccrualOrderState
-	if err := json.NewDecoder(res.Body).Decode(&aos); err != nil {
+	return state
+}
+
+// save метод сохранения результата опроса и публикации события об изменении заказа.
+func (a *accrualProcessor) save(res accrualResult) {
+	if err := a.dao.RegisterAccrualAttempt(res.orderID); err != nil {
+		log.Println(err)
+	}
+	if res.state == nil {
+		return
+	}
+	if err := a.apply(res.state); err != nil {
 		log.Println(err)
-		return nil
 	}
-	// TODO remove
-	log.Println("AccProc - get order status:", &aos)
-	return &aos
 }
 
-func (a *accrualProcessor) setLimit(n int) {
-	if n <= 0 {
-		a.limiter = nil
-		return
+// Push метод приема состояния заказа, присланного системой начислений.
+// Состояние сохраняется так же, как результат опроса.
+func (a *accrualProcessor) Push(state *types.AccrualOrderState) error {
+	metrics.Add("callbacks", 1)
+	if err := a.dao.RegisterAccrualCallback(state.Order); err != nil {
+		return err
 	}
-	a.limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(n)), n)
+	return a.apply(state)
 }
 
-func (a *accrualProcessor) queueWorker() {
-	for orderID := range a.OrderQueue {
-		if a.limiter != nil && !a.limiter.Allow() {
-			err := a.limiter.Wait(context.Background())
-			if err != nil {
-				log.Println(err)
-				wg.Done()
-				return
-			}
-		}
-		orderStatus := a.GetOrderStatus(orderID)
-		if orderStatus != nil {
-			if err := a.dao.UpdateOrderState(orderStatus); err != nil {
-				log.Println(err)
-			}
-		}
-		wg.Done()
+// apply метод сохранения состояния заказа и публикации события об его изменении.
+func (a *accrualProcessor) apply(state *types.AccrualOrderState) error {
+	e, err := a.dao.UpdateOrderState(mapAccrualStatus(state), a.opts.Lots)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		a.hub.Publish(e)
+	}
+	return nil
+}
+
+// mapAccrualStatus метод приведения статуса системы начислений к статусу заказа.
+func mapAccrualStatus(state *types.AccrualOrderState) *types.AccrualOrderState {
+	// заказ зарегистрирован системой начислений, но еще не взят в расчет
+	if state.Status == "REGISTERED" {
+		state.Status = "NEW"
 	}
+	return state
 }
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestMapAccrualStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"REGISTERED", "NEW"},
+		{"PROCESSING", "PROCESSING"},
+		{"INVALID", "INVALID"},
+		{"PROCESSED", "PROCESSED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			got := mapAccrualStatus(&types.AccrualOrderState{Order: "79927398713", Status: tt.status})
+			if got.Status != tt.want {
+				t.Errorf("mapAccrualStatus(%s) = %s, want %s", tt.status, got.Status, tt.want)
+			}
+		})
+	}
+}
+
+// blockingSource источник начислений, ответ которого задерживается до закрытия release.
+type blockingSource struct {
+	mu      sync.Mutex
+	calls   int
+	release chan struct{}
+}
+
+func (s *blockingSource) Name() string { return "blocking" }
+
+func (s *blockingSource) Ready() error { return nil }
+
+func (s *blockingSource) GetOrderStatus(orderID string) (*types.AccrualOrderState, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	<-s.release
+	return &types.AccrualOrderState{Order: orderID, Status: "PROCESSING"}, nil
+}
+
+func (s *blockingSource) inFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestSetWorkersRegrow(t *testing.T) {
+	src := &blockingSource{release: make(chan struct{})}
+	a := &accrualProcessor{
+		source:  src,
+		queue:   make(chan string),
+		results: make(chan accrualResult, 10),
+	}
+	a.mu.Lock()
+	a.setWorkers(4)
+	a.setWorkers(1)
+	a.setWorkers(4)
+	workers := len(a.workers)
+	a.mu.Unlock()
+	if workers != 4 {
+		t.Fatalf("workers = %d, want 4", workers)
+	}
+
+	// каждый из четырех обработчиков должен взять по заказу, даже если пул только что уменьшался
+	for i := 0; i < 4; i++ {
+		select {
+		case a.queue <- strconv.Itoa(i):
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of 4 workers took an order", i)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for src.inFlight() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := src.inFlight(); got != 4 {
+		t.Errorf("%d concurrent requests, want 4", got)
+	}
+	close(src.release)
+
+	a.mu.Lock()
+	a.setWorkers(0)
+	a.mu.Unlock()
+}
+
+func TestAcquire(t *testing.T) {
+	a := &accrualProcessor{inflight: make(map[string]struct{})}
+	other := &accrualProcessor{inflight: make(map[string]struct{})}
+	tests := []struct {
+		name    string
+		p       *accrualProcessor
+		release bool
+		orderID string
+		want    bool
+	}{
+		{"new order", a, false, "79927398713", true},
+		{"order in flight", a, false, "79927398713", false},
+		{"another order", a, false, "12345678903", true},
+		{"other processor", other, false, "79927398713", true},
+		{"released", a, true, "79927398713", true},
+		{"in flight again", a, false, "79927398713", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.release {
+				tt.p.release(tt.orderID)
+			}
+			if got := tt.p.acquire(tt.orderID); got != tt.want {
+				t.Errorf("acquire(%s) = %v, want %v", tt.orderID, got, tt.want)
+			}
+		})
+	}
+	if n := a.inflightCount(); n != 2 {
+		t.Errorf("inflightCount() = %d, want 2", n)
+	}
+}
+
+// slowSource источник начислений, ответ которого по заказу slow задерживается до закрытия release.
+type slowSource struct {
+	slow    string
+	release chan struct{}
+}
+
+func (s *slowSource) Name() string { return "slow" }
+
+func (s *slowSource) Ready() error { return nil }
+
+func (s *slowSource) GetOrderStatus(orderID string) (*types.AccrualOrderState, error) {
+	if orderID == s.slow {
+		<-s.release
+	}
+	return &types.AccrualOrderState{Order: orderID, Status: "PROCESSED"}, nil
+}
+
+func TestPipelineSlowOrder(t *testing.T) {
+	src := &slowSource{slow: "79927398713", release: make(chan struct{})}
+	a := &accrualProcessor{
+		source:  src,
+		queue:   make(chan string, 3),
+		results: make(chan accrualResult, 3),
+	}
+	a.mu.Lock()
+	a.setWorkers(2)
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.setWorkers(0)
+		a.mu.Unlock()
+	}()
+
+	for _, orderID := range []string{"79927398713", "12345678903", "2377225624"} {
+		a.queue <- orderID
+	}
+	// медленный заказ занимает один обработчик, остальные проходят через второй
+	var got []string
+	for len(got) < 2 {
+		select {
+		case res := <-a.results:
+			got = append(got, res.orderID)
+		case <-time.After(time.Second):
+			t.Fatalf("results = %v, a slow order must not hold up the others", got)
+		}
+	}
+	if got[0] == src.slow || got[1] == src.slow {
+		t.Errorf("results = %v, want the slow order last", got)
+	}
+	close(src.release)
+	select {
+	case res := <-a.results:
+		if res.orderID != src.slow || res.state == nil {
+			t.Errorf("result = %+v, want the slow order", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow order was not processed")
+	}
+}
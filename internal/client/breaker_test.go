@@ -0,0 +1,90 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	tests := []struct {
+		name  string
+		steps func(b *circuitBreaker)
+		want  string
+		allow error
+	}{
+		{
+			name:  "below threshold",
+			steps: func(b *circuitBreaker) { b.Failure() },
+			want:  BreakerClosed,
+		},
+		{
+			name:  "opens at threshold",
+			steps: func(b *circuitBreaker) { b.Failure(); b.Failure() },
+			want:  BreakerOpen,
+			allow: ErrCircuitOpen,
+		},
+		{
+			name:  "success resets failures",
+			steps: func(b *circuitBreaker) { b.Failure(); b.Success(); b.Failure() },
+			want:  BreakerClosed,
+		},
+		{
+			name: "half-open after cooldown lets one probe through",
+			steps: func(b *circuitBreaker) {
+				b.Failure()
+				b.Failure()
+				time.Sleep(cooldown)
+				_ = b.Allow()
+			},
+			want:  BreakerHalfOpen,
+			allow: ErrCircuitOpen,
+		},
+		{
+			name: "successful probe closes",
+			steps: func(b *circuitBreaker) {
+				b.Failure()
+				b.Failure()
+				time.Sleep(cooldown)
+				_ = b.Allow()
+				b.Success()
+			},
+			want: BreakerClosed,
+		},
+		{
+			name: "failed probe opens again",
+			steps: func(b *circuitBreaker) {
+				b.Failure()
+				b.Failure()
+				time.Sleep(cooldown)
+				_ = b.Allow()
+				b.Failure()
+			},
+			want:  BreakerOpen,
+			allow: ErrCircuitOpen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(2, cooldown)
+			tt.steps(b)
+			if got := b.State(); got != tt.want {
+				t.Errorf("State() = %s, want %s", got, tt.want)
+			}
+			if err := b.Allow(); !errors.Is(err, tt.allow) {
+				t.Errorf("Allow() = %v, want %v", err, tt.allow)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.Failure()
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("Allow() = %v, want nil for a disabled breaker", err)
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+	"github.com/lipandr/yandex-practicum-diploma/internal/webhook"
+)
+
+const (
+	registrationBatchSize    = 50
+	registrationPollInterval = time.Second
+	registrationLease        = time.Minute
+)
+
+// Registrar интерфейс фоновой регистрации загруженных заказов в системе начислений.
+type Registrar interface {
+	Run()
+}
+
+// registrationStore хранилище регистраций заказов; реализуется *dao.DAO.
+type registrationStore interface {
+	ClaimAccrualRegistrations(limit int, lease time.Duration) ([]types.AccrualRegistration, error)
+	MarkAccrualRegistered(id int64) error
+	MarkAccrualRegistrationFailed(id int64, lastErr string, retryAfter time.Duration) error
+}
+
+type registrar struct {
+	dao         registrationStore
+	source      AccrualSource
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewRegistrar метод-конструктор регистрации заказов из outbox в системе начислений.
+func NewRegistrar(dao *dao.DAO, source AccrualSource, maxAttempts int, backoff time.Duration) Registrar {
+	return &registrar{
+		dao:         dao,
+		source:      source,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+// Run метод запуска фоновой регистрации заказов.
+func (r *registrar) Run() {
+	go func() {
+		for {
+			regs, err := r.dao.ClaimAccrualRegistrations(registrationBatchSize, registrationLease)
+			if err != nil {
+				log.Println("accrual registrar:", err)
+			}
+			if err != nil || len(regs) == 0 {
+				time.Sleep(registrationPollInterval)
+				continue
+			}
+			for i := range regs {
+				r.register(&regs[i])
+			}
+		}
+	}()
+}
+
+// register метод регистрации одного заказа и фиксации результата.
+func (r *registrar) register(reg *types.AccrualRegistration) {
+	err := ErrRegistrationUnsupported
+	if or, ok := r.source.(OrderRegistrar); ok {
+		err = or.RegisterOrder(reg.OrderNumber, reg.Goods)
+	}
+	if err == nil {
+		if err = r.dao.MarkAccrualRegistered(reg.ID); err != nil {
+			log.Println("accrual registrar:", err)
+		}
+		return
+	}
+	var retryAfter time.Duration
+	// отказ системы начислений повторной попыткой не исправить
+	permanent := errors.Is(err, ErrOrderRejected) || errors.Is(err, ErrRegistrationUnsupported)
+	if !permanent && reg.Attempts+1 < r.maxAttempts {
+		retryAfter = webhook.Backoff(r.backoff, reg.Attempts)
+	}
+	if err = r.dao.MarkAccrualRegistrationFailed(reg.ID, err.Error(), retryAfter); err != nil {
+		log.Println("accrual registrar:", err)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// registrationMark итог регистрации, записанный registrar в хранилище.
+type registrationMark struct {
+	id         int64
+	registered bool
+	retryAfter time.Duration
+}
+
+// memRegistrations хранилище регистраций в памяти, запоминающее итоги.
+type memRegistrations struct {
+	marks []registrationMark
+}
+
+func (m *memRegistrations) ClaimAccrualRegistrations(int, time.Duration) ([]types.AccrualRegistration, error) {
+	return nil, nil
+}
+
+func (m *memRegistrations) MarkAccrualRegistered(id int64) error {
+	m.marks = append(m.marks, registrationMark{id: id, registered: true})
+	return nil
+}
+
+func (m *memRegistrations) MarkAccrualRegistrationFailed(id int64, _ string, retryAfter time.Duration) error {
+	m.marks = append(m.marks, registrationMark{id: id, retryAfter: retryAfter})
+	return nil
+}
+
+func TestRegistrarRegister(t *testing.T) {
+	const backoff = time.Second
+	goods := []types.Good{{Description: "Чайник Bork", Price: 7000}}
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		static   bool
+		attempts int
+		want     registrationMark
+	}{
+		{name: "accepted", handler: status(http.StatusAccepted), want: registrationMark{id: 1, registered: true}},
+		{name: "already registered", handler: status(http.StatusConflict), want: registrationMark{id: 1, registered: true}},
+		{name: "server error is retried", handler: status(http.StatusBadGateway), want: registrationMark{id: 1, retryAfter: backoff}},
+		{name: "backoff grows", handler: status(http.StatusBadGateway), attempts: 1, want: registrationMark{id: 1, retryAfter: 2 * backoff}},
+		{name: "attempts exhausted", handler: status(http.StatusBadGateway), attempts: 2, want: registrationMark{id: 1}},
+		{name: "rate limited is retried", handler: status(http.StatusTooManyRequests), want: registrationMark{id: 1, retryAfter: backoff}},
+		{name: "rejected", handler: status(http.StatusBadRequest), want: registrationMark{id: 1}},
+		{name: "registration unsupported", static: true, want: registrationMark{id: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src AccrualSource = NewStaticSource("static", nil)
+			if !tt.static {
+				src = newTestSource(t, tt.handler, HTTPOptions{})
+			}
+			store := &memRegistrations{}
+			r := &registrar{dao: store, source: src, maxAttempts: 3, backoff: backoff}
+			r.register(&types.AccrualRegistration{ID: 1, OrderNumber: "79927398713", Goods: goods, Attempts: tt.attempts})
+			if len(store.marks) != 1 || store.marks[0] != tt.want {
+				t.Errorf("marks = %+v, want %+v", store.marks, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistrarSendsGoods(t *testing.T) {
+	var got types.OrderUpload
+	src := newTestSource(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/orders" {
+			t.Errorf("request %s %s, want POST /api/orders", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}), HTTPOptions{})
+	r := &registrar{dao: &memRegistrations{}, source: src, maxAttempts: 1}
+	r.register(&types.AccrualRegistration{ID: 1, OrderNumber: "79927398713", Goods: []types.Good{{Description: "Чайник Bork", Price: 7000}}})
+	if got.Order != "79927398713" || len(got.Goods) != 1 || got.Goods[0].Description != "Чайник Bork" {
+		t.Errorf("uploaded %+v, want the order with its goods", got)
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// Типы провайдеров начислений в файле конфигурации.
+const (
+	SourceTypeHTTP   = "http"
+	SourceTypeStatic = "static"
+)
+
+// AccrualSource интерфейс источника сведений о начислениях по заказам.
+// Для неизвестного источнику заказа GetOrderStatus возвращает nil без ошибки.
+type AccrualSource interface {
+	Name() string
+	GetOrderStatus(orderID string) (*types.AccrualOrderState, error)
+	Ready() error
+}
+
+// OrderRegistrar интерфейс источника начислений, принимающего регистрацию заказов.
+// Повторная регистрация уже известного источнику заказа не считается ошибкой.
+type OrderRegistrar interface {
+	RegisterOrder(orderID string, goods []types.Good) error
+}
+
+// ProvidersConfig файл конфигурации провайдеров начислений.
+type ProvidersConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+}
+
+// ProviderConfig настройки одного провайдера начислений.
+// Провайдер обслуживает заказы с номерами, начинающимися с одного из Prefixes (все, если список пуст).
+// Подходящие провайдеры опрашиваются по возрастанию Priority до первого известного им заказа.
+type ProviderConfig struct {
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Priority int          `json:"priority"`
+	Prefixes []string     `json:"prefixes"`
+	Address  string       `json:"address,omitempty"`
+	Rules    []StaticRule `json:"rules,omitempty"`
+}
+
+type routedSource struct {
+	AccrualSource
+	priority int
+	prefixes []string
+}
+
+// matches метод проверки обслуживания заказа провайдером.
+func (s *routedSource) matches(orderID string) bool {
+	if len(s.prefixes) == 0 {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(orderID, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type multiSource struct {
+	sources []*routedSource
+}
+
+// LoadAccrualSources метод загрузки провайдеров начислений из JSON-файла конфигурации.
+func LoadAccrualSources(path string, opts HTTPOptions) (AccrualSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg ProvidersConfig
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return NewAccrualSources(cfg, opts)
+}
+
+// NewAccrualSources метод-конструктор AccrualSource, маршрутизирующего запросы между провайдерами.
+// HTTP-провайдеры создаются с настройками клиента opts.
+func NewAccrualSources(cfg ProvidersConfig, opts HTTPOptions) (AccrualSource, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, errors.New("no accrual providers configured")
+	}
+	ms := &multiSource{}
+	for _, pc := range cfg.Providers {
+		var src AccrualSource
+		switch pc.Type {
+		case SourceTypeHTTP:
+			if pc.Address == "" {
+				return nil, fmt.Errorf("accrual provider %q: address is required", pc.Name)
+			}
+			src = NewHTTPSource(pc.Name, pc.Address, opts)
+		case SourceTypeStatic:
+			src = NewStaticSource(pc.Name, pc.Rules)
+		default:
+			return nil, fmt.Errorf("accrual provider %q: unknown type %q", pc.Name, pc.Type)
+		}
+		ms.sources = append(ms.sources, &routedSource{
+			AccrualSource: src,
+			priority:      pc.Priority,
+			prefixes:      pc.Prefixes,
+		})
+	}
+	sort.SliceStable(ms.sources, func(i, j int) bool {
+		return ms.sources[i].priority < ms.sources[j].priority
+	})
+	return ms, nil
+}
+
+func (ms *multiSource) Name() string {
+	names := make([]string, len(ms.sources))
+	for i, s := range ms.sources {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Ready метод проверки готовности всех провайдеров.
+func (ms *multiSource) Ready() error {
+	var errs []string
+	for _, s := range ms.sources {
+		if err := s.Ready(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// GetOrderStatus метод опроса подходящих провайдеров по порядку приоритета.
+func (ms *multiSource) GetOrderStatus(orderID string) (*types.AccrualOrderState, error) {
+	var lastErr error
+	for _, s := range ms.sources {
+		if !s.matches(orderID) {
+			continue
+		}
+		state, err := s.GetOrderStatus(orderID)
+		if err != nil {
+			log.Printf("accrual provider %s: %v", s.Name(), err)
+			lastErr = err
+			continue
+		}
+		if state != nil {
+			return state, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// RegisterOrder метод регистрации заказа у первого по приоритету подходящего провайдера,
+// поддерживающего регистрацию.
+func (ms *multiSource) RegisterOrder(orderID string, goods []types.Good) error {
+	for _, s := range ms.sources {
+		if !s.matches(orderID) {
+			continue
+		}
+		if r, ok := s.AccrualSource.(OrderRegistrar); ok {
+			return r.RegisterOrder(orderID, goods)
+		}
+	}
+	return ErrRegistrationUnsupported
+}
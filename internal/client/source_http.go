@@ -0,0 +1,358 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const tooManyRequestTemplate = "No more than %d requests per minute allowed"
+
+var (
+	// ErrTooManyRequests ошибка превышения количества запросов к системе начислений.
+	ErrTooManyRequests = errors.New("accrual system: too many requests")
+	// ErrOrderRejected ошибка отказа системы начислений в регистрации заказа.
+	ErrOrderRejected = errors.New("accrual system: order rejected")
+	// ErrRegistrationUnsupported ошибка отсутствия источника, принимающего регистрацию заказа.
+	ErrRegistrationUnsupported = errors.New("accrual system: order registration is not supported")
+)
+
+// metrics метрики обращений к системам начислений, публикуются через expvar.
+var metrics = expvar.NewMap("accrual")
+
+// HTTPOptions настройки HTTP-клиента системы начислений.
+type HTTPOptions struct {
+	ConnectTimeout   time.Duration
+	RequestTimeout   time.Duration
+	MaxIdleConns     int
+	MaxConnsPerHost  int
+	IdleConnTimeout  time.Duration
+	Retries          int
+	RetryBackoff     time.Duration
+	HedgeDelay       time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// NewHTTPOptions метод получения настроек HTTP-клиента системы начислений из конфигурации.
+func NewHTTPOptions(cfg config.Config) HTTPOptions {
+	return HTTPOptions{
+		ConnectTimeout:   cfg.AccrualConnectTimeout,
+		RequestTimeout:   cfg.AccrualRequestTimeout,
+		MaxIdleConns:     cfg.AccrualMaxIdleConns,
+		MaxConnsPerHost:  cfg.AccrualMaxConnsPerHost,
+		IdleConnTimeout:  cfg.AccrualIdleConnTimeout,
+		Retries:          cfg.AccrualRetries,
+		RetryBackoff:     cfg.AccrualRetryBackoff,
+		HedgeDelay:       cfg.AccrualHedgeDelay,
+		BreakerThreshold: cfg.AccrualBreakerThreshold,
+		BreakerCooldown:  cfg.AccrualBreakerCooldown,
+	}
+}
+
+// statusError ошибка неожиданного кода ответа системы начислений.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("accrual system: unexpected status %d", e.code)
+}
+
+type httpSource struct {
+	name    string
+	address string
+	opts    HTTPOptions
+	client  *http.Client
+	breaker *circuitBreaker
+
+	mu      sync.RWMutex
+	limiter *rate.Limiter
+	retryAt time.Time
+}
+
+// NewHTTPSource метод-конструктор источника начислений, работающего по протоколу системы расчета начислений.
+func NewHTTPSource(name, addr string, opts HTTPOptions) AccrualSource {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.RequestTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+	}
+	s := &httpSource{
+		name:    name,
+		address: addr,
+		opts:    opts,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.RequestTimeout,
+		},
+		breaker: newCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+	}
+	metrics.Set(name+".breaker_state", expvar.Func(func() interface{} {
+		return s.breaker.State()
+	}))
+	return s
+}
+
+func (s *httpSource) Name() string {
+	return s.name
+}
+
+// Ready метод проверки готовности источника: circuit breaker не должен быть разомкнут.
+func (s *httpSource) Ready() error {
+	if s.breaker.State() == BreakerOpen {
+		return fmt.Errorf("%s: %w", s.name, ErrCircuitOpen)
+	}
+	return nil
+}
+
+// GetOrderStatus метод запроса состояния расчета начислений по заказу
+// с повторами при сетевых ошибках и ответах 5xx.
+func (s *httpSource) GetOrderStatus(orderID string) (*types.AccrualOrderState, error) {
+	if err := s.breaker.Allow(); err != nil {
+		metrics.Add(s.name+".rejected", 1)
+		return nil, err
+	}
+	if d := s.retryDelay(); d > 0 {
+		time.Sleep(d)
+	}
+	if l := s.getLimiter(); l != nil {
+		if err := l.Wait(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	var state *types.AccrualOrderState
+	var err error
+	for attempt := 0; attempt <= s.opts.Retries; attempt++ {
+		if attempt > 0 {
+			metrics.Add(s.name+".retries", 1)
+			time.Sleep(s.opts.RetryBackoff << (attempt - 1))
+		}
+		state, err = s.hedged(orderID)
+		if !retryable(err) {
+			break
+		}
+	}
+	if retryable(err) {
+		metrics.Add(s.name+".failures", 1)
+		s.breaker.Failure()
+	} else {
+		s.breaker.Success()
+	}
+	return state, err
+}
+
+type fetchResult struct {
+	state *types.AccrualOrderState
+	err   error
+}
+
+// hedged метод выполнения запроса с дублированием: если ответ не получен за HedgeDelay,
+// отправляется второй такой же запрос и используется первый успешный ответ.
+func (s *httpSource) hedged(orderID string) (*types.AccrualOrderState, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan fetchResult, 2)
+	launch := func() {
+		go func() {
+			state, err := s.fetch(ctx, orderID)
+			results <- fetchResult{state: state, err: err}
+		}()
+	}
+	launch()
+	pending := 1
+
+	var hedge <-chan time.Time
+	if s.opts.HedgeDelay > 0 {
+		t := time.NewTimer(s.opts.HedgeDelay)
+		defer t.Stop()
+		hedge = t.C
+	}
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			metrics.Add(s.name+".hedges", 1)
+			launch()
+			pending++
+		case r := <-results:
+			pending--
+			if r.err == nil || pending == 0 {
+				return r.state, r.err
+			}
+		}
+	}
+}
+
+// fetch метод выполнения одного запроса к системе начислений.
+func (s *httpSource) fetch(ctx context.Context, orderID string) (*types.AccrualOrderState, error) {
+	metrics.Add(s.name+".requests", 1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/api/orders/%s", s.address, orderID), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusTooManyRequests:
+		s.setRetryAfter(res.Header.Get("Retry-After"))
+		// если лимит в теле ответа не указан, текущий лимит запросов не меняется
+		if resBody, err := io.ReadAll(res.Body); err == nil {
+			var rl int
+			if _, err = fmt.Sscanf(string(resBody), tooManyRequestTemplate, &rl); err == nil && rl > 0 {
+				s.setLimit(rl)
+			}
+		}
+		return nil, ErrTooManyRequests
+	default:
+		return nil, &statusError{code: res.StatusCode}
+	}
+	var aos types.AccrualOrderState
+	if err := json.NewDecoder(res.Body).Decode(&aos); err != nil {
+		return nil, err
+	}
+	return &aos, nil
+}
+
+// RegisterOrder метод регистрации заказа с составом goods в системе начислений.
+// Повторы выполняются вызывающей стороной, поэтому здесь делается одна попытка.
+func (s *httpSource) RegisterOrder(orderID string, goods []types.Good) error {
+	if err := s.breaker.Allow(); err != nil {
+		metrics.Add(s.name+".rejected", 1)
+		return err
+	}
+	if goods == nil {
+		goods = []types.Good{}
+	}
+	body, err := json.Marshal(types.OrderUpload{Order: orderID, Goods: goods})
+	if err != nil {
+		return err
+	}
+	metrics.Add(s.name+".registrations", 1)
+	res, err := s.client.Post(fmt.Sprintf("%s/api/orders", s.address), "application/json", bytes.NewReader(body))
+	if err != nil {
+		s.breaker.Failure()
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	switch {
+	case res.StatusCode == http.StatusAccepted || res.StatusCode == http.StatusOK:
+	case res.StatusCode == http.StatusConflict:
+		// заказ уже зарегистрирован, в том числе предыдущей попыткой
+	case res.StatusCode == http.StatusTooManyRequests:
+		s.setRetryAfter(res.Header.Get("Retry-After"))
+		s.breaker.Success()
+		return ErrTooManyRequests
+	case res.StatusCode >= http.StatusInternalServerError:
+		s.breaker.Failure()
+		return &statusError{code: res.StatusCode}
+	default:
+		s.breaker.Success()
+		return fmt.Errorf("%w: status %d", ErrOrderRejected, res.StatusCode)
+	}
+	s.breaker.Success()
+	return nil
+}
+
+// retryable метод-helper проверки, стоит ли повторять запрос после ошибки:
+// повторяются сетевые ошибки и ответы 5xx.
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, ErrTooManyRequests) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+func (s *httpSource) getLimiter() *rate.Limiter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limiter
+}
+
+func (s *httpSource) setLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 {
+		s.limiter = nil
+		return
+	}
+	s.limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(n)), n)
+}
+
+// setRetryAfter метод приостановки запросов к источнику на время из заголовка Retry-After.
+func (s *httpSource) setRetryAfter(header string) {
+	d := parseRetryAfter(header, time.Now())
+	if d <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at := time.Now().Add(d); at.After(s.retryAt) {
+		s.retryAt = at
+	}
+}
+
+// retryDelay метод получения времени, оставшегося до окончания паузы по Retry-After.
+func (s *httpSource) retryDelay() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Until(s.retryAt)
+}
+
+// parseRetryAfter метод-helper разбора заголовка Retry-After: числа секунд или даты HTTP.
+// Для пустого или некорректного заголовка возвращает 0.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(header); err == nil {
+		if n < 0 {
+			return 0
+		}
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
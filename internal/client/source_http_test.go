@@ -0,0 +1,247 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// scriptedServer система начислений, отвечающая на i-й запрос по статусу заказа handlers[i];
+// запросы сверх сценария получают последний ответ.
+type scriptedServer struct {
+	mu       sync.Mutex
+	calls    int
+	handlers []http.HandlerFunc
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	i := s.calls
+	s.calls++
+	s.mu.Unlock()
+	if i >= len(s.handlers) {
+		i = len(s.handlers) - 1
+	}
+	s.handlers[i](w, r)
+}
+
+func (s *scriptedServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func status(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+func processed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprint(w, `{"order":"79927398713","status":"PROCESSED","accrual":500}`)
+}
+
+func newTestSource(t *testing.T, srv http.Handler, opts HTTPOptions) *httpSource {
+	t.Helper()
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	if opts.RequestTimeout == 0 {
+		opts.RequestTimeout = 5 * time.Second
+	}
+	return NewHTTPSource(t.Name(), ts.URL, opts).(*httpSource)
+}
+
+func TestGetOrderStatusTooManyRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		header    string
+		wantLimit bool
+		wantPause bool
+	}{
+		{name: "limit in body", body: "No more than 60 requests per minute allowed", wantLimit: true},
+		{name: "unknown body", body: "slow down"},
+		{name: "empty body"},
+		{name: "retry after", body: "slow down", header: "1", wantPause: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &scriptedServer{handlers: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = fmt.Fprint(w, tt.body)
+			}}}
+			s := newTestSource(t, srv, HTTPOptions{Retries: 2, RetryBackoff: time.Millisecond, BreakerThreshold: 1})
+			_, err := s.GetOrderStatus("79927398713")
+			if !errors.Is(err, ErrTooManyRequests) {
+				t.Fatalf("GetOrderStatus() error = %v, want %v", err, ErrTooManyRequests)
+			}
+			if n := srv.requests(); n != 1 {
+				t.Errorf("requests = %d, want 1: 429 must not be retried", n)
+			}
+			if got := s.getLimiter() != nil; got != tt.wantLimit {
+				t.Errorf("limiter set = %v, want %v", got, tt.wantLimit)
+			}
+			if got := s.retryDelay() > 0; got != tt.wantPause {
+				t.Errorf("paused = %v, want %v", got, tt.wantPause)
+			}
+			if st := s.breaker.State(); st != BreakerClosed {
+				t.Errorf("breaker = %s, want %s", st, BreakerClosed)
+			}
+		})
+	}
+}
+
+func TestGetOrderStatusWaitsRetryAfter(t *testing.T) {
+	srv := &scriptedServer{handlers: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}, processed}}
+	s := newTestSource(t, srv, HTTPOptions{})
+	if _, err := s.GetOrderStatus("79927398713"); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("GetOrderStatus() error = %v, want %v", err, ErrTooManyRequests)
+	}
+	start := time.Now()
+	if _, err := s.GetOrderStatus("79927398713"); err != nil {
+		t.Fatalf("GetOrderStatus() error = %v", err)
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Errorf("second request sent after %v, want it to wait for Retry-After", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"30", 30 * time.Second},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOrderStatusRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		handlers     []http.HandlerFunc
+		retries      int
+		wantErr      bool
+		wantRequests int
+		wantBreaker  string
+	}{
+		{
+			name:         "recovers after 5xx",
+			handlers:     []http.HandlerFunc{status(http.StatusBadGateway), status(http.StatusServiceUnavailable), processed},
+			retries:      2,
+			wantRequests: 3,
+			wantBreaker:  BreakerClosed,
+		},
+		{
+			name:         "retries exhausted",
+			handlers:     []http.HandlerFunc{status(http.StatusInternalServerError)},
+			retries:      1,
+			wantErr:      true,
+			wantRequests: 2,
+			wantBreaker:  BreakerOpen,
+		},
+		{
+			name:         "4xx is not retried",
+			handlers:     []http.HandlerFunc{status(http.StatusBadRequest), processed},
+			retries:      2,
+			wantErr:      true,
+			wantRequests: 1,
+			wantBreaker:  BreakerClosed,
+		},
+		{
+			name:         "not registered",
+			handlers:     []http.HandlerFunc{status(http.StatusNoContent)},
+			retries:      2,
+			wantRequests: 1,
+			wantBreaker:  BreakerClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &scriptedServer{handlers: tt.handlers}
+			s := newTestSource(t, srv, HTTPOptions{
+				Retries:          tt.retries,
+				RetryBackoff:     time.Millisecond,
+				BreakerThreshold: 1,
+				BreakerCooldown:  time.Minute,
+			})
+			_, err := s.GetOrderStatus("79927398713")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetOrderStatus() error = %v, want error %v", err, tt.wantErr)
+			}
+			if n := srv.requests(); n != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", n, tt.wantRequests)
+			}
+			if st := s.breaker.State(); st != tt.wantBreaker {
+				t.Errorf("breaker = %s, want %s", st, tt.wantBreaker)
+			}
+			if tt.wantBreaker == BreakerOpen {
+				if _, err = s.GetOrderStatus("79927398713"); !errors.Is(err, ErrCircuitOpen) {
+					t.Errorf("GetOrderStatus() with open breaker error = %v, want %v", err, ErrCircuitOpen)
+				}
+				if n := srv.requests(); n != tt.wantRequests {
+					t.Errorf("requests with open breaker = %d, want %d", n, tt.wantRequests)
+				}
+			}
+		})
+	}
+}
+
+func TestGetOrderStatusHedged(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := &scriptedServer{handlers: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+		// первый запрос зависает до конца теста или отмены дублирующим запросом
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, processed}}
+	s := newTestSource(t, srv, HTTPOptions{HedgeDelay: 20 * time.Millisecond})
+
+	done := make(chan *types.AccrualOrderState)
+	go func() {
+		state, err := s.GetOrderStatus("79927398713")
+		if err != nil {
+			t.Errorf("GetOrderStatus() error = %v", err)
+		}
+		done <- state
+	}()
+	select {
+	case state := <-done:
+		if state == nil || state.Status != "PROCESSED" {
+			t.Errorf("state = %+v, want PROCESSED from the hedged request", state)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("hedged request did not answer")
+	}
+	if n := srv.requests(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
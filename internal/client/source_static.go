@@ -0,0 +1,55 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// StaticRule правило локального провайдера: заказам с номером, начинающимся с Prefix,
+// назначается статус Status и начисление Accrual. Пустой Prefix подходит для любого заказа.
+type StaticRule struct {
+	Prefix  string  `json:"prefix"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual,omitempty"`
+}
+
+type staticSource struct {
+	name  string
+	rules []StaticRule
+}
+
+// NewStaticSource метод-конструктор локального провайдера начислений, работающего по правилам.
+// Правила проверяются по порядку, применяется первое подходящее.
+func NewStaticSource(name string, rules []StaticRule) AccrualSource {
+	return &staticSource{
+		name:  name,
+		rules: rules,
+	}
+}
+
+func (s *staticSource) Name() string {
+	return s.name
+}
+
+func (s *staticSource) Ready() error {
+	return nil
+}
+
+// GetOrderStatus метод расчета начисления по первому подходящему правилу.
+func (s *staticSource) GetOrderStatus(orderID string) (*types.AccrualOrderState, error) {
+	for _, r := range s.rules {
+		if !strings.HasPrefix(orderID, r.Prefix) {
+			continue
+		}
+		state := &types.AccrualOrderState{
+			Order:  orderID,
+			Status: r.Status,
+		}
+		if r.Status == "PROCESSED" {
+			state.Accrual = r.Accrual
+		}
+		return state, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestStaticSource(t *testing.T) {
+	s := NewStaticSource("static", []StaticRule{
+		{Prefix: "999", Status: "INVALID", Accrual: 100},
+		{Prefix: "9", Status: "PROCESSED", Accrual: 500},
+		{Prefix: "12", Status: "PROCESSING"},
+	})
+	tests := []struct {
+		orderID string
+		want    *types.AccrualOrderState
+	}{
+		{"9992", &types.AccrualOrderState{Order: "9992", Status: "INVALID"}},
+		{"9123", &types.AccrualOrderState{Order: "9123", Status: "PROCESSED", Accrual: 500}},
+		{"1234", &types.AccrualOrderState{Order: "1234", Status: "PROCESSING"}},
+		{"7777", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.orderID, func(t *testing.T) {
+			got, err := s.GetOrderStatus(tt.orderID)
+			if err != nil {
+				t.Fatalf("GetOrderStatus() error = %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("GetOrderStatus(%s) = %+v, want %+v", tt.orderID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccrualSourcesRouting(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+
+	src, err := NewAccrualSources(ProvidersConfig{Providers: []ProviderConfig{
+		{Name: "fallback", Type: SourceTypeStatic, Priority: 30, Rules: []StaticRule{{Status: "INVALID"}}},
+		{Name: "partner", Type: SourceTypeStatic, Priority: 10, Prefixes: []string{"55", "66"}, Rules: []StaticRule{{Prefix: "555", Status: "PROCESSED", Accrual: 50}}},
+		{Name: "broken", Type: SourceTypeHTTP, Priority: 20, Prefixes: []string{"77"}, Address: failing.URL},
+	}}, HTTPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.Name(); got != "partner,broken,fallback" {
+		t.Errorf("Name() = %s, want providers by priority", got)
+	}
+	tests := []struct {
+		name       string
+		orderID    string
+		wantStatus string
+	}{
+		{"prefix provider", "5551", "PROCESSED"},
+		{"unknown to prefix provider", "5612", "INVALID"},
+		{"prefix not served", "1234", "INVALID"},
+		{"provider error falls through", "7712", "INVALID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := src.GetOrderStatus(tt.orderID)
+			if err != nil {
+				t.Fatalf("GetOrderStatus() error = %v", err)
+			}
+			if state == nil || state.Status != tt.wantStatus {
+				t.Errorf("GetOrderStatus(%s) = %+v, want status %s", tt.orderID, state, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAccrualSourcesError(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+
+	src, err := NewAccrualSources(ProvidersConfig{Providers: []ProviderConfig{
+		{Name: "broken", Type: SourceTypeHTTP, Address: failing.URL},
+		{Name: "partner", Type: SourceTypeStatic, Prefixes: []string{"55"}},
+	}}, HTTPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = src.GetOrderStatus("1234"); err == nil {
+		t.Error("GetOrderStatus() error = nil, want the error of the only matching provider")
+	}
+	state, err := src.GetOrderStatus("5512")
+	if state != nil || err == nil {
+		t.Errorf("GetOrderStatus() = %+v, %v, want the error of the failed provider", state, err)
+	}
+}
+
+func TestNewAccrualSourcesConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []ProviderConfig
+		wantErr   bool
+	}{
+		{"no providers", nil, true},
+		{"http without address", []ProviderConfig{{Name: "a", Type: SourceTypeHTTP}}, true},
+		{"unknown type", []ProviderConfig{{Name: "a", Type: "grpc"}}, true},
+		{"valid", []ProviderConfig{{Name: "a", Type: SourceTypeHTTP, Address: "http://localhost:8080"}, {Name: "b", Type: SourceTypeStatic}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAccrualSources(ProvidersConfig{Providers: tt.providers}, HTTPOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAccrualSources() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccrualSourcesRegisterOrder(t *testing.T) {
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer accepting.Close()
+
+	src, err := NewAccrualSources(ProvidersConfig{Providers: []ProviderConfig{
+		{Name: "static", Type: SourceTypeStatic, Priority: 1},
+		{Name: "partner", Type: SourceTypeHTTP, Priority: 2, Prefixes: []string{"55"}, Address: accepting.URL},
+	}}, HTTPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		orderID string
+		want    error
+	}{
+		{"5512", nil},
+		{"79927398713", ErrRegistrationUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.orderID, func(t *testing.T) {
+			if err := src.(OrderRegistrar).RegisterOrder(tt.orderID, nil); !errors.Is(err, tt.want) {
+				t.Errorf("RegisterOrder() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,62 @@
 package config
 
+import "time"
+
 type Config struct {
-	RunAddress           string `env:"RUN_ADDRESS" envDefault:"localhost:8081"`
-	DatabaseURI          string `env:"DATABASE_URI" envDefault:"postgres://localhost:5432/gophermart?sslmode=disable"`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8080"`
+	RunAddress              string        `env:"RUN_ADDRESS" envDefault:"localhost:8081"`
+	MetricsAddress          string        `env:"METRICS_ADDRESS"`
+	DatabaseURI             string        `env:"DATABASE_URI" envDefault:"postgres://localhost:5432/gophermart?sslmode=disable"`
+	AccrualSystemAddress    string        `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8080"`
+	AccrualProviders        string        `env:"ACCRUAL_PROVIDERS"`
+	AccrualConnectTimeout   time.Duration `env:"ACCRUAL_CONNECT_TIMEOUT" envDefault:"2s"`
+	AccrualRequestTimeout   time.Duration `env:"ACCRUAL_REQUEST_TIMEOUT" envDefault:"5s"`
+	AccrualMaxIdleConns     int           `env:"ACCRUAL_MAX_IDLE_CONNS" envDefault:"100"`
+	AccrualMaxConnsPerHost  int           `env:"ACCRUAL_MAX_CONNS_PER_HOST" envDefault:"20"`
+	AccrualIdleConnTimeout  time.Duration `env:"ACCRUAL_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	AccrualRetries          int           `env:"ACCRUAL_RETRIES" envDefault:"2"`
+	AccrualRetryBackoff     time.Duration `env:"ACCRUAL_RETRY_BACKOFF" envDefault:"200ms"`
+	AccrualHedgeDelay       time.Duration `env:"ACCRUAL_HEDGE_DELAY" envDefault:"0s"`
+	AccrualBreakerThreshold int           `env:"ACCRUAL_BREAKER_THRESHOLD" envDefault:"5"`
+	AccrualBreakerCooldown  time.Duration `env:"ACCRUAL_BREAKER_COOLDOWN" envDefault:"30s"`
+	AccrualWorkers          int           `env:"ACCRUAL_WORKERS" envDefault:"10"`
+	AccrualMaxWorkers       int           `env:"ACCRUAL_MAX_WORKERS" envDefault:"50"`
+	AccrualBatchSize        int           `env:"ACCRUAL_BATCH_SIZE" envDefault:"10"`
+	AccrualPollInterval     time.Duration `env:"ACCRUAL_POLL_INTERVAL" envDefault:"5s"`
+	AccrualThrottleCooldown time.Duration `env:"ACCRUAL_THROTTLE_COOLDOWN" envDefault:"1m"`
+	AccrualCallbackSecret   string        `env:"ACCRUAL_CALLBACK_SECRET"`
+	AccrualCallbackDeadline time.Duration `env:"ACCRUAL_CALLBACK_DEADLINE" envDefault:"1m"`
+	AccrualCallbackMaxAge   time.Duration `env:"ACCRUAL_CALLBACK_MAX_AGE" envDefault:"5m"`
+	AccrualRegisterOrders   bool          `env:"ACCRUAL_REGISTER_ORDERS" envDefault:"false"`
+	AccrualRegisterAttempts int           `env:"ACCRUAL_REGISTER_ATTEMPTS" envDefault:"10"`
+	AccrualRegisterBackoff  time.Duration `env:"ACCRUAL_REGISTER_BACKOFF" envDefault:"5s"`
+	OrdersBatchLimit        int           `env:"ORDERS_BATCH_LIMIT" envDefault:"500"`
+	IdempotencyKeyTTL       time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	WithdrawalGracePeriod   time.Duration `env:"WITHDRAWAL_GRACE_PERIOD" envDefault:"15m"`
+	LedgerInterval          time.Duration `env:"LEDGER_INTERVAL" envDefault:"30s"`
+	PointsExpiryMonths      int           `env:"POINTS_EXPIRY_MONTHS" envDefault:"12"`
+	PointsExpiringSoon      time.Duration `env:"POINTS_EXPIRING_SOON" envDefault:"720h"`
+	AccrualHoldPeriod       time.Duration `env:"ACCRUAL_HOLD_PERIOD" envDefault:"0"`
+	AllowNegativeBalance    bool          `env:"ALLOW_NEGATIVE_BALANCE" envDefault:"false"`
+	TransferDailySum        float64       `env:"TRANSFER_DAILY_SUM" envDefault:"5000"`
+	TransferDailyCount      int           `env:"TRANSFER_DAILY_COUNT" envDefault:"10"`
+	EventsHeartbeat         time.Duration `env:"EVENTS_HEARTBEAT" envDefault:"15s"`
+	WebhookTimeout          time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookMaxAttempts      int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookBackoff          time.Duration `env:"WEBHOOK_BACKOFF" envDefault:"30s"`
+	APIKeyRateLimit         int           `env:"API_KEY_RATE_LIMIT" envDefault:"600"`
+	RateLimitDefault        string        `env:"RATE_LIMIT_DEFAULT" envDefault:"600/m"`
+	RateLimitIP             string        `env:"RATE_LIMIT_IP" envDefault:"1200/m"`
+	RateLimitRoutes         []string      `env:"RATE_LIMIT_ROUTES" envSeparator:";" envDefault:"POST /api/user/register=20/m;POST /api/user/login=20/m;POST /api/user/login/2fa=10/m;POST /api/user/orders=60/m;POST /api/user/orders/batch=10/m;POST /api/user/balance/withdraw=30/m;POST /api/user/balance/transfer=10/m"`
+	RateLimitStore          string        `env:"RATE_LIMIT_STORE" envDefault:"memory"`
+	OIDCIssuer              string        `env:"OIDC_ISSUER"`
+	OIDCClientID            string        `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret        string        `env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL         string        `env:"OIDC_REDIRECT_URL"`
+	OIDCScopes              []string      `env:"OIDC_SCOPES" envSeparator:"," envDefault:"openid,email,profile"`
+	TOTPEncryptionKey       string        `env:"TOTP_ENCRYPTION_KEY"`
+	TOTPIssuer              string        `env:"TOTP_ISSUER" envDefault:"Gophermart"`
+	TwoFactorChallengeTTL   time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" envDefault:"5m"`
+	AdminPassword           string        `env:"ADMIN_PASSWORD"`
+	EventsSink              string        `env:"EVENTS_SINK"`
+	EventsSubject           string        `env:"EVENTS_SUBJECT" envDefault:"gophermart"`
 }
@@ -6,8 +6,12 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// OrderEventsChannel канал LISTEN/NOTIFY для рассылки событий по заказам между репликами.
+const OrderEventsChannel = "order_events"
+
 type DAO struct {
 	dao *sql.DB
+	dsn string
 }
 
 // NewDAO открытие соединения с БД и создание таблиц.
@@ -21,9 +25,34 @@ func NewDAO(dataSourceName string) (*DAO, error) {
 	}
 	tables := []string{
 		UsersTable,
+		UsersAccessColumns,
 		OrdersTable,
+		OrdersPollingColumns,
+		OrdersCallbackColumns,
+		OrderEventsTable,
 		WithdrawsTable,
+		IdempotencyKeysTable,
+		BalanceAdjustmentsTable,
+		WithdrawsStatusColumns,
+		AccrualLotsTable,
+		AccrualLotsHoldColumns,
+		WithdrawalLotsTable,
+		OrderReturnsTable,
+		OrderReturnsGoodsColumn,
+		BalanceTransfersTable,
 		UserTokens,
+		APIKeysTable,
+		RateLimitsTable,
+		UserIdentitiesTable,
+		OIDCStatesTable,
+		UserTOTPTable,
+		RecoveryCodesTable,
+		TwoFactorChallengesTable,
+		WebhooksTable,
+		WebhookDeliveriesTable,
+		OutboxTable,
+		OutboxClaimColumn,
+		AccrualRegistrationsTable,
 	}
 	for _, table := range tables {
 		if _, err = db.Exec(table); err != nil {
@@ -32,5 +61,6 @@ func NewDAO(dataSourceName string) (*DAO, error) {
 	}
 	return &DAO{
 		dao: db,
+		dsn: dataSourceName,
 	}, nil
 }
@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// ClaimAccrualRegistrations метод DAO выборки очередной порции заказов для регистрации в системе начислений.
+// Выбранные записи откладываются на lease, чтобы их не забрала другая реплика.
+func (d *DAO) ClaimAccrualRegistrations(limit int, lease time.Duration) ([]types.AccrualRegistration, error) {
+	var regs []types.AccrualRegistration
+	rows, err := d.dao.Query(
+		`WITH due AS (
+	SELECT id FROM accrual_registrations
+	WHERE status = $1 AND next_attempt_at <= now()
+	ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+)
+UPDATE accrual_registrations r SET next_attempt_at = now() + make_interval(secs => $3)
+FROM due
+WHERE r.id = due.id
+RETURNING r.id, r.order_number, r.goods, r.attempts`,
+		types.AccrualRegistrationPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var reg types.AccrualRegistration
+		var goods string
+		if err = rows.Scan(&reg.ID, &reg.OrderNumber, &goods, &reg.Attempts); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(goods), &reg.Goods); err != nil {
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+// MarkAccrualRegistered метод DAO фиксации успешной регистрации заказа в системе начислений.
+func (d *DAO) MarkAccrualRegistered(id int64) error {
+	_, err := d.dao.Exec(
+		"UPDATE accrual_registrations SET status = $1, attempts = attempts + 1, last_error = NULL, "+
+			"registered_at = now() WHERE id = ($2)",
+		types.AccrualRegistrationDone, id)
+	return err
+}
+
+// MarkAccrualRegistrationFailed метод DAO фиксации неудачной попытки регистрации заказа.
+// При retryAfter == 0 регистрация считается окончательно неудавшейся.
+func (d *DAO) MarkAccrualRegistrationFailed(id int64, lastErr string, retryAfter time.Duration) error {
+	status := types.AccrualRegistrationPending
+	if retryAfter == 0 {
+		status = types.AccrualRegistrationFailed
+	}
+	_, err := d.dao.Exec(
+		"UPDATE accrual_registrations SET status = $1, attempts = attempts + 1, last_error = $2, "+
+			"next_attempt_at = now() + make_interval(secs => $3) WHERE id = ($4)",
+		status, lastErr, retryAfter.Seconds(), id)
+	return err
+}
+
+// insertAccrualRegistration метод-helper DAO постановки заказа в outbox регистрации
+// в системе начислений в рамках транзакции tx.
+func insertAccrualRegistration(tx *sql.Tx, orderNumber string, goods []types.Good) error {
+	if goods == nil {
+		goods = []types.Good{}
+	}
+	data, err := json.Marshal(goods)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO accrual_registrations (order_number, goods) VALUES ($1, $2) "+
+			"ON CONFLICT (order_number) DO NOTHING",
+		orderNumber, string(data))
+	return err
+}
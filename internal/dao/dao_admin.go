@@ -0,0 +1,181 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// adminSearchLimit максимальное количество пользователей в результатах поиска.
+const adminSearchLimit = 100
+
+// SearchUsers метод DAO поиска пользователей по вхождению строки в логин.
+func (d *DAO) SearchUsers(login string) ([]types.AdminUser, error) {
+	var users []types.AdminUser
+	rows, err := d.dao.Query(
+		"SELECT id, login, role, blocked FROM users WHERE login ILIKE '%' || $1 || '%' ORDER BY login LIMIT $2",
+		login, adminSearchLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var u types.AdminUser
+		if err = rows.Scan(&u.ID, &u.Login, &u.Role, &u.Blocked); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetAdminUser метод DAO получения сведений о пользователе по идентификатору.
+func (d *DAO) GetAdminUser(userID int) (*types.AdminUser, error) {
+	var u types.AdminUser
+	err := d.dao.QueryRow(
+		"SELECT id, login, role, blocked FROM users WHERE id = ($1)", userID).
+		Scan(&u.ID, &u.Login, &u.Role, &u.Blocked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SetUserBlocked метод DAO блокировки или разблокировки пользователя.
+func (d *DAO) SetUserBlocked(userID int, blocked bool) error {
+	res, err := d.dao.Exec("UPDATE users SET blocked = $1 WHERE id = ($2)", blocked, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrUserNotFound
+	}
+	return nil
+}
+
+// SetUserRole метод DAO назначения роли пользователю.
+func (d *DAO) SetUserRole(userID int, role string) error {
+	res, err := d.dao.Exec("UPDATE users SET role = $1 WHERE id = ($2)", role, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrUserNotFound
+	}
+	return nil
+}
+
+// ScheduleOrderRepoll метод DAO постановки заказа на внеочередной опрос системы начислений.
+// Непринятый заказ возвращается в статус NEW, обработанный заказ повторно не опрашивается.
+func (d *DAO) ScheduleOrderRepoll(orderNumber string) error {
+	var status string
+	err := d.dao.QueryRow(
+		"UPDATE orders SET status = CASE WHEN status = $1 THEN $2 ELSE status END, "+
+			"polled_at = NULL, callback_at = NULL WHERE order_number = ($3) AND status <> $4 RETURNING status",
+		"INVALID", "NEW", orderNumber, "PROCESSED").Scan(&status)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err = d.dao.QueryRow(
+		"SELECT status FROM orders WHERE order_number = ($1)", orderNumber).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.ErrOrderNotFound
+		}
+		return err
+	}
+	return types.ErrOrderAlreadyProcessed
+}
+
+// NewBalanceAdjustment метод DAO сохранения ручной корректировки баланса пользователя.
+func (d *DAO) NewBalanceAdjustment(adj *types.BalanceAdjustment) error {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var t time.Time
+	err = tx.QueryRow(
+		"INSERT INTO balance_adjustments (user_id, amount, reason, operator_id) "+
+			"SELECT $1::integer, $2::real, $3::text, $4::integer WHERE EXISTS (SELECT 1 FROM users WHERE id = $1) "+
+			"RETURNING id, created_at",
+		adj.UserID, adj.Amount, adj.Reason, adj.OperatorID).Scan(&adj.ID, &t)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.ErrUserNotFound
+		}
+		return err
+	}
+	adj.CreatedAt = t.Local().Format(time.RFC3339)
+	if err = insertOutbox(tx, types.EventBalanceAdjusted, adj.UserID, adj); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBalanceAdjustments метод DAO получения списка корректировок баланса пользователя.
+func (d *DAO) GetBalanceAdjustments(userID int) ([]types.BalanceAdjustment, error) {
+	var adjs []types.BalanceAdjustment
+	rows, err := d.dao.Query(
+		"SELECT id, user_id, amount, reason, operator_id, created_at FROM balance_adjustments "+
+			"WHERE user_id = ($1) ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var adj types.BalanceAdjustment
+		var t time.Time
+		if err = rows.Scan(&adj.ID, &adj.UserID, &adj.Amount, &adj.Reason, &adj.OperatorID, &t); err != nil {
+			return nil, err
+		}
+		adj.CreatedAt = t.Local().Format(time.RFC3339)
+		adjs = append(adjs, adj)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return adjs, nil
+}
+
+// InvalidateOrder метод DAO ручного перевода заказа в статус INVALID с обнулением начисления.
+// Возвращает событие изменения заказа либо nil, если заказ уже был в этом состоянии.
+func (d *DAO) InvalidateOrder(orderNumber string) (*types.OrderEvent, error) {
+	e, err := d.updateOrderState(&types.AccrualOrderState{Order: orderNumber, Status: "INVALID"}, types.LotPolicy{}, true)
+	if err != nil || e != nil {
+		return e, err
+	}
+	var exists bool
+	err = d.dao.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM orders WHERE order_number = ($1))", orderNumber).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, types.ErrOrderNotFound
+	}
+	return nil, nil
+}
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// NewAPIKey метод DAO сохранения нового API-ключа с хешем секрета secretHash.
+// Срок действия передается как timestamptz, чтобы смещение часового пояса из запроса учитывалось
+// при сравнении с now() БД.
+func (d *DAO) NewAPIKey(k *types.APIKey, secretHash string, expiresAt *time.Time) error {
+	var t time.Time
+	err := d.dao.QueryRow(
+		"INSERT INTO api_keys (user_id, name, prefix, secret_hash, scopes, expires_at) "+
+			"VALUES ($1, $2, $3, $4, $5, $6::timestamptz) RETURNING id, created_at",
+		k.UserID, k.Name, k.Prefix, secretHash, pq.Array(k.Scopes), expiresAt).Scan(&k.ID, &t)
+	if err != nil {
+		return err
+	}
+	k.CreatedAt = t.Local().Format(time.RFC3339)
+	return nil
+}
+
+// GetAPIKeys метод DAO получения списка действующих API-ключей пользователя.
+func (d *DAO) GetAPIKeys(userID int) ([]types.APIKey, error) {
+	var keys []types.APIKey
+	rows, err := d.dao.Query(
+		"SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at FROM api_keys "+
+			"WHERE user_id = ($1) AND revoked_at IS NULL ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		k := types.APIKey{UserID: userID}
+		var expiresAt, lastUsedAt sql.NullTime
+		var t time.Time
+		err = rows.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &expiresAt, &lastUsedAt, &t)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = expiresAt.Time.Local().Format(time.RFC3339)
+		}
+		if lastUsedAt.Valid {
+			k.LastUsedAt = lastUsedAt.Time.Local().Format(time.RFC3339)
+		}
+		k.CreatedAt = t.Local().Format(time.RFC3339)
+		keys = append(keys, k)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey метод DAO отзыва API-ключа пользователя.
+func (d *DAO) RevokeAPIKey(userID, keyID int) error {
+	res, err := d.dao.Exec(
+		"UPDATE api_keys SET revoked_at = now() WHERE id = ($1) AND user_id = ($2) AND revoked_at IS NULL",
+		keyID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// GetAPIKeyPrincipal метод DAO получения владельца и хеша секрета действующего API-ключа по его префиксу.
+// Для заблокированного владельца возвращает ErrUserBlocked, для просроченного ключа — ErrAPIKeyExpired.
+func (d *DAO) GetAPIKeyPrincipal(prefix string) (*types.Principal, string, error) {
+	var p types.Principal
+	var secretHash string
+	var blocked, expired bool
+	err := d.dao.QueryRow(
+		"SELECT k.id, k.secret_hash, k.scopes, coalesce(k.expires_at < now(), false), "+
+			"u.id, u.login, u.role, u.blocked FROM api_keys k JOIN users u ON u.id = k.user_id "+
+			"WHERE k.prefix = ($1) AND k.revoked_at IS NULL", prefix).
+		Scan(&p.APIKeyID, &secretHash, pq.Array(&p.Scopes), &expired, &p.UserID, &p.Login, &p.Role, &blocked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", types.ErrAPIKeyInvalid
+		}
+		return nil, "", err
+	}
+	if blocked {
+		return nil, "", types.ErrUserBlocked
+	}
+	if expired {
+		return nil, "", types.ErrAPIKeyExpired
+	}
+	return &p, secretHash, nil
+}
+
+// TouchAPIKey метод DAO учета использования API-ключа.
+func (d *DAO) TouchAPIKey(keyID int) error {
+	_, err := d.dao.Exec("UPDATE api_keys SET last_used_at = now() WHERE id = ($1)", keyID)
+	return err
+}
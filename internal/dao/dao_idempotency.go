@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// BeginIdempotentRequest метод DAO начала выполнения запроса пользователя с ключом идемпотентности.
+// Для нового ключа сохраняет хеш запроса и возвращает nil. Для известного ключа возвращает сохраненный ответ,
+// ErrIdempotencyKeyMismatch, если ключ использован с другим запросом, либо ErrIdempotencyKeyInProgress,
+// если запрос еще выполняется. Ключи старше ttl не учитываются.
+func (d *DAO) BeginIdempotentRequest(userID int, key, requestHash string, ttl time.Duration) (*types.IdempotentResponse, error) {
+	_, err := d.dao.Exec(
+		"DELETE FROM idempotency_keys WHERE user_id = ($1) AND created_at < now() - make_interval(secs => $2)",
+		userID, ttl.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	res, err := d.dao.Exec(
+		"INSERT INTO idempotency_keys (user_id, key, request_hash) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (user_id, key) DO NOTHING",
+		userID, key, requestHash)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 1 {
+		return nil, nil
+	}
+	var hash string
+	var status sql.NullInt32
+	var contentType sql.NullString
+	var body []byte
+	err = d.dao.QueryRow(
+		"SELECT request_hash, status, content_type, body FROM idempotency_keys WHERE user_id = ($1) AND key = ($2)",
+		userID, key).Scan(&hash, &status, &contentType, &body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// ключ освобожден параллельным запросом между вставкой и чтением
+			return nil, types.ErrIdempotencyKeyInProgress
+		}
+		return nil, err
+	}
+	if hash != requestHash {
+		return nil, types.ErrIdempotencyKeyMismatch
+	}
+	if !status.Valid {
+		return nil, types.ErrIdempotencyKeyInProgress
+	}
+	return &types.IdempotentResponse{
+		Status:      int(status.Int32),
+		ContentType: contentType.String,
+		Body:        body,
+	}, nil
+}
+
+// CompleteIdempotentRequest метод DAO сохранения ответа на запрос с ключом идемпотентности.
+func (d *DAO) CompleteIdempotentRequest(userID int, key string, resp *types.IdempotentResponse) error {
+	_, err := d.dao.Exec(
+		"UPDATE idempotency_keys SET status = ($3), content_type = NULLIF($4, ''), body = ($5) "+
+			"WHERE user_id = ($1) AND key = ($2)",
+		userID, key, resp.Status, resp.ContentType, resp.Body)
+	return err
+}
+
+// ReleaseIdempotencyKey метод DAO освобождения ключа идемпотентности запроса, завершившегося без результата,
+// чтобы повторный запрос был выполнен заново.
+func (d *DAO) ReleaseIdempotencyKey(userID int, key string) error {
+	_, err := d.dao.Exec(
+		"DELETE FROM idempotency_keys WHERE user_id = ($1) AND key = ($2) AND status IS NULL", userID, key)
+	return err
+}
@@ -4,20 +4,45 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"math"
+	"strconv"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/lipandr/yandex-practicum-diploma/internal/types"
 )
 
-// NewUser метод DAO добавления нового пользователя.
-func (d *DAO) NewUser(userID, encPass string) (int, error) {
+// Ping метод DAO проверки соединения с БД.
+func (d *DAO) Ping() error {
+	return d.dao.Ping()
+}
+
+// NewUser метод DAO добавления нового пользователя с ролью role.
+func (d *DAO) NewUser(userID, encPass, role string) (int, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	var id int
-	err := d.dao.QueryRow(
-		"INSERT INTO users (login, encrypted_password) VALUES ($1, $2) ON CONFLICT (login) DO NOTHING RETURNING id;",
-		userID, encPass).Scan(&id)
+	err = tx.QueryRow(
+		"INSERT INTO users (login, encrypted_password, role) VALUES ($1, $2, $3) ON CONFLICT (login) DO NOTHING RETURNING id;",
+		userID, encPass, role).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	err = insertOutbox(tx, types.EventUserRegistered, id, map[string]interface{}{
+		"user_id": id,
+		"login":   userID,
+	})
 	if err != nil {
 		return 0, err
 	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
@@ -43,27 +68,112 @@ func (d *DAO) SaveToken(userID int, token string) error {
 	return nil
 }
 
-// GetToken метод DAO получения сохраненного токена пользователя.
-func (d *DAO) GetToken(token string) (int, error) {
-	var userID int
+// GetToken метод DAO получения пользователя, которому выдан токен.
+// Для заблокированного пользователя возвращает ErrUserBlocked.
+func (d *DAO) GetToken(token string) (*types.Principal, error) {
+	var p types.Principal
+	var blocked bool
 	err := d.dao.QueryRow(
-		"SELECT user_id FROM tokens WHERE token = ($1)", token).Scan(&userID)
+		"SELECT t.user_id, u.login, u.role, u.blocked FROM tokens t JOIN users u ON u.id = t.user_id "+
+			"WHERE t.token = ($1)", token).
+		Scan(&p.UserID, &p.Login, &p.Role, &blocked)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return userID, nil
+	if blocked {
+		return nil, types.ErrUserBlocked
+	}
+	return &p, nil
 }
 
 // NewOrder метод DAO сохранения нового заказа для расчета начислений.
-func (d *DAO) NewOrder(userID int, orderNumber string) error {
-	_, err := d.dao.Exec(
+// При register заказ вместе с составом goods ставится в outbox регистрации в системе начислений.
+func (d *DAO) NewOrder(userID int, orderNumber string, goods []types.Good, register bool) error {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(
 		"INSERT INTO orders (order_number, user_id, status) "+
 			"VALUES ($1, $2, $3);",
 		orderNumber, userID, "NEW")
 	if err != nil {
 		return err
 	}
-	return nil
+	if err = insertOrderUploaded(tx, userID, orderNumber); err != nil {
+		return err
+	}
+	if register {
+		if err = insertAccrualRegistration(tx, orderNumber, goods); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertOrderUploaded метод-helper DAO записи в outbox события загрузки заказа.
+func insertOrderUploaded(tx *sql.Tx, userID int, orderNumber string) error {
+	return insertOutbox(tx, types.EventOrderUploaded, userID, map[string]interface{}{
+		"number":  orderNumber,
+		"user_id": userID,
+	})
+}
+
+// NewOrders метод DAO сохранения пакета заказов в одной транзакции.
+// Для каждого номера возвращается nil, если заказ принят, либо ошибка, описывающая причину отказа.
+// При register принятые заказы ставятся в outbox регистрации в системе начислений.
+func (d *DAO) NewOrders(userID int, orderNumbers []string, register bool) ([]error, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res := make([]error, len(orderNumbers))
+	for i, orderNumber := range orderNumbers {
+		if err = isOrderWithdrawn(tx, orderNumber); err != nil {
+			if errors.Is(err, types.ErrOrderAlreadyWithdrawn) {
+				res[i] = err
+				continue
+			}
+			return nil, err
+		}
+		var ownerID int
+		err = tx.QueryRow(
+			"INSERT INTO orders (order_number, user_id, status) VALUES ($1, $2, $3) "+
+				"ON CONFLICT (order_number) DO NOTHING RETURNING user_id;",
+			orderNumber, userID, "NEW").Scan(&ownerID)
+		if err == nil {
+			if err = insertOrderUploaded(tx, userID, orderNumber); err != nil {
+				return nil, err
+			}
+			if register {
+				if err = insertAccrualRegistration(tx, orderNumber, nil); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		err = tx.QueryRow(
+			"SELECT user_id FROM orders WHERE order_number = ($1)", orderNumber).Scan(&ownerID)
+		if err != nil {
+			return nil, err
+		}
+		if ownerID == userID {
+			res[i] = types.ErrOrderUploadedByUser
+		} else {
+			res[i] = types.ErrOrderUploadedByOtherUser
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 // IsOrderExists метод DAO проверки сохраненного заказа.
@@ -88,11 +198,43 @@ func (d *DAO) IsOrderExists(userID int, orderNumber string) error {
 	return nil
 }
 
+// GetOrder метод DAO получения заказа пользователя по номеру.
+func (d *DAO) GetOrder(userID int, orderNumber string) (*types.OrderInfo, error) {
+	var o types.OrderInfo
+	var uploadedAt time.Time
+	var polledAt sql.NullTime
+	var f orderReturnFields
+	err := d.dao.QueryRow(
+		"SELECT o.order_number, o.status, o.accrual, o.uploaded_at, o.polled_at, o.accrual_attempts, "+
+			orderReturnColumns+" FROM orders o "+orderReturnsJoin+
+			" WHERE o.order_number = ($1) AND o.user_id = ($2)", orderNumber, userID).
+		Scan(append([]interface{}{&o.OrderNumber, &o.Status, &o.Accrual, &uploadedAt, &polledAt, &o.AccrualAttempts},
+			f.dest()...)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrOrderNotFound
+		}
+		return nil, err
+	}
+	o.UploadedAt = uploadedAt.Local().Format(time.RFC3339)
+	if polledAt.Valid {
+		o.PolledAt = polledAt.Time.Local().Format(time.RFC3339)
+	}
+	o.Return = f.orderReturn()
+	return &o, nil
+}
+
 // IsOrderWithdrawn метод DAO проверки осуществленных списаний по номеру заказа.
 func (d *DAO) IsOrderWithdrawn(orderNumber string) error {
+	return isOrderWithdrawn(d.dao, orderNumber)
+}
+
+// isOrderWithdrawn метод-helper проверки списаний по номеру заказа; отмененные списания не учитываются.
+func isOrderWithdrawn(q queryRower, orderNumber string) error {
 	var o string
-	err := d.dao.QueryRow(
-		"SELECT order_number FROM withdraws WHERE order_number = ($1)", orderNumber).
+	err := q.QueryRow(
+		"SELECT order_number FROM withdraws WHERE order_number = ($1) AND status <> ($2)",
+		orderNumber, types.WithdrawalCancelled).
 		Scan(&o)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -110,7 +252,8 @@ func (d *DAO) IsOrderWithdrawn(orderNumber string) error {
 func (d *DAO) GetOrderList(userID int) ([]types.Order, error) {
 	var orders []types.Order
 	rows, err := d.dao.Query(
-		"SELECT order_number, status, accrual, uploaded_at from orders where user_id = ($1) ORDER BY uploaded_at ;", userID)
+		"SELECT o.order_number, o.status, o.accrual, o.uploaded_at, "+orderReturnColumns+" FROM orders o "+
+			orderReturnsJoin+" WHERE o.user_id = ($1) ORDER BY o.uploaded_at", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -119,11 +262,13 @@ func (d *DAO) GetOrderList(userID int) ([]types.Order, error) {
 	for rows.Next() {
 		var o types.Order
 		var t time.Time
-		err = rows.Scan(&o.OrderNumber, &o.Status, &o.Accrual, &t)
+		var f orderReturnFields
+		err = rows.Scan(append([]interface{}{&o.OrderNumber, &o.Status, &o.Accrual, &t}, f.dest()...)...)
 		if err != nil {
 			return nil, err
 		}
 		o.UploadedAt = t.Local().Format(time.RFC3339)
+		o.Return = f.orderReturn()
 		orders = append(orders, o)
 	}
 	err = rows.Err()
@@ -134,10 +279,12 @@ func (d *DAO) GetOrderList(userID int) ([]types.Order, error) {
 }
 
 // GetTotalWithdrawals метод DAO получения суммы списаний, осуществленных пользователем.
+// Отмененные списания не учитываются; сторнированные учитываются, так как баллы по ним возвращены корректировкой.
 func (d *DAO) GetTotalWithdrawals(userID int) (float64, error) {
 	var w float64
 	err := d.dao.QueryRow(
-		"SELECT coalesce(SUM(sum), 0.00) FROM withdraws WHERE user_id = ($1)", userID).
+		"SELECT coalesce(SUM(sum), 0.00) FROM withdraws WHERE user_id = ($1) AND status <> ($2)",
+		userID, types.WithdrawalCancelled).
 		Scan(&w)
 	if err != nil {
 		return 0, err
@@ -145,48 +292,130 @@ func (d *DAO) GetTotalWithdrawals(userID int) (float64, error) {
 	return w, nil
 }
 
-// GetAccruals метод DAO получения суммы начислений пользователя.
-func (d *DAO) GetAccruals(userID int) (float64, error) {
-	var a float64
-	err := d.dao.QueryRow(
-		"SELECT SUM(accrual) FROM orders WHERE user_id = ($1)", userID).
-		Scan(&a)
-	if err != nil {
+// availableBalanceQuery запрос доступного для списания баланса пользователя $1: начисления с корректировками
+// и полученными переводами за вычетом списаний, сгоревших, удерживаемых и отозванных по возвратам баллов
+// и отправленных переводов. Единственное место, где определяется формула баланса.
+const availableBalanceQuery = "SELECT " +
+	"coalesce((SELECT SUM(accrual)::double precision FROM orders WHERE user_id = ($1)), 0) + " +
+	"coalesce((SELECT SUM(amount)::double precision FROM balance_adjustments WHERE user_id = ($1)), 0) - " +
+	"coalesce((SELECT SUM(sum)::double precision FROM withdraws WHERE user_id = ($1) AND status <> ($2)), 0) - " +
+	"coalesce((SELECT SUM(expired_amount)::double precision FROM accrual_lots WHERE user_id = ($1)), 0) - " +
+	"coalesce((SELECT SUM(remaining)::double precision FROM accrual_lots " +
+	"WHERE user_id = ($1) AND available_at > now()), 0) - " +
+	"coalesce((SELECT SUM(clawback)::double precision FROM order_returns WHERE user_id = ($1)), 0) - " +
+	"coalesce((SELECT SUM(amount)::double precision FROM balance_transfers WHERE from_user_id = ($1)), 0) + " +
+	"coalesce((SELECT SUM(amount)::double precision FROM balance_transfers WHERE to_user_id = ($1)), 0)"
+
+// queryRower общий интерфейс *sql.DB и *sql.Tx для запросов одной строки.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// availableBalance метод-helper получения доступного для списания баланса пользователя.
+// В транзакции вызывается после lockUsers, чтобы баланс не изменился до ее завершения.
+func availableBalance(q queryRower, userID int) (float64, error) {
+	var b float64
+	if err := q.QueryRow(availableBalanceQuery, userID, types.WithdrawalCancelled).Scan(&b); err != nil {
 		return 0, err
 	}
-	return a, nil
+	return math.Round(b*100) / 100, nil
+}
+
+// lockUsers метод-helper блокировки строк пользователей до конца транзакции в порядке возрастания
+// идентификаторов, чтобы встречные операции не приводили к взаимоблокировке. Операции, меняющие баланс
+// пользователя, блокируют его строку до проверки баланса.
+func lockUsers(tx *sql.Tx, ids ...int) error {
+	rows, err := tx.Query("SELECT id FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return err
+		}
+	}
+	_ = rows.Close()
+	return rows.Err()
+}
+
+// GetAvailableBalance метод DAO получения доступного для списания баланса пользователя.
+func (d *DAO) GetAvailableBalance(userID int) (float64, error) {
+	return availableBalance(d.dao, userID)
 }
 
-// NewWithdrawal метод DAO добавления нового списания пользователя.
+// NewWithdrawal метод DAO добавления нового списания пользователя в статусе WithdrawalPending.
+// Баланс проверяется после блокировки строки пользователя, поэтому одновременные списания и переводы
+// не уводят его в минус; при нехватке баллов возвращает ErrInsufficientAccruals.
+// Списание расходует партии начисленных баллов начиная с ближайших к сгоранию.
 func (d *DAO) NewWithdrawal(userID int, sum float64, orderNumber string) error {
-	_, err := d.dao.Exec(
-		"INSERT INTO withdraws (user_id, order_number, sum, processed_at) VALUES ($1, $2, $3, $4);",
-		userID, orderNumber, sum, time.Now())
+	tx, err := d.dao.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer func() { _ = tx.Rollback() }()
+
+	if err = lockUsers(tx, userID); err != nil {
+		return err
+	}
+	balance, err := availableBalance(tx, userID)
+	if err != nil {
+		return err
+	}
+	if balance < sum {
+		return types.ErrInsufficientAccruals
+	}
+
+	w := types.Withdraw{
+		OrderNumber: orderNumber,
+		Sum:         sum,
+		Status:      types.WithdrawalPending,
+	}
+	// время списания берется из часов БД: с ними сравнивается срок отмены списания
+	var id int
+	var t time.Time
+	err = tx.QueryRow(
+		"INSERT INTO withdraws (user_id, order_number, sum, status) VALUES ($1, $2, $3, $4) RETURNING id, processed_at;",
+		userID, orderNumber, sum, types.WithdrawalPending).Scan(&id, &t)
+	if err != nil {
+		return err
+	}
+	w.ProcessedAt = t.Local().Format(time.RFC3339)
+	uses, err := consumeLots(tx, userID, sum)
+	if err != nil {
+		return err
+	}
+	if err = insertWithdrawalLots(tx, id, uses); err != nil {
+		return err
+	}
+	if err = enqueueWebhooks(tx, userID, types.WebhookWithdrawalMade, w); err != nil {
+		return err
+	}
+	if err = insertOutbox(tx, types.EventWithdrawalMade, userID, w); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// GetWithdrawalsList метод DAO получения списка списаний пользователя.
+// GetWithdrawalsList метод DAO получения списка списаний пользователя со статусами и сведениями о сторнировании.
 func (d *DAO) GetWithdrawalsList(userID int) ([]types.Withdraw, error) {
 	var wthd []types.Withdraw
 	rows, err := d.dao.Query(
-		"SELECT order_number, sum, processed_at from withdraws where user_id = ($1) ORDER BY processed_at ;", userID)
+		"SELECT "+withdrawColumns+" FROM withdraws w "+
+			"LEFT JOIN balance_adjustments a ON a.id = w.reversal_adjustment_id "+
+			"WHERE w.user_id = ($1) ORDER BY w.processed_at ;", userID)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
 	for rows.Next() {
-		var w types.Withdraw
-		var t time.Time
-		err = rows.Scan(&w.OrderNumber, &w.Sum, &t)
+		w, err := scanWithdraw(rows)
 		if err != nil {
 			return nil, err
 		}
-		w.ProcessedAt = t.Format(time.RFC3339)
-		wthd = append(wthd, w)
+		wthd = append(wthd, *w)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -195,11 +424,27 @@ func (d *DAO) GetWithdrawalsList(userID int) ([]types.Withdraw, error) {
 	return wthd, nil
 }
 
+// CountOrdersForProcessing метод DAO получения количества заказов, ожидающих расчета начислений.
+func (d *DAO) CountOrdersForProcessing() (int, error) {
+	var n int
+	err := d.dao.QueryRow(
+		"SELECT count(*) FROM orders WHERE status IN ($1, $2)", "NEW", "PROCESSING").Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // GetOrdersForProcessing метод DAO получения списка заказов для расчета начислений.
-func (d *DAO) GetOrdersForProcessing(wps int) ([]string, error) {
+// Заказы, опрошенные менее pollInterval назад, пропускаются. Заказы, загруженные или получившие
+// уведомление системы начислений менее callbackDeadline назад, ожидают уведомления и тоже пропускаются.
+func (d *DAO) GetOrdersForProcessing(wps int, pollInterval, callbackDeadline time.Duration) ([]string, error) {
 	var orders []string
 	rows, err := d.dao.Query(
-		"SELECT order_number FROM orders WHERE status IN ($1, $2) ORDER BY uploaded_at LIMIT $3", "NEW", "PROCESSING", wps,
+		"SELECT order_number FROM orders WHERE status IN ($1, $2) "+
+			"AND (polled_at IS NULL OR polled_at < now() - make_interval(secs => $4)) "+
+			"AND coalesce(callback_at, uploaded_at) <= now() - make_interval(secs => $5) "+
+			"ORDER BY uploaded_at LIMIT $3", "NEW", "PROCESSING", wps, pollInterval.Seconds(), callbackDeadline.Seconds(),
 	)
 	if err != nil {
 		return nil, err
@@ -217,13 +462,189 @@ func (d *DAO) GetOrdersForProcessing(wps int) ([]string, error) {
 	return orders, err
 }
 
-// UpdateOrderState метод DAO обновления статуса заказа по результатам расчета начислений.
-func (d *DAO) UpdateOrderState(status *types.AccrualOrderState) error {
-	// TODO rem
-	log.Println("DAO update order status", status)
+// RegisterAccrualAttempt метод DAO учета очередного опроса системы начислений по заказу.
+func (d *DAO) RegisterAccrualAttempt(orderNumber string) error {
 	_, err := d.dao.Exec(
-		"UPDATE orders SET status=$1, accrual=$2 WHERE order_number = ($3)",
-		status.Status, status.Accrual, status.Order,
+		"UPDATE orders SET polled_at = now(), accrual_attempts = accrual_attempts + 1 WHERE order_number = ($1)",
+		orderNumber,
 	)
 	return err
 }
+
+// RegisterAccrualCallback метод DAO учета уведомления системы начислений по заказу.
+func (d *DAO) RegisterAccrualCallback(orderNumber string) error {
+	res, err := d.dao.Exec("UPDATE orders SET callback_at = now() WHERE order_number = ($1)", orderNumber)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrOrderNotFound
+	}
+	return nil
+}
+
+// UpdateOrderState метод DAO обновления статуса заказа по результатам расчета начислений.
+// Если статус или начисление изменились, сохраняет и возвращает событие изменения заказа.
+// Заказы в окончательных статусах PROCESSED и INVALID не меняются: повторные и запоздавшие
+// ответы системы начислений игнорируются.
+func (d *DAO) UpdateOrderState(status *types.AccrualOrderState, policy types.LotPolicy) (*types.OrderEvent, error) {
+	return d.updateOrderState(status, policy, false)
+}
+
+// updateOrderState метод-helper обновления статуса заказа; при override меняется и заказ в окончательном статусе.
+func (d *DAO) updateOrderState(status *types.AccrualOrderState, policy types.LotPolicy, override bool) (*types.OrderEvent, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	e := types.OrderEvent{
+		OrderNumber: status.Order,
+		Status:      status.Status,
+		Accrual:     status.Accrual,
+	}
+	err = tx.QueryRow(
+		"UPDATE orders SET status=$1, accrual=$2 WHERE order_number = ($3) "+
+			"AND (status IS DISTINCT FROM $1 OR accrual IS DISTINCT FROM $2) "+
+			"AND ($4 OR status NOT IN ('PROCESSED', 'INVALID')) RETURNING user_id",
+		status.Status, status.Accrual, status.Order, override,
+	).Scan(&e.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var t time.Time
+	err = tx.QueryRow(
+		"INSERT INTO order_events (user_id, order_number, status, accrual) VALUES ($1, $2, $3, $4) "+
+			"RETURNING id, created_at",
+		e.UserID, e.OrderNumber, e.Status, e.Accrual,
+	).Scan(&e.ID, &t)
+	if err != nil {
+		return nil, err
+	}
+	e.CreatedAt = t.Local().Format(time.RFC3339)
+
+	switch e.Status {
+	case "PROCESSED":
+		err = enqueueWebhooks(tx, e.UserID, types.WebhookOrderProcessed, e)
+	case "INVALID":
+		err = enqueueWebhooks(tx, e.UserID, types.WebhookOrderInvalid, e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = insertOutbox(tx, types.EventOrderStatusChanged, e.UserID, e); err != nil {
+		return nil, err
+	}
+	if e.Status != "PROCESSED" || e.Accrual <= 0 {
+		// начисление по заказу отменено: остаток его партии не должен сгореть повторно
+		if err = dropAccrualLot(tx, e.OrderNumber); err != nil {
+			return nil, err
+		}
+	} else {
+		err = upsertAccrualLot(tx, e.UserID, e.OrderNumber, e.Accrual, policy)
+		if err != nil {
+			return nil, err
+		}
+		err = insertOutbox(tx, types.EventAccrualCredited, e.UserID, map[string]interface{}{
+			"number":  e.OrderNumber,
+			"user_id": e.UserID,
+			"accrual": e.Accrual,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetOrderEvent метод DAO получения события изменения заказа по идентификатору.
+func (d *DAO) GetOrderEvent(id int64) (*types.OrderEvent, error) {
+	var e types.OrderEvent
+	var t time.Time
+	err := d.dao.QueryRow(
+		"SELECT id, user_id, order_number, status, accrual, created_at FROM order_events WHERE id = ($1)", id).
+		Scan(&e.ID, &e.UserID, &e.OrderNumber, &e.Status, &e.Accrual, &t)
+	if err != nil {
+		return nil, err
+	}
+	e.CreatedAt = t.Local().Format(time.RFC3339)
+	return &e, nil
+}
+
+// GetOrderEvents метод DAO получения событий по заказам пользователя, произошедших после указанного.
+func (d *DAO) GetOrderEvents(userID int, afterID int64) ([]types.OrderEvent, error) {
+	var events []types.OrderEvent
+	rows, err := d.dao.Query(
+		"SELECT id, user_id, order_number, status, accrual, created_at FROM order_events "+
+			"WHERE user_id = ($1) AND id > ($2) ORDER BY id", userID, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var e types.OrderEvent
+		var t time.Time
+		if err = rows.Scan(&e.ID, &e.UserID, &e.OrderNumber, &e.Status, &e.Accrual, &t); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = t.Local().Format(time.RFC3339)
+		events = append(events, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// NotifyOrderEvent метод DAO оповещения всех реплик о событии по заказу через NOTIFY.
+func (d *DAO) NotifyOrderEvent(id int64) error {
+	_, err := d.dao.Exec("SELECT pg_notify($1, $2)", OrderEventsChannel, strconv.FormatInt(id, 10))
+	return err
+}
+
+// ListenOrderEvents метод DAO подписки на события по заказам через LISTEN.
+// Для каждого полученного уведомления вызывается fn с событием, прочитанным из БД.
+func (d *DAO) ListenOrderEvents(fn func(e *types.OrderEvent)) error {
+	l := pq.NewListener(d.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("order events listener:", err)
+		}
+	})
+	if err := l.Listen(OrderEventsChannel); err != nil {
+		_ = l.Close()
+		return err
+	}
+	go func() {
+		for n := range l.Notify {
+			// nil приходит после переподключения, пропущенные события клиенты получат по Last-Event-ID
+			if n == nil {
+				continue
+			}
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				log.Println("order events listener:", err)
+				continue
+			}
+			e, err := d.GetOrderEvent(id)
+			if err != nil {
+				log.Println("order events listener:", err)
+				continue
+			}
+			fn(e)
+		}
+	}()
+	return nil
+}
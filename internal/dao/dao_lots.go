@@ -0,0 +1,365 @@
+package dao
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// upsertAccrualLot метод-helper приведения партии баллов заказа к начислению amount.
+// Новая партия становится доступной по окончании policy.HoldPeriod и сгорает через policy.ExpiryMonths месяцев.
+// При изменении начисления остаток партии меняется на разницу, но не становится отрицательным.
+func upsertAccrualLot(tx *sql.Tx, userID int, orderNumber string, amount float64, policy types.LotPolicy) error {
+	_, err := tx.Exec(
+		"INSERT INTO accrual_lots (user_id, order_number, amount, remaining, available_at, expires_at) "+
+			"VALUES ($1, $2, $3, $3, now() + make_interval(secs => $5), "+
+			"CASE WHEN $4::integer > 0 THEN now() + make_interval(months => $4::integer) END) "+
+			"ON CONFLICT (order_number) DO UPDATE SET "+
+			"remaining = greatest(0, accrual_lots.remaining + excluded.amount - accrual_lots.amount), "+
+			"amount = excluded.amount",
+		userID, orderNumber, amount, policy.ExpiryMonths, policy.HoldPeriod.Seconds())
+	return err
+}
+
+// dropAccrualLot метод-helper обнуления партии баллов заказа, начисление по которому отменено.
+// Вызывается в транзакции изменения статуса заказа, чтобы сгорание не списало те же баллы повторно.
+// Партия не удаляется: на нее могут ссылаться списания.
+func dropAccrualLot(tx *sql.Tx, orderNumber string) error {
+	_, err := tx.Exec(
+		"UPDATE accrual_lots SET amount = 0, remaining = 0, expired_amount = 0 WHERE order_number = ($1)",
+		orderNumber)
+	return err
+}
+
+// BackfillAccrualLots метод DAO создания партий баллов для заказов, обработанных до появления партий.
+// Срок сгорания таких партий отсчитывается от момента переноса, чтобы давно начисленные баллы
+// не сгорели без предупреждения. Остатком партий становится неизрасходованная часть баланса,
+// не покрытая существующими партиями; она распределяется с самых новых заказов, так как
+// расход идет с самых старых. Повторный вызов новых партий не создает.
+// Возвращает количество созданных партий.
+func (d *DAO) BackfillAccrualLots(expiryMonths int) (int, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(
+		"INSERT INTO accrual_lots (user_id, order_number, amount, remaining, accrued_at, available_at, expires_at) "+
+			"SELECT o.user_id, o.order_number, o.accrual, 0, o.uploaded_at, o.uploaded_at, "+
+			"CASE WHEN $1::integer > 0 THEN now() + make_interval(months => $1::integer) END FROM orders o "+
+			"WHERE o.status = 'PROCESSED' AND o.accrual > 0 "+
+			"AND NOT EXISTS (SELECT 1 FROM accrual_lots l WHERE l.order_number = o.order_number) "+
+			"ON CONFLICT (order_number) DO NOTHING RETURNING id, user_id, amount, accrued_at",
+		expiryMonths)
+	if err != nil {
+		return 0, err
+	}
+	type lot struct {
+		id        int
+		amount    float64
+		accruedAt time.Time
+	}
+	byUser := make(map[int][]lot)
+	var userIDs []int
+	count := 0
+	for rows.Next() {
+		var l lot
+		var userID int
+		if err = rows.Scan(&l.id, &userID, &l.amount, &l.accruedAt); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if _, ok := byUser[userID]; !ok {
+			userIDs = append(userIDs, userID)
+		}
+		byUser[userID] = append(byUser[userID], l)
+		count++
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err = lockUsers(tx, userIDs...); err != nil {
+		return 0, err
+	}
+	for _, userID := range userIDs {
+		b, err := availableBalance(tx, userID)
+		if err != nil {
+			return 0, err
+		}
+		var covered float64
+		err = tx.QueryRow(
+			"SELECT coalesce(SUM(remaining), 0.00) FROM accrual_lots WHERE user_id = ($1) AND available_at <= now()",
+			userID).Scan(&covered)
+		if err != nil {
+			return 0, err
+		}
+		lots := byUser[userID]
+		sort.Slice(lots, func(i, j int) bool {
+			if !lots[i].accruedAt.Equal(lots[j].accruedAt) {
+				return lots[i].accruedAt.After(lots[j].accruedAt)
+			}
+			return lots[i].id > lots[j].id
+		})
+		full := make([]lotBalance, len(lots))
+		for i, l := range lots {
+			full[i] = lotBalance{id: l.id, remaining: l.amount, available: true}
+		}
+		for _, u := range allocateLots(full, b-covered) {
+			if _, err = tx.Exec("UPDATE accrual_lots SET remaining = ($2) WHERE id = ($1)", u.lotID, u.amount); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// lotUse расход партии баллов lotID на сумму amount.
+type lotUse struct {
+	lotID  int
+	amount float64
+}
+
+// consumeLots метод-helper расхода доступных партий баллов пользователя на сумму sum в порядке сгорания.
+// Сумма, превышающая остатки партий, списывается с баллов без срока сгорания, например корректировок.
+func consumeLots(tx *sql.Tx, userID int, sum float64) ([]lotUse, error) {
+	rows, err := tx.Query(
+		"SELECT id, remaining, available_at <= now() FROM accrual_lots WHERE user_id = ($1) AND remaining > 0 "+
+			"ORDER BY expires_at NULLS LAST, id FOR UPDATE", userID)
+	if err != nil {
+		return nil, err
+	}
+	var lots []lotBalance
+	for rows.Next() {
+		var l lotBalance
+		if err = rows.Scan(&l.id, &l.remaining, &l.available); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	remaining := make(map[int]float64, len(lots))
+	for _, l := range lots {
+		remaining[l.id] = l.remaining
+	}
+	uses := allocateLots(lots, sum)
+	for _, u := range uses {
+		_, err = tx.Exec(
+			"UPDATE accrual_lots SET remaining = ($2) WHERE id = ($1)",
+			u.lotID, math.Round((remaining[u.lotID]-u.amount)*100)/100)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return uses, nil
+}
+
+// lotBalance остаток remaining партии баллов id; available - период удержания партии истек.
+type lotBalance struct {
+	id        int
+	remaining float64
+	available bool
+}
+
+// allocateLots метод-helper распределения суммы sum по остаткам партий lots в переданном порядке:
+// каждая партия расходуется полностью, прежде чем начнется следующая. Партии на удержании пропускаются;
+// сумма, превышающая остатки доступных партий, не распределяется.
+func allocateLots(lots []lotBalance, sum float64) []lotUse {
+	var uses []lotUse
+	left := math.Round(sum*100) / 100
+	for _, l := range lots {
+		if left <= 0 {
+			break
+		}
+		if !l.available {
+			continue
+		}
+		take := math.Round(math.Min(left, l.remaining)*100) / 100
+		uses = append(uses, lotUse{lotID: l.id, amount: take})
+		left = math.Round((left-take)*100) / 100
+	}
+	return uses
+}
+
+// insertWithdrawalLots метод-helper учета партий баллов uses, израсходованных списанием withdrawID.
+func insertWithdrawalLots(tx *sql.Tx, withdrawID int, uses []lotUse) error {
+	for _, u := range uses {
+		_, err := tx.Exec(
+			"INSERT INTO withdrawal_lots (withdraw_id, lot_id, amount) VALUES ($1, $2, $3)",
+			withdrawID, u.lotID, u.amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreLots метод-helper возврата в партии баллов, израсходованных отмененным списанием withdrawID.
+// Баллы партий с истекшим сроком сгорят при следующем запуске ExpireLots.
+func restoreLots(tx *sql.Tx, withdrawID int) error {
+	_, err := tx.Exec(
+		"UPDATE accrual_lots l SET remaining = l.remaining + wl.amount "+
+			"FROM withdrawal_lots wl WHERE wl.lot_id = l.id AND wl.withdraw_id = ($1)", withdrawID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM withdrawal_lots WHERE withdraw_id = ($1)", withdrawID)
+	return err
+}
+
+// ExpireLots метод DAO сгорания остатков партий баллов с истекшим сроком.
+// Возвращает количество партий, баллы которых сгорели.
+func (d *DAO) ExpireLots() (int, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(
+		"WITH due AS (SELECT id, remaining FROM accrual_lots WHERE expires_at <= now() AND remaining > 0 FOR UPDATE) " +
+			"UPDATE accrual_lots l SET expired_amount = l.expired_amount + due.remaining, remaining = 0, expired_at = now() " +
+			"FROM due WHERE l.id = due.id RETURNING l.user_id, l.order_number, due.remaining, l.expires_at")
+	if err != nil {
+		return 0, err
+	}
+	type expired struct {
+		userID    int
+		order     string
+		amount    float64
+		expiresAt time.Time
+	}
+	var lots []expired
+	for rows.Next() {
+		var e expired
+		if err = rows.Scan(&e.userID, &e.order, &e.amount, &e.expiresAt); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		lots = append(lots, e)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, e := range lots {
+		err = insertOutbox(tx, types.EventPointsExpired, e.userID, map[string]interface{}{
+			"user_id":    e.userID,
+			"order":      e.order,
+			"amount":     e.amount,
+			"expires_at": e.expiresAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(lots), nil
+}
+
+// GetPendingPoints метод DAO получения суммы баллов пользователя, период удержания которых не истек.
+func (d *DAO) GetPendingPoints(userID int) (float64, error) {
+	return pendingPoints(d.dao, userID)
+}
+
+// pendingPoints метод-helper получения суммы баллов пользователя на удержании.
+func pendingPoints(q queryRower, userID int) (float64, error) {
+	var p float64
+	err := q.QueryRow(
+		"SELECT coalesce(SUM(remaining), 0.00) FROM accrual_lots WHERE user_id = ($1) AND available_at > now()", userID).
+		Scan(&p)
+	if err != nil {
+		return 0, err
+	}
+	return p, nil
+}
+
+// GetExpiringPoints метод DAO получения баллов пользователя, сгорающих в течение within, по дням.
+func (d *DAO) GetExpiringPoints(userID int, within time.Duration) ([]types.ExpiringPoints, error) {
+	var res []types.ExpiringPoints
+	rows, err := d.dao.Query(
+		"SELECT expires_at::date, SUM(remaining) FROM accrual_lots "+
+			"WHERE user_id = ($1) AND remaining > 0 AND expires_at <= now() + make_interval(secs => $2) "+
+			"GROUP BY 1 ORDER BY 1", userID, within.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var p types.ExpiringPoints
+		var t time.Time
+		if err = rows.Scan(&t, &p.Amount); err != nil {
+			return nil, err
+		}
+		p.Amount = math.Round(p.Amount*100) / 100
+		p.ExpiresAt = t.Format("2006-01-02")
+		res = append(res, p)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetBalanceHistory метод DAO получения истории баланса пользователя: начислений, списаний, корректировок,
+// сгорания баллов, их отзыва по возвратам заказов и переводов. Отмененные списания не включаются.
+func (d *DAO) GetBalanceHistory(userID int) ([]types.BalanceEntry, error) {
+	var entries []types.BalanceEntry
+	rows, err := d.dao.Query(
+		"SELECT $2::text, accrual::double precision, order_number, '', '', uploaded_at FROM orders "+
+			"WHERE user_id = ($1) AND status = 'PROCESSED' AND accrual > 0 "+
+			"UNION ALL SELECT $3::text, -sum::double precision, order_number, status, '', processed_at FROM withdraws "+
+			"WHERE user_id = ($1) AND status <> ($6) "+
+			"UNION ALL SELECT $4::text, amount::double precision, '', reason, '', created_at FROM balance_adjustments "+
+			"WHERE user_id = ($1) "+
+			"UNION ALL SELECT $5::text, -expired_amount::double precision, order_number, '', '', expired_at FROM accrual_lots "+
+			"WHERE user_id = ($1) AND expired_amount > 0 "+
+			"UNION ALL SELECT $7::text, -clawback::double precision, order_number, reason, '', created_at FROM order_returns "+
+			"WHERE user_id = ($1) AND clawback > 0 "+
+			"UNION ALL SELECT $8::text, amount::double precision, '', t.comment, u.login, t.created_at "+
+			"FROM balance_transfers t JOIN users u ON u.id = t.from_user_id WHERE t.to_user_id = ($1) "+
+			"UNION ALL SELECT $9::text, -amount::double precision, '', t.comment, u.login, t.created_at "+
+			"FROM balance_transfers t JOIN users u ON u.id = t.to_user_id WHERE t.from_user_id = ($1) "+
+			"ORDER BY 6",
+		userID, types.BalanceEntryAccrual, types.BalanceEntryWithdrawal, types.BalanceEntryAdjustment,
+		types.BalanceEntryExpiration, types.WithdrawalCancelled, types.BalanceEntryClawback,
+		types.BalanceEntryTransferIn, types.BalanceEntryTransferOut)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var e types.BalanceEntry
+		var t time.Time
+		if err = rows.Scan(&e.Type, &e.Amount, &e.Order, &e.Description, &e.Counterparty, &t); err != nil {
+			return nil, err
+		}
+		e.Amount = math.Round(e.Amount*100) / 100
+		e.CreatedAt = t.Local().Format(time.RFC3339)
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocateLots(t *testing.T) {
+	lots := []lotBalance{
+		{id: 1, remaining: 100, available: true},
+		{id: 2, remaining: 50.5, available: true},
+		{id: 3, remaining: 20, available: true},
+	}
+	held := []lotBalance{
+		{id: 1, remaining: 100, available: true},
+		{id: 2, remaining: 50},
+		{id: 3, remaining: 20, available: true},
+	}
+	tests := []struct {
+		name string
+		lots []lotBalance
+		sum  float64
+		want []lotUse
+	}{
+		{
+			name: "first lot only",
+			lots: lots,
+			sum:  40,
+			want: []lotUse{{lotID: 1, amount: 40}},
+		},
+		{
+			name: "whole first lot",
+			lots: lots,
+			sum:  100,
+			want: []lotUse{{lotID: 1, amount: 100}},
+		},
+		{
+			name: "spans lots in order",
+			lots: lots,
+			sum:  130.25,
+			want: []lotUse{{lotID: 1, amount: 100}, {lotID: 2, amount: 30.25}},
+		},
+		{
+			name: "all lots",
+			lots: lots,
+			sum:  170.5,
+			want: []lotUse{{lotID: 1, amount: 100}, {lotID: 2, amount: 50.5}, {lotID: 3, amount: 20}},
+		},
+		{
+			name: "sum above lots",
+			lots: lots,
+			sum:  500,
+			want: []lotUse{{lotID: 1, amount: 100}, {lotID: 2, amount: 50.5}, {lotID: 3, amount: 20}},
+		},
+		{
+			name: "rounding",
+			lots: []lotBalance{{id: 1, remaining: 0.1, available: true}, {id: 2, remaining: 0.2, available: true}},
+			sum:  0.3,
+			want: []lotUse{{lotID: 1, amount: 0.1}, {lotID: 2, amount: 0.2}},
+		},
+		{
+			name: "skips held lot",
+			lots: held,
+			sum:  110,
+			want: []lotUse{{lotID: 1, amount: 100}, {lotID: 3, amount: 10}},
+		},
+		{
+			name: "held lot is never used",
+			lots: held,
+			sum:  500,
+			want: []lotUse{{lotID: 1, amount: 100}, {lotID: 3, amount: 20}},
+		},
+		{
+			name: "only held lots",
+			lots: []lotBalance{{id: 2, remaining: 50}},
+			sum:  10,
+		},
+		{
+			name: "zero sum",
+			lots: lots,
+			sum:  0,
+		},
+		{
+			name: "no lots",
+			sum:  10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocateLots(tt.lots, tt.sum)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocateLots(%v) = %v, want %v", tt.sum, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// SaveOIDCState метод DAO сохранения параметров начатого входа через внешнего провайдера.
+// Заодно удаляются незавершенные входы старше maxAge.
+func (d *DAO) SaveOIDCState(st *types.OIDCState, maxAge time.Duration) error {
+	_, err := d.dao.Exec(
+		"DELETE FROM oidc_states WHERE created_at < now() - make_interval(secs => $1)", maxAge.Seconds())
+	if err != nil {
+		return err
+	}
+	_, err = d.dao.Exec(
+		"INSERT INTO oidc_states (state, nonce, code_verifier, user_id) VALUES ($1, $2, $3, NULLIF($4, 0))",
+		st.State, st.Nonce, st.CodeVerifier, st.UserID)
+	return err
+}
+
+// TakeOIDCState метод DAO получения и удаления параметров входа по state.
+// Параметры используются однократно; для неизвестного или устаревшего state возвращает ErrOIDCStateInvalid.
+func (d *DAO) TakeOIDCState(state string, maxAge time.Duration) (*types.OIDCState, error) {
+	st := types.OIDCState{State: state}
+	var fresh bool
+	err := d.dao.QueryRow(
+		"DELETE FROM oidc_states WHERE state = ($1) "+
+			"RETURNING nonce, code_verifier, coalesce(user_id, 0), created_at > now() - make_interval(secs => $2)",
+		state, maxAge.Seconds()).Scan(&st.Nonce, &st.CodeVerifier, &st.UserID, &fresh)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrOIDCStateInvalid
+		}
+		return nil, err
+	}
+	if !fresh {
+		return nil, types.ErrOIDCStateInvalid
+	}
+	return &st, nil
+}
+
+// GetUserByIdentity метод DAO получения пользователя, к которому привязана внешняя учетная запись.
+func (d *DAO) GetUserByIdentity(issuer, subject string) (int, error) {
+	var userID int
+	err := d.dao.QueryRow(
+		"SELECT user_id FROM user_identities WHERE issuer = ($1) AND subject = ($2)", issuer, subject).
+		Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, types.ErrUserNotFound
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// LinkIdentity метод DAO привязки внешней учетной записи к пользователю.
+// Если запись уже привязана к другому пользователю, возвращает ErrIdentityLinked.
+func (d *DAO) LinkIdentity(userID int, issuer, subject, email string) error {
+	var ownerID int
+	err := d.dao.QueryRow(
+		"INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, NULLIF($4, '')) "+
+			"ON CONFLICT (issuer, subject) DO NOTHING RETURNING user_id",
+		userID, issuer, subject, email).Scan(&ownerID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if ownerID, err = d.GetUserByIdentity(issuer, subject); err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return types.ErrIdentityLinked
+	}
+	return nil
+}
+
+// NewExternalUser метод DAO регистрации пользователя без пароля с ролью types.RoleUser
+// и привязанной внешней учетной записью.
+// Если логин занят, возвращает ErrUsersAlreadyExists.
+func (d *DAO) NewExternalUser(login, issuer, subject, email string) (int, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int
+	err = tx.QueryRow(
+		"INSERT INTO users (login, role) VALUES ($1, $2) ON CONFLICT (login) DO NOTHING RETURNING id",
+		login, types.RoleUser).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, types.ErrUsersAlreadyExists
+		}
+		return 0, err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, NULLIF($4, ''))",
+		id, issuer, subject, email)
+	if err != nil {
+		return 0, err
+	}
+	err = insertOutbox(tx, types.EventUserRegistered, id, map[string]interface{}{
+		"user_id": id,
+		"login":   login,
+		"issuer":  issuer,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
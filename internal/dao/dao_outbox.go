@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// ClaimOutbox метод DAO выборки очередной порции неопубликованных доменных событий в порядке записи.
+// Выбранные события откладываются на lease, чтобы их не забрали другие реплики, пока идет публикация;
+// транзакция на время публикации не удерживается.
+func (d *DAO) ClaimOutbox(limit int, lease time.Duration) ([]types.DomainEvent, error) {
+	var events []types.DomainEvent
+	rows, err := d.dao.Query(
+		`WITH due AS (
+	SELECT id FROM outbox
+	WHERE published_at IS NULL AND (claimed_until IS NULL OR claimed_until <= now())
+	ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+)
+UPDATE outbox o SET claimed_until = now() + make_interval(secs => $2)
+FROM due WHERE o.id = due.id
+RETURNING o.id, o.event_type, coalesce(o.user_id, 0), o.payload, o.created_at`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var e types.DomainEvent
+		var payload string
+		var t time.Time
+		if err = rows.Scan(&e.ID, &e.Type, &e.UserID, &payload, &t); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		e.CreatedAt = t.Local().Format(time.RFC3339)
+		events = append(events, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// MarkOutboxPublished метод DAO фиксации публикации доменных событий ids.
+func (d *DAO) MarkOutboxPublished(ids []int64) error {
+	_, err := d.dao.Exec("UPDATE outbox SET published_at = now() WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
+
+// ReleaseOutbox метод DAO снятия отсрочки с событий ids, публикация которых не удалась,
+// чтобы следующая попытка началась с них и порядок событий сохранился.
+func (d *DAO) ReleaseOutbox(ids []int64) error {
+	_, err := d.dao.Exec(
+		"UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1) AND published_at IS NULL", pq.Array(ids))
+	return err
+}
+
+// PurgeOutbox метод DAO удаления опубликованных событий старше retention.
+func (d *DAO) PurgeOutbox(retention time.Duration) error {
+	_, err := d.dao.Exec(
+		"DELETE FROM outbox WHERE published_at < now() - make_interval(secs => $1)", retention.Seconds())
+	return err
+}
+
+// insertOutbox метод-helper DAO записи доменного события в outbox в рамках транзакции tx.
+func insertOutbox(tx *sql.Tx, eventType string, userID int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO outbox (event_type, user_id, payload) VALUES ($1, NULLIF($2, 0), $3)",
+		eventType, userID, string(payload))
+	return err
+}
@@ -0,0 +1,44 @@
+package dao
+
+// rateLimitIdle время простоя, после которого корзина гарантированно полна и может быть удалена;
+// соответствует наибольшему периоду квоты.
+const rateLimitIdle = 3600
+
+// TakeToken метод DAO получения маркера из корзины key, пополняемой со скоростью perSecond до burst маркеров.
+// Возвращает число маркеров, оставшихся в корзине, и признак того, что маркер был получен.
+// При создании новой корзины удаляются давно не использовавшиеся.
+func (d *DAO) TakeToken(key string, perSecond, burst float64) (float64, bool, error) {
+	res, err := d.dao.Exec(
+		"INSERT INTO rate_limits (key, tokens) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING", key, burst)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 1 {
+		_, err = d.dao.Exec(
+			"DELETE FROM rate_limits WHERE updated_at < now() - make_interval(secs => $1)", rateLimitIdle)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	var tokens float64
+	var ok bool
+	err = d.dao.QueryRow(
+		"UPDATE rate_limits SET tokens = CASE WHEN cur.tokens >= 1 THEN cur.tokens - 1 ELSE cur.tokens END, "+
+			"updated_at = clock_timestamp() "+
+			"FROM (SELECT least($3::double precision, "+
+			"tokens + extract(epoch FROM clock_timestamp() - updated_at) * $2::double precision) AS tokens "+
+			"FROM rate_limits WHERE key = ($1) FOR UPDATE) cur "+
+			"WHERE rate_limits.key = ($1) RETURNING rate_limits.tokens, cur.tokens >= 1",
+		key, perSecond, burst).Scan(&tokens, &ok)
+	if err != nil {
+		return 0, false, err
+	}
+	return tokens, ok, nil
+}
+
+// ReturnToken метод DAO возврата маркера в корзину key, не более чем до burst маркеров.
+func (d *DAO) ReturnToken(key string, burst float64) error {
+	_, err := d.dao.Exec(
+		"UPDATE rate_limits SET tokens = least($2::double precision, tokens + 1) WHERE key = ($1)", key, burst)
+	return err
+}
@@ -0,0 +1,208 @@
+package dao
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// orderReturnsJoin присоединение к заказам o сводных сведений о возвратах r.
+const orderReturnsJoin = "LEFT JOIN (SELECT order_number, MIN(revised_accrual) AS revised_accrual, " +
+	"SUM(clawback) AS clawback, SUM(written_off) AS written_off, MAX(created_at) AS returned_at " +
+	"FROM order_returns GROUP BY order_number) r ON r.order_number = o.order_number"
+
+// orderReturnColumns колонки сводных сведений о возврате заказа.
+const orderReturnColumns = "r.revised_accrual, r.clawback, r.written_off, r.returned_at"
+
+// orderReturnFields приемники колонок orderReturnColumns.
+type orderReturnFields struct {
+	revised    sql.NullFloat64
+	clawback   sql.NullFloat64
+	writtenOff sql.NullFloat64
+	returnedAt sql.NullTime
+}
+
+func (f *orderReturnFields) dest() []interface{} {
+	return []interface{}{&f.revised, &f.clawback, &f.writtenOff, &f.returnedAt}
+}
+
+// orderReturn метод-helper получения сведений о возврате; для заказа без возвратов возвращает nil.
+func (f *orderReturnFields) orderReturn() *types.OrderReturn {
+	if !f.returnedAt.Valid {
+		return nil
+	}
+	r := &types.OrderReturn{
+		Status:     types.OrderReturnPartial,
+		Accrual:    math.Round(f.revised.Float64*100) / 100,
+		Clawback:   math.Round(f.clawback.Float64*100) / 100,
+		WrittenOff: math.Round(f.writtenOff.Float64*100) / 100,
+		ReturnedAt: f.returnedAt.Time.Local().Format(time.RFC3339),
+	}
+	if r.Accrual == 0 {
+		r.Status = types.OrderReturnFull
+	}
+	return r
+}
+
+// GetReturnableOrder метод DAO получения обработанного заказа с действующим начислением для возврата.
+// Действующее начисление уменьшено на отозванные ранее баллы. Состав заказа известен,
+// если заказ регистрировался в системе начислений.
+func (d *DAO) GetReturnableOrder(orderNumber string) (*types.ReturnableOrder, error) {
+	var o types.ReturnableOrder
+	var status string
+	var goods sql.NullString
+	err := d.dao.QueryRow(
+		"SELECT o.user_id, o.status, coalesce(o.accrual, 0), coalesce(o.accrual, 0) - coalesce("+
+			"(SELECT SUM(clawback + written_off) FROM order_returns WHERE order_number = o.order_number), 0), "+
+			"g.goods FROM orders o LEFT JOIN accrual_registrations g ON g.order_number = o.order_number "+
+			"WHERE o.order_number = ($1)", orderNumber).Scan(&o.UserID, &status, &o.Original, &o.Accrual, &goods)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrOrderNotFound
+		}
+		return nil, err
+	}
+	if status != "PROCESSED" || o.Accrual <= 0 {
+		return nil, types.ErrOrderNotProcessed
+	}
+	if goods.Valid {
+		if err = json.Unmarshal([]byte(goods.String), &o.Goods); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := d.dao.Query(
+		"SELECT goods FROM order_returns WHERE order_number = ($1) AND goods IS NOT NULL ORDER BY id", orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var b []byte
+		var returned []types.Good
+		if err = rows.Scan(&b); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &returned); err != nil {
+			return nil, err
+		}
+		o.Returned = append(o.Returned, returned...)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// NewOrderReturn метод DAO возврата заказа с пересчетом начисления до revised и отзывом разницы с баланса.
+// Строка пользователя блокируется, чтобы баланс не изменился до конца возврата. Без allowNegative с баланса
+// списывается не больше доступных и удерживаемых баллов, остаток отзыва списывается в убыток.
+// Остаток партии баллов заказа уменьшается на всю разницу. Возвращенные товары goods сохраняются,
+// чтобы один и тот же товар нельзя было вернуть повторно.
+func (d *DAO) NewOrderReturn(orderNumber string, revised float64, goods []types.Good, allowNegative bool, reason string, operatorID int) (*types.OrderReturn, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var userID int
+	var accrual float64
+	err = tx.QueryRow(
+		"SELECT user_id, coalesce(accrual, 0) FROM orders WHERE order_number = ($1) AND status = 'PROCESSED' FOR UPDATE",
+		orderNumber).Scan(&userID, &accrual)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrOrderNotProcessed
+		}
+		return nil, err
+	}
+	if err = lockUsers(tx, userID); err != nil {
+		return nil, err
+	}
+	var returned float64
+	err = tx.QueryRow(
+		"SELECT coalesce(SUM(clawback + written_off), 0) FROM order_returns WHERE order_number = ($1)",
+		orderNumber).Scan(&returned)
+	if err != nil {
+		return nil, err
+	}
+	current := math.Round((accrual-returned)*100) / 100
+	if revised < 0 || revised >= current {
+		return nil, types.ErrReturnInvalid
+	}
+	debit := math.Round((current-revised)*100) / 100
+	var balance float64
+	if !allowNegative {
+		b, err := availableBalance(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		p, err := pendingPoints(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		balance = b + p
+	}
+	clawback, writtenOff := splitReturnDebit(debit, balance, allowNegative)
+	var returnedGoods sql.NullString
+	if len(goods) > 0 {
+		data, err := json.Marshal(goods)
+		if err != nil {
+			return nil, err
+		}
+		returnedGoods = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO order_returns (order_number, user_id, revised_accrual, clawback, written_off, reason, operator_id, goods) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		orderNumber, userID, revised, clawback, writtenOff, reason, operatorID, returnedGoods)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		"UPDATE accrual_lots SET remaining = greatest(0, remaining - ($2)) WHERE order_number = ($1)",
+		orderNumber, debit)
+	if err != nil {
+		return nil, err
+	}
+	var f orderReturnFields
+	err = tx.QueryRow(
+		"SELECT "+orderReturnColumns+" FROM orders o "+orderReturnsJoin+" WHERE o.order_number = ($1)",
+		orderNumber).Scan(f.dest()...)
+	if err != nil {
+		return nil, err
+	}
+	ret := f.orderReturn()
+	err = insertOutbox(tx, types.EventOrderReturned, userID, map[string]interface{}{
+		"number":      orderNumber,
+		"user_id":     userID,
+		"accrual":     revised,
+		"clawback":    clawback,
+		"written_off": writtenOff,
+		"reason":      reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// splitReturnDebit метод-helper разделения отзываемой при возврате суммы debit на отзыв с баланса
+// и списание в убыток. Без allowNegative с баланса отзывается не больше balance.
+func splitReturnDebit(debit, balance float64, allowNegative bool) (clawback, writtenOff float64) {
+	clawback = debit
+	if !allowNegative && clawback > balance {
+		clawback = math.Max(0, math.Round(balance*100)/100)
+	}
+	return clawback, math.Round((debit-clawback)*100) / 100
+}
@@ -0,0 +1,31 @@
+package dao
+
+import "testing"
+
+func TestSplitReturnDebit(t *testing.T) {
+	tests := []struct {
+		name           string
+		debit          float64
+		balance        float64
+		allowNegative  bool
+		wantClawback   float64
+		wantWrittenOff float64
+	}{
+		{name: "covered by balance", debit: 300, balance: 500, wantClawback: 300},
+		{name: "exactly the balance", debit: 500, balance: 500, wantClawback: 500},
+		{name: "above balance", debit: 500, balance: 120.5, wantClawback: 120.5, wantWrittenOff: 379.5},
+		{name: "empty balance", debit: 500, wantWrittenOff: 500},
+		{name: "negative balance", debit: 500, balance: -50, wantWrittenOff: 500},
+		{name: "negative allowed", debit: 500, balance: 100, allowNegative: true, wantClawback: 500},
+		{name: "rounding", debit: 0.3, balance: 0.1, wantClawback: 0.1, wantWrittenOff: 0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clawback, writtenOff := splitReturnDebit(tt.debit, tt.balance, tt.allowNegative)
+			if clawback != tt.wantClawback || writtenOff != tt.wantWrittenOff {
+				t.Errorf("splitReturnDebit() = %v, %v, want %v, %v",
+					clawback, writtenOff, tt.wantClawback, tt.wantWrittenOff)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// SaveTOTPSecret метод DAO сохранения зашифрованного секрета двухфакторной аутентификации до подтверждения.
+// Повторное подключение заменяет неподтвержденный секрет; если аутентификация уже включена, возвращает ErrTwoFactorEnabled.
+func (d *DAO) SaveTOTPSecret(userID int, secret string) error {
+	res, err := d.dao.Exec(
+		"INSERT INTO user_totp (user_id, secret) VALUES ($1, $2) "+
+			"ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = now() "+
+			"WHERE user_totp.enabled = false",
+		userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// GetTOTPSecret метод DAO получения параметров двухфакторной аутентификации пользователя.
+// Если пользователь не подключал аутентификацию, возвращает ErrTwoFactorNotEnrolled.
+func (d *DAO) GetTOTPSecret(userID int) (*types.TOTPSecret, error) {
+	var s types.TOTPSecret
+	err := d.dao.QueryRow(
+		"SELECT secret, enabled, last_step FROM user_totp WHERE user_id = ($1)", userID).
+		Scan(&s.Secret, &s.Enabled, &s.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// IsTwoFactorEnabled метод DAO проверки, включена ли у пользователя двухфакторная аутентификация.
+func (d *DAO) IsTwoFactorEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := d.dao.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = ($1) AND enabled)", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// UseTOTPStep метод DAO фиксации шага принятого кода.
+// Возвращает false, если код этого или более позднего шага уже был использован.
+func (d *DAO) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := d.dao.Exec(
+		"UPDATE user_totp SET last_step = ($2) WHERE user_id = ($1) AND last_step < ($2)", userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// EnableTwoFactor метод DAO включения двухфакторной аутентификации с заменой резервных кодов.
+func (d *DAO) EnableTwoFactor(userID int, codeHashes []string) error {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(
+		"UPDATE user_totp SET enabled = true, enabled_at = now() WHERE user_id = ($1) AND enabled = false", userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrTwoFactorEnabled
+	}
+	if _, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ($1)", userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, h)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DisableTwoFactor метод DAO отключения двухфакторной аутентификации.
+// Удаляются секрет, резервные коды и незавершенные входы пользователя.
+func (d *DAO) DisableTwoFactor(userID int) error {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, q := range []string{
+		"DELETE FROM two_factor_challenges WHERE user_id = ($1)",
+		"DELETE FROM recovery_codes WHERE user_id = ($1)",
+		"DELETE FROM user_totp WHERE user_id = ($1)",
+	} {
+		if _, err = tx.Exec(q, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRecoveryCodes метод DAO получения хешей неиспользованных резервных кодов пользователя.
+func (d *DAO) GetRecoveryCodes(userID int) ([]types.RecoveryCode, error) {
+	var codes []types.RecoveryCode
+	rows, err := d.dao.Query(
+		"SELECT id, code_hash FROM recovery_codes WHERE user_id = ($1) AND used_at IS NULL ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var c types.RecoveryCode
+		if err = rows.Scan(&c.ID, &c.Hash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode метод DAO отметки резервного кода использованным.
+// Возвращает false, если код уже был использован.
+func (d *DAO) UseRecoveryCode(codeID int) (bool, error) {
+	res, err := d.dao.Exec(
+		"UPDATE recovery_codes SET used_at = now() WHERE id = ($1) AND used_at IS NULL", codeID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// NewTwoFactorChallenge метод DAO сохранения входа, ожидающего второго фактора.
+// Заодно удаляются незавершенные входы старше maxAge.
+func (d *DAO) NewTwoFactorChallenge(token string, userID int, maxAge time.Duration) error {
+	_, err := d.dao.Exec(
+		"DELETE FROM two_factor_challenges WHERE created_at < now() - make_interval(secs => $1)", maxAge.Seconds())
+	if err != nil {
+		return err
+	}
+	_, err = d.dao.Exec(
+		"INSERT INTO two_factor_challenges (token, user_id) VALUES ($1, $2)", token, userID)
+	return err
+}
+
+// AttemptTwoFactorChallenge метод DAO учета попытки завершить вход и получения пользователя входа.
+// Для неизвестного, устаревшего или исчерпавшего maxAttempts попыток входа возвращает ErrChallengeInvalid.
+func (d *DAO) AttemptTwoFactorChallenge(token string, maxAge time.Duration, maxAttempts int) (int, error) {
+	var userID int
+	err := d.dao.QueryRow(
+		"UPDATE two_factor_challenges SET attempts = attempts + 1 "+
+			"WHERE token = ($1) AND created_at > now() - make_interval(secs => $2) AND attempts < ($3) "+
+			"RETURNING user_id",
+		token, maxAge.Seconds(), maxAttempts).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, types.ErrChallengeInvalid
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// DeleteTwoFactorChallenge метод DAO удаления завершенного входа.
+func (d *DAO) DeleteTwoFactorChallenge(token string) error {
+	_, err := d.dao.Exec("DELETE FROM two_factor_challenges WHERE token = ($1)", token)
+	return err
+}
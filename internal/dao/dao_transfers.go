@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// NewBalanceTransfer метод DAO перевода sum баллов от пользователя fromID пользователю с логином toLogin.
+// Строки обоих пользователей блокируются в порядке возрастания идентификаторов, чтобы встречные переводы
+// не приводили к взаимоблокировке. Перевод расходует партии баллов отправителя начиная с ближайших
+// к сгоранию; получателю баллы зачисляются без срока сгорания.
+func (d *DAO) NewBalanceTransfer(fromID int, toLogin string, sum float64, comment string, limits types.TransferLimits) (*types.Transfer, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var toID int
+	var blocked bool
+	err = tx.QueryRow("SELECT id, blocked FROM users WHERE login = ($1)", toLogin).Scan(&toID, &blocked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrUserNotFound
+		}
+		return nil, err
+	}
+	if toID == fromID {
+		return nil, types.ErrTransferInvalid
+	}
+	if blocked {
+		return nil, types.ErrUserBlocked
+	}
+	if err = lockUsers(tx, fromID, toID); err != nil {
+		return nil, err
+	}
+
+	var count int
+	var total float64
+	err = tx.QueryRow(
+		"SELECT count(*), coalesce(SUM(amount), 0)::double precision FROM balance_transfers "+
+			"WHERE from_user_id = ($1) AND created_at >= date_trunc('day', now())", fromID).Scan(&count, &total)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkTransferLimits(limits, count, total, sum); err != nil {
+		return nil, err
+	}
+	balance, err := availableBalance(tx, fromID)
+	if err != nil {
+		return nil, err
+	}
+	if balance < sum {
+		return nil, types.ErrInsufficientAccruals
+	}
+	if _, err = consumeLots(tx, fromID, sum); err != nil {
+		return nil, err
+	}
+
+	t := types.Transfer{To: toLogin, Sum: sum, Comment: comment}
+	var createdAt time.Time
+	err = tx.QueryRow(
+		"INSERT INTO balance_transfers (from_user_id, to_user_id, amount, comment) VALUES ($1, $2, $3, $4) "+
+			"RETURNING id, created_at, (SELECT login FROM users WHERE id = ($1))",
+		fromID, toID, sum, comment).Scan(&t.ID, &createdAt, &t.From)
+	if err != nil {
+		return nil, err
+	}
+	t.CreatedAt = createdAt.Local().Format(time.RFC3339)
+	for _, userID := range []int{fromID, toID} {
+		if err = insertOutbox(tx, types.EventPointsTransferred, userID, t); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// checkTransferLimits метод-helper проверки дневных лимитов limits для перевода sum, если за текущие сутки
+// отправитель уже сделал count переводов на сумму total. Нулевой лимит не ограничивает переводы.
+func checkTransferLimits(limits types.TransferLimits, count int, total, sum float64) error {
+	if (limits.Count > 0 && count >= limits.Count) ||
+		(limits.Sum > 0 && math.Round((total+sum)*100)/100 > limits.Sum) {
+		return types.ErrTransferLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestCheckTransferLimits(t *testing.T) {
+	limits := types.TransferLimits{Sum: 1000, Count: 3}
+	tests := []struct {
+		name    string
+		limits  types.TransferLimits
+		count   int
+		total   float64
+		sum     float64
+		wantErr error
+	}{
+		{name: "first transfer", limits: limits, sum: 100},
+		{name: "up to the sum limit", limits: limits, count: 2, total: 900, sum: 100},
+		{name: "above the sum limit", limits: limits, count: 1, total: 900, sum: 100.01, wantErr: types.ErrTransferLimitExceeded},
+		{name: "single transfer above the sum limit", limits: limits, sum: 1000.5, wantErr: types.ErrTransferLimitExceeded},
+		{name: "count limit reached", limits: limits, count: 3, total: 30, sum: 10, wantErr: types.ErrTransferLimitExceeded},
+		{name: "rounding at the limit", limits: types.TransferLimits{Sum: 0.3}, total: 0.1, sum: 0.2},
+		{name: "no sum limit", limits: types.TransferLimits{Count: 3}, count: 2, total: 1e6, sum: 1e6},
+		{name: "no count limit", limits: types.TransferLimits{Sum: 1000}, count: 100, total: 10, sum: 10},
+		{name: "no limits", count: 100, total: 1e6, sum: 1e6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTransferLimits(tt.limits, tt.count, tt.total, tt.sum)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkTransferLimits() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
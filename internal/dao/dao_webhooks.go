@@ -0,0 +1,189 @@
+package dao
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// NewWebhook метод DAO регистрации нового вебхука пользователя.
+func (d *DAO) NewWebhook(wh *types.Webhook) error {
+	var t time.Time
+	err := d.dao.QueryRow(
+		"INSERT INTO webhooks (user_id, url, secret, events) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		wh.UserID, wh.URL, wh.Secret, pq.Array(wh.Events)).Scan(&wh.ID, &t)
+	if err != nil {
+		return err
+	}
+	wh.CreatedAt = t.Local().Format(time.RFC3339)
+	return nil
+}
+
+// GetWebhooks метод DAO получения списка вебхуков пользователя.
+func (d *DAO) GetWebhooks(userID int) ([]types.Webhook, error) {
+	var webhooks []types.Webhook
+	rows, err := d.dao.Query(
+		"SELECT id, url, events, created_at FROM webhooks WHERE user_id = ($1) ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		wh := types.Webhook{UserID: userID}
+		var t time.Time
+		if err = rows.Scan(&wh.ID, &wh.URL, pq.Array(&wh.Events), &t); err != nil {
+			return nil, err
+		}
+		wh.CreatedAt = t.Local().Format(time.RFC3339)
+		webhooks = append(webhooks, wh)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook метод DAO удаления вебхука пользователя.
+func (d *DAO) DeleteWebhook(userID, webhookID int) error {
+	res, err := d.dao.Exec("DELETE FROM webhooks WHERE id = ($1) AND user_id = ($2)", webhookID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetWebhookDeliveries метод DAO получения журнала доставок вебхука пользователя.
+func (d *DAO) GetWebhookDeliveries(userID, webhookID int, limit int) ([]types.WebhookDelivery, error) {
+	var exists bool
+	err := d.dao.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = ($1) AND user_id = ($2))", webhookID, userID).
+		Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, types.ErrWebhookNotFound
+	}
+	var deliveries []types.WebhookDelivery
+	rows, err := d.dao.Query(
+		"SELECT id, webhook_id, event, status, attempts, response_code, last_error, created_at, delivered_at "+
+			"FROM webhook_deliveries WHERE webhook_id = ($1) ORDER BY id DESC LIMIT $2", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var wd types.WebhookDelivery
+		var code sql.NullInt64
+		var lastErr sql.NullString
+		var createdAt time.Time
+		var deliveredAt sql.NullTime
+		err = rows.Scan(&wd.ID, &wd.WebhookID, &wd.Event, &wd.Status, &wd.Attempts,
+			&code, &lastErr, &createdAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		wd.ResponseCode = int(code.Int64)
+		wd.LastError = lastErr.String
+		wd.CreatedAt = createdAt.Local().Format(time.RFC3339)
+		if deliveredAt.Valid {
+			wd.DeliveredAt = deliveredAt.Time.Local().Format(time.RFC3339)
+		}
+		deliveries = append(deliveries, wd)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries метод DAO выборки доставок вебхуков, готовых к отправке.
+// Выбранные доставки откладываются на lease, чтобы их не забрали другие реплики.
+func (d *DAO) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]types.WebhookDelivery, error) {
+	var deliveries []types.WebhookDelivery
+	rows, err := d.dao.Query(
+		`WITH due AS (
+	SELECT id FROM webhook_deliveries
+	WHERE status = $1 AND next_attempt_at <= now()
+	ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+)
+UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $3)
+FROM due, webhooks w
+WHERE d.id = due.id AND w.id = d.webhook_id
+RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret`,
+		types.WebhookDeliveryPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var wd types.WebhookDelivery
+		err = rows.Scan(&wd.ID, &wd.WebhookID, &wd.Event, &wd.Payload, &wd.Attempts, &wd.URL, &wd.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, wd)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered метод DAO фиксации успешной доставки вебхука.
+func (d *DAO) MarkWebhookDelivered(id int64, responseCode int) error {
+	_, err := d.dao.Exec(
+		"UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2, "+
+			"last_error = NULL, delivered_at = now() WHERE id = ($3)",
+		types.WebhookDeliverySent, responseCode, id)
+	return err
+}
+
+// MarkWebhookFailed метод DAO фиксации неудачной попытки доставки вебхука.
+// При retryAfter == 0 доставка считается окончательно неудавшейся.
+func (d *DAO) MarkWebhookFailed(id int64, responseCode int, lastErr string, retryAfter time.Duration) error {
+	status := types.WebhookDeliveryPending
+	if retryAfter == 0 {
+		status = types.WebhookDeliveryFailed
+	}
+	_, err := d.dao.Exec(
+		"UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = NULLIF($2, 0), "+
+			"last_error = $3, next_attempt_at = now() + make_interval(secs => $4) WHERE id = ($5)",
+		status, responseCode, lastErr, retryAfter.Seconds(), id)
+	return err
+}
+
+// enqueueWebhooks метод-helper DAO постановки в outbox доставок события
+// всем подписанным на него вебхукам пользователя в рамках транзакции tx.
+func enqueueWebhooks(tx *sql.Tx, userID int, event string, data interface{}) error {
+	payload, err := json.Marshal(types.WebhookPayload{
+		Event:      event,
+		OccurredAt: time.Now().Format(time.RFC3339),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, event, payload) "+
+			"SELECT id, $2, $3 FROM webhooks WHERE user_id = ($1) AND $2 = ANY(events)",
+		userID, event, string(payload))
+	return err
+}
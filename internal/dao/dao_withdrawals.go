@@ -0,0 +1,205 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// withdrawColumns колонки списания и корректировки, которой оно сторнировано; читаются scanWithdraw.
+const withdrawColumns = "w.order_number, w.sum, w.processed_at, w.status, w.cancelled_at, " +
+	"a.id, a.reason, a.operator_id, a.created_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWithdraw метод-helper чтения списания, выбранного колонками withdrawColumns.
+func scanWithdraw(row rowScanner) (*types.Withdraw, error) {
+	var w types.Withdraw
+	var t time.Time
+	var cancelledAt, reversedAt sql.NullTime
+	var adjID sql.NullInt64
+	var reason sql.NullString
+	var operatorID sql.NullInt32
+	err := row.Scan(&w.OrderNumber, &w.Sum, &t, &w.Status, &cancelledAt, &adjID, &reason, &operatorID, &reversedAt)
+	if err != nil {
+		return nil, err
+	}
+	w.ProcessedAt = t.Format(time.RFC3339)
+	if cancelledAt.Valid {
+		w.CancelledAt = cancelledAt.Time.Format(time.RFC3339)
+	}
+	if adjID.Valid {
+		w.Reversal = &types.WithdrawalReversal{
+			AdjustmentID: adjID.Int64,
+			Reason:       reason.String,
+			OperatorID:   int(operatorID.Int32),
+			ReversedAt:   reversedAt.Time.Format(time.RFC3339),
+		}
+	}
+	return &w, nil
+}
+
+// CancelWithdrawal метод DAO отмены списания пользователя, выполненного не ранее grace назад.
+// Израсходованные списанием баллы возвращаются в партии.
+// Если списания нет, возвращает ErrWithdrawalNotFound, если оно уже не в статусе WithdrawalPending
+// или срок отмены истек - ErrWithdrawalNotCancellable.
+func (d *DAO) CancelWithdrawal(userID int, orderNumber string, grace time.Duration) (*types.Withdraw, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int
+	err = tx.QueryRow(
+		"UPDATE withdraws SET status = ($3), cancelled_at = now() "+
+			"WHERE user_id = ($1) AND order_number = ($2) AND status = ($4) "+
+			"AND processed_at > now() - make_interval(secs => $5) RETURNING id",
+		userID, orderNumber, types.WithdrawalCancelled, types.WithdrawalPending, grace.Seconds()).Scan(&id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		var exists bool
+		err = tx.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM withdraws WHERE user_id = ($1) AND order_number = ($2))",
+			userID, orderNumber).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, types.ErrWithdrawalNotFound
+		}
+		return nil, types.ErrWithdrawalNotCancellable
+	}
+	if err = restoreLots(tx, id); err != nil {
+		return nil, err
+	}
+	w, err := scanWithdraw(tx.QueryRow(
+		"SELECT "+withdrawColumns+" FROM withdraws w "+
+			"LEFT JOIN balance_adjustments a ON a.id = w.reversal_adjustment_id WHERE w.id = ($1)", id))
+	if err != nil {
+		return nil, err
+	}
+	if err = insertOutbox(tx, types.EventWithdrawalCancelled, userID, w); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// ReverseWithdrawal метод DAO сторнирования завершенного списания по номеру заказа.
+// Баллы возвращаются пользователю корректировкой баланса от имени оператора operatorID с причиной reason.
+func (d *DAO) ReverseWithdrawal(orderNumber string, operatorID int, reason string) (*types.Withdraw, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id, userID int
+	var sum float64
+	var status string
+	err = tx.QueryRow(
+		"SELECT id, user_id, sum, status FROM withdraws WHERE order_number = ($1) AND status <> ($2) FOR UPDATE",
+		orderNumber, types.WithdrawalCancelled).Scan(&id, &userID, &sum, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, types.ErrWithdrawalNotFound
+		}
+		return nil, err
+	}
+	if status != types.WithdrawalCompleted {
+		return nil, types.ErrWithdrawalNotReversible
+	}
+	adj := types.BalanceAdjustment{
+		UserID:     userID,
+		Amount:     sum,
+		Reason:     reason,
+		OperatorID: operatorID,
+	}
+	var t time.Time
+	err = tx.QueryRow(
+		"INSERT INTO balance_adjustments (user_id, amount, reason, operator_id) VALUES ($1, $2, $3, $4) "+
+			"RETURNING id, created_at",
+		adj.UserID, adj.Amount, adj.Reason, adj.OperatorID).Scan(&adj.ID, &t)
+	if err != nil {
+		return nil, err
+	}
+	adj.CreatedAt = t.Local().Format(time.RFC3339)
+	_, err = tx.Exec(
+		"UPDATE withdraws SET status = ($2), reversal_adjustment_id = ($3) WHERE id = ($1)",
+		id, types.WithdrawalReversed, adj.ID)
+	if err != nil {
+		return nil, err
+	}
+	w, err := scanWithdraw(tx.QueryRow(
+		"SELECT "+withdrawColumns+" FROM withdraws w "+
+			"LEFT JOIN balance_adjustments a ON a.id = w.reversal_adjustment_id WHERE w.id = ($1)", id))
+	if err != nil {
+		return nil, err
+	}
+	if err = insertOutbox(tx, types.EventBalanceAdjusted, userID, adj); err != nil {
+		return nil, err
+	}
+	if err = insertOutbox(tx, types.EventWithdrawalReversed, userID, w); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// CompleteWithdrawals метод DAO завершения списаний, срок отмены которых истек.
+// Возвращает количество завершенных списаний.
+func (d *DAO) CompleteWithdrawals(grace time.Duration) (int, error) {
+	tx, err := d.dao.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(
+		"UPDATE withdraws SET status = ($1), completed_at = now() "+
+			"WHERE status = ($2) AND processed_at <= now() - make_interval(secs => $3) "+
+			"RETURNING user_id, order_number, sum, processed_at",
+		types.WithdrawalCompleted, types.WithdrawalPending, grace.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	type completed struct {
+		userID int
+		w      types.Withdraw
+	}
+	var done []completed
+	for rows.Next() {
+		c := completed{w: types.Withdraw{Status: types.WithdrawalCompleted}}
+		var t time.Time
+		if err = rows.Scan(&c.userID, &c.w.OrderNumber, &c.w.Sum, &t); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		c.w.ProcessedAt = t.Format(time.RFC3339)
+		done = append(done, c)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, c := range done {
+		if err = insertOutbox(tx, types.EventWithdrawalCompleted, c.userID, c.w); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(done), nil
+}
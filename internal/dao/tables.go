@@ -9,6 +9,12 @@ CREATE TABLE IF NOT EXISTS users
     login text NOT NULL UNIQUE, 
 	encrypted_password text
 );
+`
+	// UsersAccessColumns колонки роли и блокировки пользователя.
+	UsersAccessColumns = `
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'user',
+	ADD COLUMN IF NOT EXISTS blocked boolean NOT NULL DEFAULT false;
 `
 	// UserTokens таблица для хранения токенов авторизации выданных пользователям.
 	UserTokens = `
@@ -19,6 +25,87 @@ CREATE TABLE IF NOT EXISTS tokens
 	token text,
 	created_at timestamp without time zone default now()
 );
+`
+	// UserIdentitiesTable таблица внешних учетных записей OpenID Connect, привязанных к пользователям.
+	UserIdentitiesTable = `
+CREATE TABLE IF NOT EXISTS user_identities
+(
+	id serial PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users(id),
+	issuer text NOT NULL,
+	subject text NOT NULL,
+	email text,
+	created_at timestamp without time zone default now(),
+	UNIQUE (issuer, subject)
+);
+`
+	// OIDCStatesTable таблица незавершенных входов через внешнего провайдера.
+	OIDCStatesTable = `
+CREATE TABLE IF NOT EXISTS oidc_states
+(
+	state text PRIMARY KEY,
+	nonce text NOT NULL,
+	code_verifier text NOT NULL,
+	user_id integer REFERENCES users(id) ON DELETE CASCADE,
+	created_at timestamp without time zone default now()
+);
+`
+	// UserTOTPTable таблица секретов двухфакторной аутентификации, секрет хранится зашифрованным.
+	UserTOTPTable = `
+CREATE TABLE IF NOT EXISTS user_totp
+(
+	user_id integer PRIMARY KEY REFERENCES users(id),
+	secret text NOT NULL,
+	enabled boolean NOT NULL DEFAULT false,
+	last_step bigint NOT NULL DEFAULT 0,
+	created_at timestamp without time zone default now(),
+	enabled_at timestamp without time zone
+);
+`
+	// RecoveryCodesTable таблица резервных кодов двухфакторной аутентификации, коды хранятся в виде хеша.
+	RecoveryCodesTable = `
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+	id serial PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users(id),
+	code_hash text NOT NULL,
+	used_at timestamp without time zone
+);
+`
+	// TwoFactorChallengesTable таблица незавершенных входов, ожидающих второго фактора.
+	TwoFactorChallengesTable = `
+CREATE TABLE IF NOT EXISTS two_factor_challenges
+(
+	token text PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	attempts integer NOT NULL DEFAULT 0,
+	created_at timestamp without time zone default now()
+);
+`
+	// RateLimitsTable таблица корзин маркеров ограничения частоты запросов, общая для реплик приложения.
+	RateLimitsTable = `
+CREATE TABLE IF NOT EXISTS rate_limits
+(
+	key text PRIMARY KEY,
+	tokens double precision NOT NULL,
+	updated_at timestamp with time zone NOT NULL default now()
+);
+`
+	// APIKeysTable таблица API-ключей пользователей, секрет ключа хранится в виде хеша.
+	APIKeysTable = `
+CREATE TABLE IF NOT EXISTS api_keys
+(
+	id serial PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users(id),
+	name text NOT NULL,
+	prefix text NOT NULL UNIQUE,
+	secret_hash text NOT NULL,
+	scopes text[] NOT NULL,
+	expires_at timestamp without time zone,
+	last_used_at timestamp without time zone,
+	revoked_at timestamp without time zone,
+	created_at timestamp without time zone default now()
+);
 `
 	// OrdersTable таблица хранения номеров заказов для расчета начислений.
 	OrdersTable = `
@@ -31,6 +118,30 @@ CREATE TABLE IF NOT EXISTS orders
 	accrual real,
 	uploaded_at timestamp without time zone default now()
 );
+`
+	// OrdersPollingColumns колонки учета опросов системы начислений по заказу.
+	OrdersPollingColumns = `
+ALTER TABLE orders
+	ADD COLUMN IF NOT EXISTS polled_at timestamp without time zone,
+	ADD COLUMN IF NOT EXISTS accrual_attempts integer NOT NULL DEFAULT 0;
+`
+	// OrdersCallbackColumns колонка времени последнего уведомления системы начислений по заказу.
+	OrdersCallbackColumns = `
+ALTER TABLE orders
+	ADD COLUMN IF NOT EXISTS callback_at timestamp without time zone;
+`
+	// OrderEventsTable таблица хранения событий изменения статуса и начислений по заказам.
+	OrderEventsTable = `
+CREATE TABLE IF NOT EXISTS order_events
+(
+	id bigserial PRIMARY KEY,
+	user_id integer REFERENCES users(id),
+	order_number text NOT NULL,
+	status text,
+	accrual real,
+	created_at timestamp without time zone default now()
+);
+CREATE INDEX IF NOT EXISTS order_events_user_id_idx ON order_events (user_id, id);
 `
 	// WithdrawsTable таблица хранения списаний пользователей.
 	WithdrawsTable = `
@@ -42,5 +153,178 @@ CREATE TABLE IF NOT EXISTS withdraws
 	sum real,
 	processed_at timestamp without time zone default now()
 );
+`
+	// WithdrawsStatusColumns колонки статуса списания, его отмены и сторнирования.
+	// Номер заказа должен быть уникален только среди неотмененных списаний.
+	WithdrawsStatusColumns = `
+ALTER TABLE withdraws
+	ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'COMPLETED',
+	ADD COLUMN IF NOT EXISTS completed_at timestamp without time zone,
+	ADD COLUMN IF NOT EXISTS cancelled_at timestamp without time zone,
+	ADD COLUMN IF NOT EXISTS reversal_adjustment_id bigint REFERENCES balance_adjustments(id),
+	DROP CONSTRAINT IF EXISTS withdraws_order_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS withdraws_order_number_active
+	ON withdraws (order_number) WHERE status <> 'CANCELLED';
+`
+	// AccrualLotsTable таблица партий начисленных баллов со сроком сгорания.
+	// remaining - остаток партии, не израсходованный списаниями, expired_amount - сгоревшие баллы.
+	AccrualLotsTable = `
+CREATE TABLE IF NOT EXISTS accrual_lots
+(
+	id serial PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users(id),
+	order_number text NOT NULL UNIQUE,
+	amount real NOT NULL,
+	remaining real NOT NULL,
+	expired_amount real NOT NULL DEFAULT 0,
+	accrued_at timestamp without time zone default now(),
+	expires_at timestamp without time zone,
+	expired_at timestamp without time zone
+);
+CREATE INDEX IF NOT EXISTS accrual_lots_user_idx ON accrual_lots (user_id);
+CREATE INDEX IF NOT EXISTS accrual_lots_expiry_idx ON accrual_lots (expires_at) WHERE remaining > 0;
+`
+	// AccrualLotsHoldColumns колонка времени, с которого баллы партии можно потратить.
+	AccrualLotsHoldColumns = `
+ALTER TABLE accrual_lots
+	ADD COLUMN IF NOT EXISTS available_at timestamp without time zone NOT NULL DEFAULT now();
+`
+	// WithdrawalLotsTable таблица расхода партий баллов списаниями.
+	WithdrawalLotsTable = `
+CREATE TABLE IF NOT EXISTS withdrawal_lots
+(
+	withdraw_id integer NOT NULL REFERENCES withdraws(id),
+	lot_id integer NOT NULL REFERENCES accrual_lots(id),
+	amount real NOT NULL,
+	PRIMARY KEY (withdraw_id, lot_id)
+);
+`
+	// OrderReturnsTable таблица возвратов заказов и отзыва начисленных по ним баллов.
+	OrderReturnsTable = `
+CREATE TABLE IF NOT EXISTS order_returns
+(
+	id bigserial PRIMARY KEY,
+	order_number text NOT NULL REFERENCES orders(order_number),
+	user_id integer NOT NULL REFERENCES users(id),
+	revised_accrual real NOT NULL,
+	clawback real NOT NULL,
+	written_off real NOT NULL DEFAULT 0,
+	reason text NOT NULL DEFAULT '',
+	operator_id integer NOT NULL REFERENCES users(id),
+	created_at timestamp without time zone default now()
+);
+CREATE INDEX IF NOT EXISTS order_returns_order_idx ON order_returns (order_number);
+CREATE INDEX IF NOT EXISTS order_returns_user_idx ON order_returns (user_id);
+`
+	// OrderReturnsGoodsColumn колонка товаров, возвращенных по заказу, с ценами из состава заказа.
+	OrderReturnsGoodsColumn = `
+ALTER TABLE order_returns
+	ADD COLUMN IF NOT EXISTS goods jsonb;
+`
+	// BalanceTransfersTable таблица переводов баллов между пользователями.
+	BalanceTransfersTable = `
+CREATE TABLE IF NOT EXISTS balance_transfers
+(
+	id bigserial PRIMARY KEY,
+	from_user_id integer NOT NULL REFERENCES users(id),
+	to_user_id integer NOT NULL REFERENCES users(id),
+	amount real NOT NULL,
+	comment text NOT NULL DEFAULT '',
+	created_at timestamp without time zone default now()
+);
+CREATE INDEX IF NOT EXISTS balance_transfers_from_idx ON balance_transfers (from_user_id, created_at);
+CREATE INDEX IF NOT EXISTS balance_transfers_to_idx ON balance_transfers (to_user_id);
+`
+	// IdempotencyKeysTable таблица ключей идемпотентности запросов пользователей и сохраненных ответов на них.
+	// Пока запрос выполняется, status не заполнен.
+	IdempotencyKeysTable = `
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+	user_id integer NOT NULL REFERENCES users(id),
+	key text NOT NULL,
+	request_hash text NOT NULL,
+	status integer,
+	content_type text,
+	body bytea,
+	created_at timestamp without time zone default now(),
+	PRIMARY KEY (user_id, key)
+);
+`
+	// WebhooksTable таблица хранения зарегистрированных пользователями вебхуков.
+	WebhooksTable = `
+CREATE TABLE IF NOT EXISTS webhooks
+(
+	id serial PRIMARY KEY,
+	user_id integer REFERENCES users(id),
+	url text NOT NULL,
+	secret text NOT NULL,
+	events text[] NOT NULL,
+	created_at timestamp without time zone default now()
+);
+`
+	// WebhookDeliveriesTable таблица-outbox доставок вебхуков, заполняется в транзакциях изменения данных.
+	WebhookDeliveriesTable = `
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+	id bigserial PRIMARY KEY,
+	webhook_id integer REFERENCES webhooks(id) ON DELETE CASCADE,
+	event text NOT NULL,
+	payload text NOT NULL,
+	status text NOT NULL DEFAULT 'PENDING',
+	attempts integer NOT NULL DEFAULT 0,
+	next_attempt_at timestamp without time zone default now(),
+	response_code integer,
+	last_error text,
+	created_at timestamp without time zone default now(),
+	delivered_at timestamp without time zone
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+`
+	// AccrualRegistrationsTable таблица-outbox регистрации заказов в системе начислений.
+	AccrualRegistrationsTable = `
+CREATE TABLE IF NOT EXISTS accrual_registrations
+(
+	id bigserial PRIMARY KEY,
+	order_number text NOT NULL UNIQUE,
+	goods text NOT NULL DEFAULT '[]',
+	status text NOT NULL DEFAULT 'PENDING',
+	attempts integer NOT NULL DEFAULT 0,
+	next_attempt_at timestamp without time zone default now(),
+	last_error text,
+	created_at timestamp without time zone default now(),
+	registered_at timestamp without time zone
+);
+CREATE INDEX IF NOT EXISTS accrual_registrations_pending_idx ON accrual_registrations (next_attempt_at) WHERE status = 'PENDING';
+`
+	// BalanceAdjustmentsTable таблица ручных корректировок баланса пользователей.
+	BalanceAdjustmentsTable = `
+CREATE TABLE IF NOT EXISTS balance_adjustments
+(
+	id bigserial PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users(id),
+	amount real NOT NULL,
+	reason text NOT NULL,
+	operator_id integer NOT NULL REFERENCES users(id),
+	created_at timestamp without time zone default now()
+);
+CREATE INDEX IF NOT EXISTS balance_adjustments_user_idx ON balance_adjustments (user_id);
+`
+	// OutboxTable таблица-outbox доменных событий для публикации во внешнюю шину.
+	OutboxTable = `
+CREATE TABLE IF NOT EXISTS outbox
+(
+	id bigserial PRIMARY KEY,
+	event_type text NOT NULL,
+	user_id integer,
+	payload text NOT NULL,
+	created_at timestamp without time zone default now(),
+	published_at timestamp without time zone
+);
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
+`
+	// OutboxClaimColumn колонка времени, до которого событие outbox отложено публикующей репликой.
+	OutboxClaimColumn = `
+ALTER TABLE outbox
+	ADD COLUMN IF NOT EXISTS claimed_until timestamp without time zone;
 `
 )
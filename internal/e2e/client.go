@@ -0,0 +1,171 @@
+package e2e
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// Client клиент HTTP API гофермарта для прогона сценариев.
+type Client struct {
+	BaseURL string
+	// Gzip включает сжатие тел запросов и запрос сжатых ответов.
+	Gzip  bool
+	Token string
+
+	http *http.Client
+}
+
+// NewClient метод-конструктор клиента API.
+func NewClient(baseURL string, gz bool) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		Gzip:    gz,
+		// отключаем прозрачную распаковку, чтобы проверять сжатие ответов сервером
+		http: &http.Client{Transport: &http.Transport{DisableCompression: true}},
+	}
+}
+
+// Register метод регистрации пользователя.
+func (c *Client) Register(login, password string) (int, error) {
+	return c.auth("/api/user/register", login, password)
+}
+
+// Login метод аутентификации пользователя.
+func (c *Client) Login(login, password string) (int, error) {
+	return c.auth("/api/user/login", login, password)
+}
+
+func (c *Client) auth(path, login, password string) (int, error) {
+	body, _ := json.Marshal(types.UserRequest{Login: login, Password: password})
+	status, res, err := c.do(http.MethodPost, path, "application/json", body)
+	if err != nil || status != http.StatusOK {
+		return status, err
+	}
+	var ar types.AuthResponse
+	if err = json.Unmarshal(res, &ar); err != nil {
+		return status, err
+	}
+	c.Token = ar.Token
+	return status, nil
+}
+
+// UploadOrder метод загрузки номера заказа.
+func (c *Client) UploadOrder(number string) (int, error) {
+	status, _, err := c.do(http.MethodPost, "/api/user/orders", "text/plain", []byte(number))
+	return status, err
+}
+
+// UploadOrders метод пакетной загрузки номеров заказов.
+func (c *Client) UploadOrders(numbers []string) (int, []types.BatchOrderResult, error) {
+	body, _ := json.Marshal(numbers)
+	status, res, err := c.do(http.MethodPost, "/api/user/orders/batch", "application/json", body)
+	if err != nil || status != http.StatusMultiStatus {
+		return status, nil, err
+	}
+	var results []types.BatchOrderResult
+	return status, results, json.Unmarshal(res, &results)
+}
+
+// Orders метод получения списка заказов.
+func (c *Client) Orders() (int, []types.Order, error) {
+	var orders []types.Order
+	status, err := c.getJSON("/api/user/orders", &orders)
+	return status, orders, err
+}
+
+// Balance метод получения баланса.
+func (c *Client) Balance() (int, *types.JSONBalance, error) {
+	var b types.JSONBalance
+	status, err := c.getJSON("/api/user/balance", &b)
+	return status, &b, err
+}
+
+// Withdraw метод запроса на списание.
+func (c *Client) Withdraw(order string, sum float64) (int, error) {
+	body, _ := json.Marshal(types.JSONWithdrawRequest{Order: order, Sum: sum})
+	status, _, err := c.do(http.MethodPost, "/api/user/balance/withdraw", "application/json", body)
+	return status, err
+}
+
+// CancelWithdrawal метод отмены списания по номеру заказа.
+func (c *Client) CancelWithdrawal(order string) (int, error) {
+	status, _, err := c.do(http.MethodPost, "/api/user/withdrawals/"+order+"/cancel", "", nil)
+	return status, err
+}
+
+// Withdrawals метод получения списка списаний.
+func (c *Client) Withdrawals() (int, []types.Withdraw, error) {
+	var wthd []types.Withdraw
+	status, err := c.getJSON("/api/user/withdrawals", &wthd)
+	return status, wthd, err
+}
+
+func (c *Client) getJSON(path string, v interface{}) (int, error) {
+	status, res, err := c.do(http.MethodGet, path, "", nil)
+	if err != nil || status != http.StatusOK {
+		return status, err
+	}
+	return status, json.Unmarshal(res, v)
+}
+
+// do метод выполнения запроса с учетом сжатия и авторизации.
+func (c *Client) do(method, path, contentType string, body []byte) (int, []byte, error) {
+	var r io.Reader
+	if body != nil {
+		if c.Gzip {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			if _, err := gz.Write(body); err != nil {
+				return 0, nil, err
+			}
+			if err := gz.Close(); err != nil {
+				return 0, nil, err
+			}
+			body = buf.Bytes()
+		}
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Gzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+		if body != nil {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	var rb io.Reader = res.Body
+	if strings.Contains(res.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return res.StatusCode, nil, err
+		}
+		defer func() { _ = gz.Close() }()
+		rb = gz
+	} else if c.Gzip && res.StatusCode == http.StatusOK && method == http.MethodGet {
+		return res.StatusCode, nil, fmt.Errorf("%s %s: response is not gzip encoded", method, path)
+	}
+	data, err := ioutil.ReadAll(rb)
+	return res.StatusCode, data, err
+}
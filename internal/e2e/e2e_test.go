@@ -0,0 +1,43 @@
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/accrualfake"
+)
+
+var (
+	users     = flag.Int("e2e.users", 5, "Number of concurrent users per scenario run")
+	timeout   = flag.Duration("e2e.timeout", time.Minute, "Time to wait for accruals")
+	requireDB = flag.Bool("e2e.require-db", false, "Fail instead of skipping when no database is available")
+)
+
+func TestScenario(t *testing.T) {
+	h, err := Start(accrualfake.Config{
+		RegisteredDelay: 200 * time.Millisecond,
+		ProcessingDelay: 200 * time.Millisecond,
+	})
+	if errors.Is(err, ErrPostgresUnavailable) && !*requireDB {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	for _, gz := range []bool{false, true} {
+		gz := gz
+		t.Run(fmt.Sprintf("gzip=%v", gz), func(t *testing.T) {
+			if err := RunScenario(h, gz, *users, *timeout); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package e2e содержит стенд для сквозной проверки HTTP API гофермарта:
+// приложение, поднятое на случайном порту, одноразовую БД и имитацию системы начислений.
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/accrualfake"
+	"github.com/lipandr/yandex-practicum-diploma/internal/app"
+	"github.com/lipandr/yandex-practicum-diploma/internal/client"
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
+	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/events"
+	"github.com/lipandr/yandex-practicum-diploma/internal/service"
+)
+
+// Harness запущенный стенд.
+type Harness struct {
+	// BaseURL адрес приложения, например http://127.0.0.1:34567.
+	BaseURL string
+	// Accrual имитация системы начислений, позволяет регистрировать заказы и задавать их исход.
+	Accrual *accrualfake.Server
+
+	pg         *Postgres
+	appL       net.Listener
+	accrualL   net.Listener
+	accrualSrv *http.Server
+}
+
+// Start метод запуска стенда. Возвращает ErrPostgresUnavailable, если БД поднять не удалось,
+// что позволяет вызывающей стороне пропустить прогон.
+func Start(accrualCfg accrualfake.Config) (*Harness, error) {
+	pg, err := StartPostgres()
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{
+		pg:      pg,
+		Accrual: accrualfake.NewServer(accrualCfg),
+	}
+	if h.accrualL, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		h.Close()
+		return nil, err
+	}
+	h.accrualSrv = &http.Server{Handler: h.Accrual}
+	go func() { _ = h.accrualSrv.Serve(h.accrualL) }()
+
+	var cfg config.Config
+	if err = env.Parse(&cfg); err != nil {
+		h.Close()
+		return nil, err
+	}
+	cfg.DatabaseURI = pg.URI
+	cfg.AccrualSystemAddress = "http://" + h.accrualL.Addr().String()
+	cfg.EventsHeartbeat = time.Second
+	cfg.AccrualPollInterval = 200 * time.Millisecond
+	// сценарии нагрузки выполняются с одного адреса и не должны упираться в ограничения частоты запросов
+	cfg.RateLimitDefault = ""
+	cfg.RateLimitIP = ""
+	cfg.RateLimitRoutes = nil
+	// сценарий списывает баллы сразу после начисления
+	cfg.AccrualHoldPeriod = 0
+
+	db, err := dao.NewDAO(cfg.DatabaseURI)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	hub, err := events.NewHub(db)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	source := client.NewHTTPSource("fake", cfg.AccrualSystemAddress, client.NewHTTPOptions(cfg))
+	client.NewAccrualProcessor(db, hub, source, client.NewPoolOptions(cfg)).Run()
+
+	svc, err := service.NewService(cfg, db, hub)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	if h.appL, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		h.Close()
+		return nil, err
+	}
+	h.BaseURL = fmt.Sprintf("http://%s", h.appL.Addr())
+	a, err := app.NewApp(cfg, svc)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	go func() { _ = a.Serve(h.appL) }()
+	return h, nil
+}
+
+// Close метод остановки стенда.
+func (h *Harness) Close() {
+	if h.appL != nil {
+		_ = h.appL.Close()
+	}
+	if h.accrualSrv != nil {
+		_ = h.accrualSrv.Close()
+	}
+	if h.pg != nil {
+		h.pg.Stop()
+	}
+}
@@ -0,0 +1,130 @@
+package e2e
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DatabaseURIEnv переменная окружения с адресом уже запущенной БД для прогона.
+const DatabaseURIEnv = "GOPHERMART_E2E_DATABASE_URI"
+
+// ErrPostgresUnavailable ошибка отсутствия как внешней БД, так и локальных бинарных файлов PostgreSQL.
+var ErrPostgresUnavailable = errors.New("postgres is unavailable: set " + DatabaseURIEnv + " or install initdb/pg_ctl")
+
+// Postgres одноразовый экземпляр PostgreSQL для прогона.
+type Postgres struct {
+	URI    string
+	dir    string
+	pgCtl  string
+	server bool
+}
+
+// StartPostgres метод запуска БД для прогона. Если задана переменная DatabaseURIEnv, используется
+// указанная БД, иначе во временном каталоге поднимается собственный кластер с помощью initdb и pg_ctl.
+func StartPostgres() (*Postgres, error) {
+	if uri := os.Getenv(DatabaseURIEnv); uri != "" {
+		return &Postgres{URI: uri}, nil
+	}
+	initDB, err := lookPostgresBinary("initdb")
+	if err != nil {
+		return nil, ErrPostgresUnavailable
+	}
+	pgCtl, err := lookPostgresBinary("pg_ctl")
+	if err != nil {
+		return nil, ErrPostgresUnavailable
+	}
+	dir, err := ioutil.TempDir("", "gophermart-e2e-")
+	if err != nil {
+		return nil, err
+	}
+	p := &Postgres{dir: dir, pgCtl: pgCtl}
+
+	dataDir := filepath.Join(dir, "data")
+	out, err := exec.Command(initDB, "-D", dataDir, "-U", "postgres", "-A", "trust").CombinedOutput()
+	if err != nil {
+		p.Stop()
+		return nil, fmt.Errorf("initdb: %w: %s", err, out)
+	}
+	port, err := freePort()
+	if err != nil {
+		p.Stop()
+		return nil, err
+	}
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir)
+	out, err = exec.Command(pgCtl, "-D", dataDir, "-l", filepath.Join(dir, "postgres.log"),
+		"-o", opts, "-w", "start").CombinedOutput()
+	if err != nil {
+		p.Stop()
+		return nil, fmt.Errorf("pg_ctl start: %w: %s", err, out)
+	}
+	p.server = true
+
+	adminURI := fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+	if err = createDatabase(adminURI, "gophermart"); err != nil {
+		p.Stop()
+		return nil, err
+	}
+	p.URI = fmt.Sprintf("postgres://postgres@127.0.0.1:%d/gophermart?sslmode=disable", port)
+	return p, nil
+}
+
+// Stop метод остановки поднятого кластера и удаления его каталога.
+func (p *Postgres) Stop() {
+	if p.server {
+		_ = exec.Command(p.pgCtl, "-D", filepath.Join(p.dir, "data"), "-m", "immediate", "stop").Run()
+	}
+	if p.dir != "" {
+		_ = os.RemoveAll(p.dir)
+	}
+}
+
+// lookPostgresBinary метод-helper поиска бинарного файла PostgreSQL в PATH и стандартных каталогах.
+func lookPostgresBinary(name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	if len(matches) > 0 {
+		return matches[len(matches)-1], nil
+	}
+	return "", exec.ErrNotFound
+}
+
+// createDatabase метод-helper создания БД с ожиданием готовности сервера.
+func createDatabase(adminURI, name string) error {
+	db, err := sql.Open("postgres", adminURI)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err = db.Ping(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	_, err = db.Exec("CREATE DATABASE " + name)
+	return err
+}
+
+// freePort метод-helper получения свободного TCP-порта.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = l.Close() }()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,216 @@
+package e2e
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/joeljunstrom/go-luhn"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/accrualfake"
+)
+
+// Параметры вознаграждения, используемые в сценарии.
+const (
+	rewardMatch   = "Bork"
+	rewardPercent = 10
+	goodPrice     = 5000
+	expectedAward = goodPrice * rewardPercent / 100
+	withdrawSum   = 120.5
+)
+
+// RunScenario метод прогона полного сценария спецификации для users параллельных пользователей:
+// регистрация, вход, загрузка заказов, ожидание начислений, баланс, списание, список списаний,
+// отмена списания и пакетная загрузка заказов.
+func RunScenario(h *Harness, gz bool, users int, timeout time.Duration) error {
+	err := h.Accrual.AddReward(accrualfake.Reward{
+		Match:      rewardMatch,
+		Reward:     rewardPercent,
+		RewardType: accrualfake.RewardPercent,
+	})
+	if err != nil && err != accrualfake.ErrRewardExists {
+		return err
+	}
+	intruder := NewClient(h.BaseURL, gz)
+	if _, err = registerUser(intruder, "intruder"); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, users)
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := runUser(h, intruder, gz, i, timeout); err != nil {
+				errs <- fmt.Errorf("user %d (gzip=%v): %w", i, gz, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// runUser метод прогона сценария одним пользователем.
+func runUser(h *Harness, intruder *Client, gz bool, i int, timeout time.Duration) error {
+	c := NewClient(h.BaseURL, gz)
+	login, err := registerUser(c, "user"+strconv.Itoa(i))
+	if err != nil {
+		return err
+	}
+	if err = expect("duplicate register", http.StatusConflict)(c.Register(login, "password")); err != nil {
+		return err
+	}
+	if err = expect("login with wrong password", http.StatusUnauthorized)(c.Login(login, "wrong")); err != nil {
+		return err
+	}
+	if err = expect("login", http.StatusOK)(c.Login(login, "password")); err != nil {
+		return err
+	}
+
+	processed := luhn.Generate(12)
+	invalid := luhn.Generate(12)
+	if err = h.Accrual.RegisterOrder(processed, []accrualfake.Good{{Description: rewardMatch + " kettle", Price: goodPrice}}); err != nil {
+		return err
+	}
+	if err = h.Accrual.RegisterOrder(invalid, []accrualfake.Good{{Description: "Unknown", Price: goodPrice}}); err != nil {
+		return err
+	}
+	for _, number := range []string{processed, invalid} {
+		if err = expect("upload order", http.StatusAccepted)(c.UploadOrder(number)); err != nil {
+			return err
+		}
+	}
+	if err = expect("upload order again", http.StatusOK)(c.UploadOrder(processed)); err != nil {
+		return err
+	}
+	if err = expect("upload other user's order", http.StatusConflict)(intruder.UploadOrder(processed)); err != nil {
+		return err
+	}
+	if err = expect("upload invalid number", http.StatusUnprocessableEntity)(c.UploadOrder(breakLuhn(processed))); err != nil {
+		return err
+	}
+
+	if err = waitAccruals(c, processed, invalid, timeout); err != nil {
+		return err
+	}
+	if err = expectBalance(c, expectedAward, 0); err != nil {
+		return err
+	}
+	if err = expect("withdraw more than balance", http.StatusPaymentRequired)(c.Withdraw(luhn.Generate(12), expectedAward+1)); err != nil {
+		return err
+	}
+	if err = expect("withdraw invalid number", http.StatusUnprocessableEntity)(c.Withdraw(breakLuhn(processed), 1)); err != nil {
+		return err
+	}
+	if err = expect("withdraw", http.StatusOK)(c.Withdraw(luhn.Generate(12), withdrawSum)); err != nil {
+		return err
+	}
+	if err = expectBalance(c, expectedAward-withdrawSum, withdrawSum); err != nil {
+		return err
+	}
+	status, wthd, err := c.Withdrawals()
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK || len(wthd) != 1 || wthd[0].Sum != withdrawSum {
+		return fmt.Errorf("withdrawals: status %d, got %+v", status, wthd)
+	}
+
+	// номер заказа отмененного списания освобождается и для пакетной загрузки
+	freed := luhn.Generate(12)
+	if err = expect("withdraw to cancel", http.StatusOK)(c.Withdraw(freed, 1)); err != nil {
+		return err
+	}
+	if err = expect("cancel withdrawal", http.StatusOK)(c.CancelWithdrawal(freed)); err != nil {
+		return err
+	}
+	status, results, err := c.UploadOrders([]string{freed, processed, breakLuhn(processed)})
+	if err != nil {
+		return err
+	}
+	want := []int{http.StatusAccepted, http.StatusOK, http.StatusUnprocessableEntity}
+	if status != http.StatusMultiStatus || len(results) != len(want) {
+		return fmt.Errorf("upload orders: status %d, got %+v", status, results)
+	}
+	for i, code := range want {
+		if results[i].Status != code {
+			return fmt.Errorf("upload orders: order %s got status %d, want %d", results[i].Number, results[i].Status, code)
+		}
+	}
+	return nil
+}
+
+// waitAccruals метод ожидания окончательных статусов заказов.
+func waitAccruals(c *Client, processed, invalid string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, orders, err := c.Orders()
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("orders: unexpected status %d", status)
+		}
+		var done int
+		for _, o := range orders {
+			switch {
+			case o.OrderNumber == processed && o.Status == "PROCESSED":
+				if o.Accrual == nil || o.Accrual.Float64 != expectedAward {
+					return fmt.Errorf("order %s: unexpected accrual %+v", o.OrderNumber, o.Accrual)
+				}
+				done++
+			case o.OrderNumber == invalid && o.Status == "INVALID":
+				done++
+			}
+		}
+		if done == 2 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("orders were not processed in %s: %+v", timeout, orders)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// expectBalance метод проверки баланса пользователя.
+func expectBalance(c *Client, current, withdrawn float64) error {
+	status, b, err := c.Balance()
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK || math.Abs(b.Current-current) > 0.001 || math.Abs(b.Withdrawn-withdrawn) > 0.001 {
+		return fmt.Errorf("balance: status %d, got %+v, want current %v withdrawn %v", status, b, current, withdrawn)
+	}
+	return nil
+}
+
+// registerUser метод регистрации пользователя с уникальным логином.
+func registerUser(c *Client, prefix string) (string, error) {
+	login := fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+	return login, expect("register", http.StatusOK)(c.Register(login, "password"))
+}
+
+// expect метод-helper проверки кода ответа.
+func expect(step string, want int) func(int, error) error {
+	return func(got int, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+		if got != want {
+			return fmt.Errorf("%s: got status %d, want %d", step, got, want)
+		}
+		return nil
+	}
+}
+
+// breakLuhn метод-helper получения номера, не проходящего проверку алгоритмом Луна.
+func breakLuhn(number string) string {
+	last := number[len(number)-1] - '0'
+	return number[:len(number)-1] + strconv.Itoa(int(last+1)%10)
+}
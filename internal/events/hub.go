@@ -0,0 +1,97 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// subscriberBuffer размер буфера канала подписчика.
+const subscriberBuffer = 16
+
+// Hub интерфейс рассылки событий по заказам подписчикам.
+type Hub interface {
+	Publish(e *types.OrderEvent)
+	Subscribe(userID int) (<-chan *types.OrderEvent, func())
+}
+
+type hub struct {
+	mu   sync.Mutex
+	subs map[int]map[chan *types.OrderEvent]struct{}
+	dao  *dao.DAO
+}
+
+// NewHub метод-конструктор Hub.
+// При переданном DAO события рассылаются через LISTEN/NOTIFY, что позволяет получать их на всех репликах.
+func NewHub(dao *dao.DAO) (Hub, error) {
+	h := &hub{
+		subs: make(map[int]map[chan *types.OrderEvent]struct{}),
+		dao:  dao,
+	}
+	if dao != nil {
+		if err := dao.ListenOrderEvents(h.dispatch); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Publish метод Hub публикации события по заказу.
+func (h *hub) Publish(e *types.OrderEvent) {
+	if h.dao != nil {
+		err := h.dao.NotifyOrderEvent(e.ID)
+		if err == nil {
+			return
+		}
+		log.Println("order events notify:", err)
+	}
+	h.dispatch(e)
+}
+
+// Subscribe метод Hub подписки на события по заказам пользователя.
+// Возвращает канал событий и функцию отмены подписки. Канал закрывается,
+// если подписчик не успевает вычитывать события.
+func (h *hub) Subscribe(userID int) (<-chan *types.OrderEvent, func()) {
+	ch := make(chan *types.OrderEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan *types.OrderEvent]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(userID, ch)
+	}
+}
+
+// dispatch метод Hub рассылки события локальным подписчикам пользователя.
+func (h *hub) dispatch(e *types.OrderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[e.UserID] {
+		select {
+		case ch <- e:
+		default:
+			h.remove(e.UserID, ch)
+		}
+	}
+}
+
+// remove метод Hub удаления подписчика, вызывается под блокировкой.
+func (h *hub) remove(userID int, ch chan *types.OrderEvent) {
+	if _, ok := h.subs[userID][ch]; !ok {
+		return
+	}
+	delete(h.subs[userID], ch)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+	close(ch)
+}
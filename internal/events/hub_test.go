@@ -0,0 +1,73 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func receive(t *testing.T, ch <-chan *types.OrderEvent) (*types.OrderEvent, bool) {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		return e, ok
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return nil, false
+	}
+}
+
+func TestHubSubscribe(t *testing.T) {
+	h, err := NewHub(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, unsubscribeFirst := h.Subscribe(1)
+	second, unsubscribeSecond := h.Subscribe(1)
+	defer unsubscribeSecond()
+	other, unsubscribeOther := h.Subscribe(2)
+	defer unsubscribeOther()
+
+	h.Publish(&types.OrderEvent{ID: 1, UserID: 1, OrderNumber: "79927398713", Status: "PROCESSED"})
+	for _, ch := range []<-chan *types.OrderEvent{first, second} {
+		if e, ok := receive(t, ch); !ok || e.ID != 1 {
+			t.Errorf("event = %+v, %v, want event 1", e, ok)
+		}
+	}
+	select {
+	case e := <-other:
+		t.Errorf("another user received %+v", e)
+	default:
+	}
+
+	unsubscribeFirst()
+	if _, ok := receive(t, first); ok {
+		t.Error("channel is open after unsubscribe")
+	}
+	unsubscribeFirst()
+	h.Publish(&types.OrderEvent{ID: 2, UserID: 1})
+	if e, ok := receive(t, second); !ok || e.ID != 2 {
+		t.Errorf("event = %+v, %v, want event 2", e, ok)
+	}
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	h, err := NewHub(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, unsubscribe := h.Subscribe(1)
+	defer unsubscribe()
+	for i := 1; i <= subscriberBuffer+1; i++ {
+		h.Publish(&types.OrderEvent{ID: int64(i), UserID: 1})
+	}
+	for i := 1; i <= subscriberBuffer; i++ {
+		if e, ok := receive(t, ch); !ok || e.ID != int64(i) {
+			t.Fatalf("event = %+v, %v, want event %d", e, ok, i)
+		}
+	}
+	if _, ok := receive(t, ch); ok {
+		t.Error("slow subscriber channel is still open")
+	}
+}
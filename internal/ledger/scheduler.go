@@ -0,0 +1,69 @@
+// Package ledger реализует фоновые операции над балансами пользователей.
+package ledger
+
+import (
+	"log"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
+	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+)
+
+// Scheduler интерфейс периодического выполнения операций над балансами.
+type Scheduler interface {
+	Run()
+}
+
+// Options параметры фоновых операций над балансами.
+type Options struct {
+	// Interval пауза между запусками операций.
+	Interval time.Duration
+	// WithdrawalGrace срок, в течение которого списание можно отменить.
+	WithdrawalGrace time.Duration
+	// ExpiryMonths срок сгорания баллов партий, созданных для ранее обработанных заказов.
+	ExpiryMonths int
+}
+
+// NewOptions метод-конструктор Options по настройкам приложения.
+func NewOptions(cfg config.Config) Options {
+	return Options{
+		Interval:        cfg.LedgerInterval,
+		WithdrawalGrace: cfg.WithdrawalGracePeriod,
+		ExpiryMonths:    cfg.PointsExpiryMonths,
+	}
+}
+
+type scheduler struct {
+	dao  *dao.DAO
+	opts Options
+}
+
+// NewScheduler метод-конструктор Scheduler.
+func NewScheduler(dao *dao.DAO, opts Options) Scheduler {
+	return &scheduler{
+		dao:  dao,
+		opts: opts,
+	}
+}
+
+// Run метод запуска фоновых операций: завершения списаний, срок отмены которых истек,
+// и сгорания баллов с истекшим сроком. Перед первым запуском создаются партии баллов
+// для заказов, обработанных до их появления.
+func (s *scheduler) Run() {
+	go func() {
+		if n, err := s.dao.BackfillAccrualLots(s.opts.ExpiryMonths); err != nil {
+			log.Println("ledger:", err)
+		} else if n > 0 {
+			log.Printf("ledger: created %d accrual lots for processed orders", n)
+		}
+		for {
+			if _, err := s.dao.CompleteWithdrawals(s.opts.WithdrawalGrace); err != nil {
+				log.Println("ledger:", err)
+			}
+			if _, err := s.dao.ExpireLots(); err != nil {
+				log.Println("ledger:", err)
+			}
+			time.Sleep(s.opts.Interval)
+		}
+	}()
+}
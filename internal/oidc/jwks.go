@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// jws разобранный токен в компактной сериализации JWS.
+type jws struct {
+	header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	signingInput string
+	payload      []byte
+	signature    []byte
+}
+
+func parseJWS(raw string) (*jws, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+	var tok jws
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if err = json.Unmarshal(header, &tok.header); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if tok.payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if tok.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	tok.signingInput = parts[0] + "." + parts[1]
+	return &tok, nil
+}
+
+// jsonWebKeySet документ JWKS провайдера.
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// keySet ключи подписи провайдера по идентификатору kid. Поддерживается алгоритм RS256.
+type keySet struct {
+	keys map[string]*rsa.PublicKey
+}
+
+func (s jsonWebKeySet) keySet() (*keySet, error) {
+	ks := &keySet{keys: make(map[string]*rsa.PublicKey)}
+	for _, k := range s.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: jwks key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: jwks key %q: %w", k.Kid, err)
+		}
+		ks.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return ks, nil
+}
+
+// verify метод проверки подписи токена ключом с идентификатором из заголовка токена.
+func (ks *keySet) verify(tok *jws) error {
+	if tok.header.Alg != "RS256" {
+		return ErrTokenInvalid
+	}
+	key, ok := ks.keys[tok.header.Kid]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	sum := sha256.Sum256([]byte(tok.signingInput))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], tok.signature); err != nil {
+		return ErrTokenInvalid
+	}
+	return nil
+}
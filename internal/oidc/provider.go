@@ -0,0 +1,295 @@
+// Package oidc реализует вход через внешнего провайдера OpenID Connect:
+// authorization code flow с PKCE и проверку ID-токена по ключам JWKS провайдера.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryPath путь документа обнаружения относительно адреса провайдера.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// leeway допустимое расхождение часов при проверке срока действия токена.
+const leeway = time.Minute
+
+var (
+	ErrTokenInvalid  = errors.New("oidc: invalid id token")
+	ErrTokenExpired  = errors.New("oidc: id token expired")
+	ErrNonceMismatch = errors.New("oidc: nonce mismatch")
+	ErrKeyNotFound   = errors.New("oidc: signing key not found")
+)
+
+// Config настройки клиента провайдера OpenID Connect.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims утверждения проверенного ID-токена.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience поле aud, которое может быть строкой или массивом строк.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider клиент провайдера OpenID Connect. Документ обнаружения и ключи загружаются при первом обращении,
+// ключи перезагружаются, если токен подписан неизвестным ключом.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *discovery
+	keys *keySet
+}
+
+// NewProvider метод-конструктор клиента провайдера OpenID Connect.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid"}
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// AuthCodeURL метод формирования адреса авторизации у провайдера с параметрами PKCE.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange метод обмена кода авторизации на ID-токен.
+func (p *Provider) Exchange(code, codeVerifier string) (string, error) {
+	meta, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc: token response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("oidc: token endpoint: %d %s %s", res.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("oidc: token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// Verify метод проверки подписи и утверждений ID-токена: издателя, получателя, срока действия и nonce.
+func (p *Provider) Verify(rawIDToken, nonce string) (*Claims, error) {
+	meta, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := p.verifySignature(meta, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	var c Claims
+	if err = json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if c.Issuer != meta.Issuer || c.Subject == "" || !c.Audience.contains(p.cfg.ClientID) {
+		return nil, ErrTokenInvalid
+	}
+	now := time.Now()
+	if time.Unix(c.Expiry, 0).Add(leeway).Before(now) {
+		return nil, ErrTokenExpired
+	}
+	if c.IssuedAt != 0 && time.Unix(c.IssuedAt, 0).Add(-leeway).After(now) {
+		return nil, ErrTokenInvalid
+	}
+	if c.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return &c, nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature метод проверки подписи токена ключом провайдера, возвращает полезную нагрузку.
+func (p *Provider) verifySignature(meta *discovery, raw string) ([]byte, error) {
+	tok, err := parseJWS(raw)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := p.keySet(meta, false)
+	if err != nil {
+		return nil, err
+	}
+	err = keys.verify(tok)
+	if errors.Is(err, ErrKeyNotFound) {
+		// провайдер мог сменить ключи подписи
+		if keys, err = p.keySet(meta, true); err != nil {
+			return nil, err
+		}
+		err = keys.verify(tok)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tok.payload, nil
+}
+
+// discover метод загрузки документа обнаружения провайдера.
+func (p *Provider) discover() (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var meta discovery
+	if err := p.getJSON(strings.TrimSuffix(p.cfg.Issuer, "/")+discoveryPath, &meta); err != nil {
+		return nil, err
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch: %q", meta.Issuer)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// keySet метод получения ключей подписи провайдера, при refresh ключи загружаются заново.
+func (p *Provider) keySet(meta *discovery, refresh bool) (*keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && !refresh {
+		return p.keys, nil
+	}
+	var jwks jsonWebKeySet
+	if err := p.getJSON(meta.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys, err := jwks.keySet()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	return p.keys, nil
+}
+
+func (p *Provider) getJSON(u string, v interface{}) error {
+	res, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: unexpected status %d", u, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// NewCodeVerifier метод генерации случайного code_verifier для PKCE.
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge метод вычисления code_challenge по методу S256.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
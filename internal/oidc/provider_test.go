@@ -0,0 +1,172 @@
+package oidc_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/oidc"
+	"github.com/lipandr/yandex-practicum-diploma/internal/oidcmock"
+)
+
+const (
+	testClientID     = "gophermart"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost:8081/api/user/oidc/callback"
+)
+
+// newTestProvider запускает имитацию провайдера и возвращает ее вместе с клиентом провайдера.
+func newTestProvider(t *testing.T) (*oidcmock.Server, *oidc.Provider) {
+	t.Helper()
+
+	var mock *oidcmock.Server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	var err error
+	mock, err = oidcmock.NewServer(oidcmock.Config{
+		Issuer:       ts.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := oidc.NewProvider(oidc.Config{
+		Issuer:       ts.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email"},
+	}, ts.Client())
+	return mock, p
+}
+
+// authorize проходит авторизацию у имитации провайдера и возвращает выданный код.
+func authorize(t *testing.T, p *oidc.Provider, state, nonce, verifier, login string) string {
+	t.Helper()
+
+	u, err := p.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u += "&login_hint=" + url.QueryEscape(login)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", res.StatusCode)
+	}
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loc.Query().Get("state"); got != state {
+		t.Fatalf("authorize: state %q, want %q", got, state)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestProviderCodeFlow(t *testing.T) {
+	_, p := newTestProvider(t)
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, p, "state-1", "nonce-1", verifier, "alice")
+	idToken, err := p.Exchange(code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := p.Verify(idToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	want := oidcmock.IdentityFor("alice")
+	if claims.Subject != want.Subject || claims.Email != want.Email || claims.PreferredUsername != want.PreferredUsername {
+		t.Errorf("claims = %+v, want identity %+v", claims, want)
+	}
+	if _, err = p.Exchange(code, verifier); err == nil {
+		t.Error("Exchange: authorization code accepted twice")
+	}
+}
+
+func TestProviderPKCE(t *testing.T) {
+	_, p := newTestProvider(t)
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, p, "state", "nonce", verifier, "bob")
+	if _, err = p.Exchange(code, other); err == nil {
+		t.Fatal("Exchange: code accepted with a wrong code_verifier")
+	}
+}
+
+func TestProviderNonce(t *testing.T) {
+	mock, p := newTestProvider(t)
+
+	idToken, err := mock.IDToken(oidcmock.IdentityFor("carol"), "nonce-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Verify(idToken, "nonce-b"); !errors.Is(err, oidc.ErrNonceMismatch) {
+		t.Fatalf("Verify with wrong nonce: err = %v, want %v", err, oidc.ErrNonceMismatch)
+	}
+	if _, err = p.Verify(idToken, "nonce-a"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestProviderJWKSRotation(t *testing.T) {
+	mock, p := newTestProvider(t)
+
+	before, err := mock.IDToken(oidcmock.IdentityFor("dave"), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Verify(before, "n"); err != nil {
+		t.Fatalf("Verify before rotation: %v", err)
+	}
+	if err = mock.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := mock.IDToken(oidcmock.IdentityFor("dave"), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Verify(after, "n"); err != nil {
+		t.Fatalf("Verify after rotation: %v", err)
+	}
+	if _, err = p.Verify(before, "n"); !errors.Is(err, oidc.ErrKeyNotFound) {
+		t.Fatalf("Verify with retired key: err = %v, want %v", err, oidc.ErrKeyNotFound)
+	}
+}
+
+func TestProviderRejectsTamperedToken(t *testing.T) {
+	mock, p := newTestProvider(t)
+
+	idToken, err := mock.IDToken(oidcmock.IdentityFor("eve"), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := idToken[:len(idToken)-4] + "AAAA"
+	if _, err = p.Verify(tampered, "n"); !errors.Is(err, oidc.ErrTokenInvalid) {
+		t.Fatalf("Verify tampered token: err = %v, want %v", err, oidc.ErrTokenInvalid)
+	}
+}
@@ -0,0 +1,268 @@
+// Package oidcmock реализует имитацию провайдера OpenID Connect
+// для локальной разработки и интеграционных тестов входа через внешнего провайдера.
+package oidcmock
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Config настройки имитации провайдера.
+type Config struct {
+	// Issuer адрес провайдера, по которому к нему обращаются клиенты.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// TokenTTL срок действия выдаваемых ID-токенов.
+	TokenTTL time.Duration
+}
+
+// Identity пользователь провайдера.
+type Identity struct {
+	Subject           string
+	Email             string
+	PreferredUsername string
+}
+
+type authCode struct {
+	identity      Identity
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// Server имитация провайдера OpenID Connect. Авторизация подтверждается автоматически
+// для пользователя, переданного в параметре login_hint.
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	key      *rsa.PrivateKey
+	keyID    string
+	rotation int
+	codes    map[string]authCode
+}
+
+// NewServer метод-конструктор имитации провайдера с новым ключом подписи.
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.TokenTTL == 0 {
+		cfg.TokenTTL = time.Hour
+	}
+	s := &Server{
+		cfg:   cfg,
+		mux:   http.NewServeMux(),
+		codes: make(map[string]authCode),
+	}
+	if err := s.RotateKey(); err != nil {
+		return nil, err
+	}
+	s.mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	s.mux.HandleFunc("/jwks", s.handleJWKS)
+	s.mux.HandleFunc("/authorize", s.handleAuthorize)
+	s.mux.HandleFunc("/token", s.handleToken)
+	return s, nil
+}
+
+// ServeHTTP метод обработки HTTP-запросов к имитации.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// RotateKey метод замены ключа подписи: новые токены подписываются новым ключом,
+// а JWKS публикует только его, как после смены ключей у настоящего провайдера.
+func (s *Server) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotation++
+	s.key = key
+	s.keyID = fmt.Sprintf("oidcmock-%d", s.rotation)
+	return nil
+}
+
+// signingKey метод получения текущего ключа подписи и его идентификатора.
+func (s *Server) signingKey() (*rsa.PrivateKey, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key, s.keyID
+}
+
+// IdentityFor метод получения пользователя провайдера по подсказке логина.
+func IdentityFor(loginHint string) Identity {
+	if loginHint == "" {
+		loginHint = "user"
+	}
+	return Identity{
+		Subject:           "sub-" + loginHint,
+		Email:             loginHint + "@example.com",
+		PreferredUsername: loginHint,
+	}
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.cfg.Issuer,
+		"authorization_endpoint":                s.cfg.Issuer + "/authorize",
+		"token_endpoint":                        s.cfg.Issuer + "/token",
+		"jwks_uri":                              s.cfg.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	key, kid := s.signingKey()
+	pub := key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("client_id") != s.cfg.ClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = authCode{
+		identity:      IdentityFor(q.Get("login_hint")),
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	rq := redirectURI.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirectURI.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.cfg.ClientID || clientSecret != s.cfg.ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+	s.mu.Lock()
+	code, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || time.Now().After(code.expiresAt) ||
+		code.clientID != clientID || code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		code.codeChallenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	idToken, err := s.IDToken(code.identity, code.nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(s.cfg.TokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// IDToken метод выпуска подписанного ID-токена для пользователя провайдера.
+func (s *Server) IDToken(id Identity, nonce string) (string, error) {
+	now := time.Now()
+	key, kid := s.signingKey()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":                s.cfg.Issuer,
+		"sub":                id.Subject,
+		"aud":                s.cfg.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(s.cfg.TokenTTL).Unix(),
+		"nonce":              nonce,
+		"email":              id.Email,
+		"email_verified":     true,
+		"preferred_username": id.PreferredUsername,
+	})
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
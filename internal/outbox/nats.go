@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const natsTimeout = 5 * time.Second
+
+// natsPublisher публикует события в NATS по текстовому протоколу ядра NATS.
+// Подтверждением доставки порции служит PONG на отправленный после нее PING.
+type natsPublisher struct {
+	addr    string
+	subject string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewNATSPublisher метод-конструктор EventPublisher для NATS.
+// События публикуются в темы вида "<subject>.<тип события>".
+func NewNATSPublisher(addr, subject string) EventPublisher {
+	return &natsPublisher{
+		addr:    addr,
+		subject: subject,
+	}
+}
+
+// Publish метод публикации порции событий в NATS.
+func (p *natsPublisher) Publish(events []types.DomainEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.publish(events); err != nil {
+		p.close()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) publish(events []types.DomainEvent) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	if err := p.conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(p.conn)
+	for i := range events {
+		data, err := json.Marshal(&events[i])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "PUB %s.%s %d\r\n%s\r\n", p.subject, events[i].Type, len(data), data)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := w.WriteString("PING\r\n"); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return p.waitPong()
+}
+
+// connect метод установки соединения и рукопожатия с сервером NATS.
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, natsTimeout)
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+	p.r = bufio.NewReader(conn)
+	if err = conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	_, err = fmt.Fprint(conn, "CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"gophermart\"}\r\nPING\r\n")
+	if err != nil {
+		return err
+	}
+	return p.waitPong()
+}
+
+// waitPong метод ожидания PONG с обработкой служебных сообщений сервера.
+func (p *natsPublisher) waitPong() error {
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			return nil
+		case strings.HasPrefix(line, "PING"):
+			if _, err = fmt.Fprint(p.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (p *natsPublisher) close() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn = nil
+	p.r = nil
+}
+
+// Close метод закрытия соединения с NATS.
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.close()
+	return nil
+}
@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// NewPublisher метод-конструктор EventPublisher по строке конфигурации:
+// "" или "discard" — события отбрасываются, "stdout" — JSONL в стандартный вывод,
+// "file:<path>" — JSONL в файл, "nats://host:port" — публикация в NATS с префиксом темы subject.
+func NewPublisher(sink, subject string) (EventPublisher, error) {
+	switch {
+	case sink == "" || sink == "discard":
+		return discardPublisher{}, nil
+	case sink == "stdout":
+		return NewWriterPublisher(os.Stdout), nil
+	case strings.HasPrefix(sink, "file:"):
+		return NewFilePublisher(strings.TrimPrefix(strings.TrimPrefix(sink, "file:"), "//"))
+	case strings.HasPrefix(sink, "nats://"):
+		return NewNATSPublisher(strings.TrimPrefix(sink, "nats://"), subject), nil
+	}
+	return nil, fmt.Errorf("unknown events sink %q", sink)
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish([]types.DomainEvent) error { return nil }
+
+func (discardPublisher) Close() error { return nil }
+
+type writerPublisher struct {
+	w io.Writer
+}
+
+// NewWriterPublisher метод-конструктор EventPublisher, пишущего события в формате JSONL в w.
+func NewWriterPublisher(w io.Writer) EventPublisher {
+	return &writerPublisher{w: w}
+}
+
+// Publish метод записи порции событий, по одному JSON-объекту на строку.
+func (p *writerPublisher) Publish(events []types.DomainEvent) error {
+	bw := bufio.NewWriter(p.w)
+	enc := json.NewEncoder(bw)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (p *writerPublisher) Close() error {
+	return nil
+}
+
+type filePublisher struct {
+	writerPublisher
+	f *os.File
+}
+
+// NewFilePublisher метод-конструктор EventPublisher, дописывающего события в формате JSONL в файл.
+func NewFilePublisher(path string) (EventPublisher, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &filePublisher{
+		writerPublisher: writerPublisher{w: f},
+		f:               f,
+	}, nil
+}
+
+// Publish метод записи порции событий в файл с принудительной синхронизацией на диск.
+func (p *filePublisher) Publish(events []types.DomainEvent) error {
+	if err := p.writerPublisher.Publish(events); err != nil {
+		return err
+	}
+	return p.f.Sync()
+}
+
+func (p *filePublisher) Close() error {
+	return p.f.Close()
+}
@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"log"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const (
+	batchSize     = 100
+	pollInterval  = time.Second
+	claimLease    = time.Minute
+	retention     = 24 * time.Hour
+	purgeInterval = time.Hour
+)
+
+// EventPublisher интерфейс публикации доменных событий во внешнюю шину.
+// Публикация должна быть идемпотентной для потребителя: при сбое порция событий будет отправлена повторно.
+type EventPublisher interface {
+	Publish(events []types.DomainEvent) error
+	Close() error
+}
+
+// Relay интерфейс фоновой пересылки событий из outbox в EventPublisher.
+type Relay interface {
+	Run()
+}
+
+// store хранилище outbox; реализуется *dao.DAO.
+type store interface {
+	ClaimOutbox(limit int, lease time.Duration) ([]types.DomainEvent, error)
+	MarkOutboxPublished(ids []int64) error
+	ReleaseOutbox(ids []int64) error
+	PurgeOutbox(retention time.Duration) error
+}
+
+type relay struct {
+	dao       store
+	publisher EventPublisher
+}
+
+// NewRelay метод-конструктор пересылки событий из outbox.
+func NewRelay(dao *dao.DAO, publisher EventPublisher) Relay {
+	return &relay{
+		dao:       dao,
+		publisher: publisher,
+	}
+}
+
+// Run метод запуска фоновой пересылки событий.
+func (r *relay) Run() {
+	go func() {
+		purged := time.Now()
+		for {
+			n, err := r.relay()
+			if err != nil {
+				log.Println("outbox relay:", err)
+			}
+			if time.Since(purged) > purgeInterval {
+				if err := r.dao.PurgeOutbox(retention); err != nil {
+					log.Println("outbox relay:", err)
+				}
+				purged = time.Now()
+			}
+			if err != nil || n < batchSize {
+				time.Sleep(pollInterval)
+			}
+		}
+	}()
+}
+
+// relay метод пересылки одной порции событий: события выбираются и откладываются в отдельной транзакции,
+// публикуются без открытой транзакции и только после успешной публикации помечаются опубликованными.
+// Возвращает количество выбранных событий.
+func (r *relay) relay() (int, error) {
+	events, err := r.dao.ClaimOutbox(batchSize, claimLease)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	ids := make([]int64, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+	if err = r.publisher.Publish(events); err != nil {
+		if rErr := r.dao.ReleaseOutbox(ids); rErr != nil {
+			log.Println("outbox relay:", rErr)
+		}
+		return len(events), err
+	}
+	return len(events), r.dao.MarkOutboxPublished(ids)
+}
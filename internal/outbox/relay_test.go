@@ -0,0 +1,239 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// natsMessage сообщение, принятое fakeNATS.
+type natsMessage struct {
+	subject string
+	event   types.DomainEvent
+}
+
+// fakeNATS сервер, реализующий часть текстового протокола NATS, достаточную для natsPublisher.
+type fakeNATS struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	messages []natsMessage
+	fail     bool
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{l: l}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	if _, err := io.WriteString(conn, "INFO {\"server_id\":\"fake\"}\r\n"); err != nil {
+		return
+	}
+	var pending []natsMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PUB":
+			n, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, n+2)
+			if _, err = io.ReadFull(r, payload); err != nil {
+				return
+			}
+			m := natsMessage{subject: fields[1]}
+			if err = json.Unmarshal(payload[:n], &m.event); err != nil {
+				return
+			}
+			pending = append(pending, m)
+		case "PING":
+			s.mu.Lock()
+			fail := s.fail
+			if !fail {
+				s.messages = append(s.messages, pending...)
+			}
+			s.mu.Unlock()
+			pending = nil
+			if fail {
+				_, _ = io.WriteString(conn, "-ERR 'Maximum Payload Violation'\r\n")
+				return
+			}
+			if _, err = io.WriteString(conn, "PONG\r\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeNATS) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func (s *fakeNATS) received() []natsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsMessage(nil), s.messages...)
+}
+
+// memStore outbox в памяти.
+type memStore struct {
+	mu        sync.Mutex
+	events    []types.DomainEvent
+	published map[int64]bool
+	claimed   map[int64]bool
+}
+
+func newMemStore(n int) *memStore {
+	s := &memStore{published: map[int64]bool{}, claimed: map[int64]bool{}}
+	for i := 1; i <= n; i++ {
+		s.events = append(s.events, types.DomainEvent{
+			ID:        int64(i),
+			Type:      types.EventOrderStatusChanged,
+			UserID:    1,
+			Payload:   json.RawMessage(`{"number":"79927398713"}`),
+			CreatedAt: time.Now().Format(time.RFC3339),
+		})
+	}
+	return s
+}
+
+func (s *memStore) ClaimOutbox(limit int, _ time.Duration) ([]types.DomainEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []types.DomainEvent
+	for _, e := range s.events {
+		if len(res) == limit {
+			break
+		}
+		if !s.published[e.ID] && !s.claimed[e.ID] {
+			s.claimed[e.ID] = true
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (s *memStore) MarkOutboxPublished(ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.published[id] = true
+		delete(s.claimed, id)
+	}
+	return nil
+}
+
+func (s *memStore) ReleaseOutbox(ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.claimed, id)
+	}
+	return nil
+}
+
+func (s *memStore) PurgeOutbox(time.Duration) error {
+	return nil
+}
+
+func (s *memStore) unpublished() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events) - len(s.published)
+}
+
+func TestRelayNATS(t *testing.T) {
+	srv := newFakeNATS(t)
+	st := newMemStore(batchSize + 5)
+	pub := NewNATSPublisher(srv.l.Addr().String(), "gophermart")
+	defer func() { _ = pub.Close() }()
+	r := &relay{dao: st, publisher: pub}
+
+	srv.setFail(true)
+	if _, err := r.relay(); err == nil {
+		t.Fatal("relay: error from broker not reported")
+	}
+	if got := st.unpublished(); got != len(st.events) {
+		t.Fatalf("after broker error %d events unpublished, want %d", got, len(st.events))
+	}
+
+	srv.setFail(false)
+	for _, want := range []int{batchSize, 5, 0} {
+		n, err := r.relay()
+		if err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		if n != want {
+			t.Fatalf("relay published %d events, want %d", n, want)
+		}
+	}
+	if got := st.unpublished(); got != 0 {
+		t.Errorf("%d events left unpublished", got)
+	}
+	got := srv.received()
+	if len(got) != len(st.events) {
+		t.Fatalf("broker received %d messages, want %d", len(got), len(st.events))
+	}
+	for i, m := range got {
+		if m.event.ID != int64(i+1) {
+			t.Fatalf("message %d carries event %d, events are out of order", i, m.event.ID)
+		}
+		if m.subject != "gophermart."+types.EventOrderStatusChanged {
+			t.Fatalf("message %d subject = %q", i, m.subject)
+		}
+	}
+}
+
+func TestRelayBrokerUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	st := newMemStore(3)
+	r := &relay{dao: st, publisher: NewNATSPublisher(addr, "gophermart")}
+	if _, err = r.relay(); err == nil {
+		t.Fatal("relay: unreachable broker not reported")
+	}
+	if got := st.unpublished(); got != 3 {
+		t.Errorf("%d events unpublished, want 3", got)
+	}
+	if events, _ := st.ClaimOutbox(batchSize, claimLease); len(events) != 3 {
+		t.Errorf("%d events claimable after failure, want 3", len(events))
+	}
+}
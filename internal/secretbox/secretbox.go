@@ -0,0 +1,63 @@
+// Package secretbox реализует шифрование секретов, хранимых в БД, алгоритмом AES-256-GCM.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// KeySize размер ключа шифрования в байтах.
+const KeySize = 32
+
+var (
+	ErrKeyInvalid        = errors.New("secretbox: key must be 32 bytes encoded in base64")
+	ErrCiphertextInvalid = errors.New("secretbox: invalid ciphertext")
+)
+
+// Box шифрование и расшифрование секретов одним ключом.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New метод-конструктор Box по ключу в кодировке base64.
+func New(encodedKey string) (*Box, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrKeyInvalid
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal метод шифрования секрета, результат в кодировке base64 содержит случайный nonce.
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Open метод расшифрования секрета, зашифрованного Seal.
+func (b *Box) Open(ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return nil, ErrCiphertextInvalid
+	}
+	n := b.aead.NonceSize()
+	plaintext, err := b.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, ErrCiphertextInvalid
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,81 @@
+package secretbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newTestBox(t *testing.T, fill byte) *Box {
+	t.Helper()
+	b, err := New(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, KeySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"valid", base64.StdEncoding.EncodeToString(make([]byte, KeySize)), nil},
+		{"short", base64.StdEncoding.EncodeToString(make([]byte, 16)), ErrKeyInvalid},
+		{"not base64", "not base64!", ErrKeyInvalid},
+		{"empty", "", ErrKeyInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.key); !errors.Is(err, tt.want) {
+				t.Errorf("New() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	box := newTestBox(t, 1)
+	plaintext := []byte("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+
+	sealed, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == again {
+		t.Error("Seal is deterministic, nonce is reused")
+	}
+	opened, err := box.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() = %q, want %q", opened, plaintext)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	tests := []struct {
+		name       string
+		box        *Box
+		ciphertext string
+	}{
+		{"tampered", box, base64.StdEncoding.EncodeToString(raw)},
+		{"other key", newTestBox(t, 2), sealed},
+		{"truncated", box, base64.StdEncoding.EncodeToString(raw[:4])},
+		{"not base64", box, "not base64!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.box.Open(tt.ciphertext); !errors.Is(err, ErrCiphertextInvalid) {
+				t.Errorf("Open() error = %v, want %v", err, ErrCiphertextInvalid)
+			}
+		})
+	}
+}
@@ -1,29 +1,98 @@
 package service
 
 import (
+	"net/http"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/config"
 	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/events"
+	"github.com/lipandr/yandex-practicum-diploma/internal/oidc"
+	"github.com/lipandr/yandex-practicum-diploma/internal/secretbox"
 	"github.com/lipandr/yandex-practicum-diploma/internal/types"
 )
 
 // Service интерфейс сервисного слоя приложения.
 type Service interface {
 	UserRegistration(user *types.UserRequest) (*types.AuthResponse, error)
+	CreateAdmin(user *types.UserRequest) error
 	UserAuthentication(user *types.UserRequest) (*types.AuthResponse, error)
-	ReceiveOrder(userID int, orderNumber string) error
+	ReceiveOrder(userID int, orderNumber string, goods []types.Good) error
+	ReceiveOrders(userID int, orderNumbers []string) ([]types.BatchOrderResult, error)
 	GetOrders(userID int) ([]types.Order, error)
+	GetOrder(userID int, orderNumber string) (*types.OrderInfo, error)
+	GetOrderEvents(userID int, afterID int64) ([]types.OrderEvent, error)
+	SubscribeOrderEvents(userID int) (<-chan *types.OrderEvent, func())
 	GetBalance(userID int) (float64, float64, error)
+	GetPendingPoints(userID int) (float64, error)
+	TransferPoints(userID int, req *types.TransferRequest) (*types.Transfer, error)
+	GetExpiringPoints(userID int) ([]types.ExpiringPoints, error)
+	GetBalanceHistory(userID int) ([]types.BalanceEntry, error)
 	WithdrawRequest(userID int, order string, sum float64) error
 	GetWithdrawals(userID int) ([]types.Withdraw, error)
-	GetUserIDByToken(token string) (int, error)
+	CancelWithdrawal(userID int, orderNumber string) (*types.Withdraw, error)
+	BeginIdempotentRequest(userID int, key, requestHash string) (*types.IdempotentResponse, error)
+	CompleteIdempotentRequest(userID int, key string, resp *types.IdempotentResponse) error
+	ReleaseIdempotencyKey(userID int, key string) error
+	GetPrincipal(token string) (*types.Principal, error)
+	GetPrincipalByAPIKey(key string) (*types.Principal, error)
+	CreateAPIKey(userID int, req *types.APIKeyRequest) (*types.APIKey, error)
+	GetAPIKeys(userID int) ([]types.APIKey, error)
+	RevokeAPIKey(userID, keyID int) error
+	OIDCAuthURL(linkUserID int) (string, string, error)
+	OIDCCallback(code, state string) (*types.AuthResponse, error)
+	EnrollTwoFactor(userID int) (*types.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(userID int, code string) ([]string, error)
+	DisableTwoFactor(userID int, code string) error
+	CompleteTwoFactorLogin(challenge, code string) (*types.AuthResponse, error)
+	Ping() error
+	RegisterWebhook(userID int, req *types.WebhookRequest) (*types.Webhook, error)
+	GetWebhooks(userID int) ([]types.Webhook, error)
+	DeleteWebhook(userID, webhookID int) error
+	GetWebhookDeliveries(userID, webhookID int) ([]types.WebhookDelivery, error)
+	SearchUsers(login string) ([]types.AdminUser, error)
+	GetAdminUser(userID int) (*types.AdminUser, error)
+	SetUserBlocked(userID int, blocked bool) error
+	SetUserRole(userID int, role string) error
+	RepollOrder(orderNumber string) error
+	InvalidateOrder(orderNumber string) error
+	AdjustBalance(operatorID, userID int, req *types.AdjustmentRequest) (*types.BalanceAdjustment, error)
+	GetBalanceAdjustments(userID int) ([]types.BalanceAdjustment, error)
+	ReverseWithdrawal(operatorID int, orderNumber string, req *types.ReversalRequest) (*types.Withdraw, error)
+	ReturnOrder(operatorID int, orderNumber string, req *types.ReturnRequest) (*types.OrderReturn, error)
 }
 
 type service struct {
-	dao *dao.DAO
+	cfg  config.Config
+	dao  *dao.DAO
+	hub  events.Hub
+	oidc *oidc.Provider
+	totp *secretbox.Box
 }
 
 // NewService метод-конструктор Service.
-func NewService(dao *dao.DAO) (*service, error) {
-	return &service{
+// Вход через внешнего провайдера доступен, если задан cfg.OIDCIssuer,
+// двухфакторная аутентификация - если задан ключ шифрования секретов cfg.TOTPEncryptionKey.
+func NewService(cfg config.Config, dao *dao.DAO, hub events.Hub) (*service, error) {
+	svc := &service{
+		cfg: cfg,
 		dao: dao,
-	}, nil
+		hub: hub,
+	}
+	if cfg.OIDCIssuer != "" {
+		svc.oidc = oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		}, &http.Client{Timeout: oidcTimeout})
+	}
+	if cfg.TOTPEncryptionKey != "" {
+		box, err := secretbox.New(cfg.TOTPEncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		svc.totp = box
+	}
+	return svc, nil
 }
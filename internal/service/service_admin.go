@@ -0,0 +1,166 @@
+package service
+
+import (
+	"math"
+	"strings"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// SearchUsers метод Service поиска пользователей по логину.
+func (svc *service) SearchUsers(login string) ([]types.AdminUser, error) {
+	return svc.dao.SearchUsers(strings.TrimSpace(login))
+}
+
+// GetAdminUser метод Service получения сведений о пользователе.
+func (svc *service) GetAdminUser(userID int) (*types.AdminUser, error) {
+	return svc.dao.GetAdminUser(userID)
+}
+
+// SetUserBlocked метод Service блокировки или разблокировки пользователя.
+func (svc *service) SetUserBlocked(userID int, blocked bool) error {
+	return svc.dao.SetUserBlocked(userID, blocked)
+}
+
+// SetUserRole метод Service назначения роли пользователю.
+func (svc *service) SetUserRole(userID int, role string) error {
+	if _, ok := types.RolePermissions[role]; !ok {
+		return types.ErrRoleUnknown
+	}
+	return svc.dao.SetUserRole(userID, role)
+}
+
+// RepollOrder метод Service постановки заказа на внеочередной опрос системы начислений.
+func (svc *service) RepollOrder(orderNumber string) error {
+	return svc.dao.ScheduleOrderRepoll(orderNumber)
+}
+
+// InvalidateOrder метод Service ручного перевода заказа в статус INVALID.
+func (svc *service) InvalidateOrder(orderNumber string) error {
+	e, err := svc.dao.InvalidateOrder(orderNumber)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		svc.hub.Publish(e)
+	}
+	return nil
+}
+
+// AdjustBalance метод Service ручной корректировки баланса пользователя оператором operatorID.
+func (svc *service) AdjustBalance(operatorID, userID int, req *types.AdjustmentRequest) (*types.BalanceAdjustment, error) {
+	amount := math.Round(req.Amount*100) / 100
+	reason := strings.TrimSpace(req.Reason)
+	if amount == 0 || reason == "" {
+		return nil, types.ErrAdjustmentInvalid
+	}
+	adj := &types.BalanceAdjustment{
+		UserID:     userID,
+		Amount:     amount,
+		Reason:     reason,
+		OperatorID: operatorID,
+	}
+	if err := svc.dao.NewBalanceAdjustment(adj); err != nil {
+		return nil, err
+	}
+	return adj, nil
+}
+
+// GetBalanceAdjustments метод Service получения списка корректировок баланса пользователя.
+func (svc *service) GetBalanceAdjustments(userID int) ([]types.BalanceAdjustment, error) {
+	return svc.dao.GetBalanceAdjustments(userID)
+}
+
+// ReverseWithdrawal метод Service сторнирования завершенного списания оператором operatorID.
+func (svc *service) ReverseWithdrawal(operatorID int, orderNumber string, req *types.ReversalRequest) (*types.Withdraw, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, types.ErrReversalInvalid
+	}
+	return svc.dao.ReverseWithdrawal(orderNumber, operatorID, reason)
+}
+
+// ReturnOrder метод Service возврата заказа оператором operatorID с отзывом баллов с баланса пользователя.
+// При возврате товаров начисление уменьшается пропорционально их доле в стоимости заказа.
+// Если отрицательный баланс не разрешен, с баланса списывается не более доступных и удерживаемых баллов.
+func (svc *service) ReturnOrder(operatorID int, orderNumber string, req *types.ReturnRequest) (*types.OrderReturn, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, types.ErrReturnInvalid
+	}
+	o, err := svc.dao.GetReturnableOrder(orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	var revised float64
+	var goods []types.Good
+	switch {
+	case req.Full:
+		revised = 0
+	case req.Accrual != nil:
+		revised = math.Round(*req.Accrual*100) / 100
+	case len(req.Goods) > 0:
+		if revised, goods, err = revisedByGoods(o, req.Goods); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, types.ErrReturnInvalid
+	}
+	if revised < 0 || revised >= o.Accrual {
+		return nil, types.ErrReturnInvalid
+	}
+
+	return svc.dao.NewOrderReturn(orderNumber, revised, goods, svc.cfg.AllowNegativeBalance, reason, operatorID)
+}
+
+// revisedByGoods метод-helper пересчета начисления заказа o после возврата товаров goods.
+// Товары сопоставляются по описанию с частью состава заказа, которая еще не возвращалась;
+// цена берется из состава заказа. Возвращает новое начисление и возвращаемые товары с ценами.
+// Если товара с таким описанием в заказе нет, возвращает ErrReturnInvalid, а если все такие товары
+// уже возвращены - ErrGoodsReturned.
+func revisedByGoods(o *types.ReturnableOrder, goods []types.Good) (float64, []types.Good, error) {
+	if len(o.Goods) == 0 {
+		return 0, nil, types.ErrGoodsUnavailable
+	}
+	var total float64
+	left := make(map[string][]float64)
+	for _, g := range o.Goods {
+		total += g.Price
+		left[g.Description] = append(left[g.Description], g.Price)
+	}
+	if total <= 0 {
+		return 0, nil, types.ErrGoodsUnavailable
+	}
+	for _, g := range o.Returned {
+		left[g.Description] = removePrice(left[g.Description], g.Price)
+	}
+	var returned float64
+	matched := make([]types.Good, 0, len(goods))
+	for _, g := range goods {
+		prices, ok := left[g.Description]
+		if !ok {
+			return 0, nil, types.ErrReturnInvalid
+		}
+		if len(prices) == 0 {
+			return 0, nil, types.ErrGoodsReturned
+		}
+		returned += prices[0]
+		matched = append(matched, types.Good{Description: g.Description, Price: prices[0]})
+		left[g.Description] = prices[1:]
+	}
+	revised := o.Accrual - o.Original*returned/total
+	return math.Max(0, math.Round(revised*100)/100), matched, nil
+}
+
+// removePrice метод-helper исключения из prices одного товара с ценой price.
+func removePrice(prices []float64, price float64) []float64 {
+	for i, p := range prices {
+		if p == price {
+			return append(prices[:i:i], prices[i+1:]...)
+		}
+	}
+	if len(prices) > 0 {
+		return prices[1:]
+	}
+	return prices
+}
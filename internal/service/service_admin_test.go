@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestRevisedByGoods(t *testing.T) {
+	goods := []types.Good{
+		{Description: "Чайник", Price: 7000},
+		{Description: "Кружка", Price: 1500},
+		{Description: "Кружка", Price: 1500},
+	}
+	tests := []struct {
+		name     string
+		order    types.ReturnableOrder
+		returned []types.Good
+		want     float64
+		wantErr  error
+	}{
+		{
+			name:     "one item",
+			order:    types.ReturnableOrder{Original: 500, Accrual: 500, Goods: goods},
+			returned: []types.Good{{Description: "Кружка"}},
+			want:     425,
+		},
+		{
+			name:     "all items",
+			order:    types.ReturnableOrder{Original: 500, Accrual: 500, Goods: goods},
+			returned: []types.Good{{Description: "Чайник"}, {Description: "Кружка"}, {Description: "Кружка"}},
+			want:     0,
+		},
+		{
+			name: "second return of the same description",
+			order: types.ReturnableOrder{Original: 500, Accrual: 425, Goods: goods,
+				Returned: []types.Good{{Description: "Кружка", Price: 1500}}},
+			returned: []types.Good{{Description: "Кружка"}},
+			want:     350,
+		},
+		{
+			name: "item already returned",
+			order: types.ReturnableOrder{Original: 500, Accrual: 150, Goods: goods,
+				Returned: []types.Good{{Description: "Чайник", Price: 7000}}},
+			returned: []types.Good{{Description: "Чайник"}},
+			wantErr:  types.ErrGoodsReturned,
+		},
+		{
+			name:     "more items than ordered",
+			order:    types.ReturnableOrder{Original: 500, Accrual: 500, Goods: goods},
+			returned: []types.Good{{Description: "Кружка"}, {Description: "Кружка"}, {Description: "Кружка"}},
+			wantErr:  types.ErrGoodsReturned,
+		},
+		{
+			name:     "unknown item",
+			order:    types.ReturnableOrder{Original: 500, Accrual: 500, Goods: goods},
+			returned: []types.Good{{Description: "Ложка"}},
+			wantErr:  types.ErrReturnInvalid,
+		},
+		{
+			name:     "goods unknown",
+			order:    types.ReturnableOrder{Original: 500, Accrual: 500},
+			returned: []types.Good{{Description: "Кружка"}},
+			wantErr:  types.ErrGoodsUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matched, err := revisedByGoods(&tt.order, tt.returned)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("revisedByGoods() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("revisedByGoods() = %v, want %v", got, tt.want)
+			}
+			if len(matched) != len(tt.returned) {
+				t.Errorf("revisedByGoods() matched %d goods, want %d", len(matched), len(tt.returned))
+			}
+		})
+	}
+}
+
+func TestAdminValidation(t *testing.T) {
+	svc := &service{}
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{
+			name: "zero adjustment",
+			call: func() error {
+				_, err := svc.AdjustBalance(1, 2, &types.AdjustmentRequest{Amount: 0.001, Reason: "компенсация"})
+				return err
+			},
+			want: types.ErrAdjustmentInvalid,
+		},
+		{
+			name: "adjustment without reason",
+			call: func() error {
+				_, err := svc.AdjustBalance(1, 2, &types.AdjustmentRequest{Amount: 100, Reason: " "})
+				return err
+			},
+			want: types.ErrAdjustmentInvalid,
+		},
+		{
+			name: "unknown role",
+			call: func() error { return svc.SetUserRole(2, "owner") },
+			want: types.ErrRoleUnknown,
+		},
+		{
+			name: "reversal without reason",
+			call: func() error {
+				_, err := svc.ReverseWithdrawal(1, "79927398713", &types.ReversalRequest{Reason: "\t"})
+				return err
+			},
+			want: types.ErrReversalInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// Формат API-ключа: apiKeyScheme_<префикс>_<секрет>. Префикс хранится открыто и служит для поиска ключа.
+const (
+	apiKeyScheme       = "gm"
+	apiKeyPrefixLength = 12
+	apiKeySecretLength = 40
+)
+
+// CreateAPIKey метод Service выпуска API-ключа пользователя.
+func (svc *service) CreateAPIKey(userID int, req *types.APIKeyRequest) (*types.APIKey, error) {
+	if len(req.Scopes) == 0 {
+		return nil, types.ErrAPIKeyScopeUnknown
+	}
+	for _, s := range req.Scopes {
+		if !isAPIKeyScope(s) {
+			return nil, types.ErrAPIKeyScopeUnknown
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil || !t.After(time.Now()) {
+			return nil, types.ErrAPIKeyExpiryInvalid
+		}
+		expiresAt = &t
+	}
+	prefix, err := svc.generateToken(apiKeyPrefixLength)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := svc.generateToken(apiKeySecretLength)
+	if err != nil {
+		return nil, err
+	}
+	k := &types.APIKey{
+		UserID: userID,
+		Name:   strings.TrimSpace(req.Name),
+		Prefix: prefix,
+		Scopes: req.Scopes,
+		Key:    strings.Join([]string{apiKeyScheme, prefix, secret}, "_"),
+	}
+	if expiresAt != nil {
+		k.ExpiresAt = expiresAt.Local().Format(time.RFC3339)
+	}
+	if err = svc.dao.NewAPIKey(k, hashAPIKeySecret(secret), expiresAt); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// GetAPIKeys метод Service получения списка API-ключей пользователя.
+func (svc *service) GetAPIKeys(userID int) ([]types.APIKey, error) {
+	return svc.dao.GetAPIKeys(userID)
+}
+
+// RevokeAPIKey метод Service отзыва API-ключа пользователя.
+func (svc *service) RevokeAPIKey(userID, keyID int) error {
+	return svc.dao.RevokeAPIKey(userID, keyID)
+}
+
+// GetPrincipalByAPIKey метод Service аутентификации по API-ключу.
+func (svc *service) GetPrincipalByAPIKey(key string) (*types.Principal, error) {
+	prefix, secret, err := parseAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+	p, secretHash, err := svc.dao.GetAPIKeyPrincipal(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, types.ErrAPIKeyInvalid
+	}
+	if err = svc.dao.TouchAPIKey(p.APIKeyID); err != nil {
+		log.Println(err)
+	}
+	return p, nil
+}
+
+// parseAPIKey метод-helper разбора API-ключа на префикс и секрет.
+func parseAPIKey(key string) (string, string, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyScheme ||
+		len(parts[1]) != apiKeyPrefixLength || len(parts[2]) != apiKeySecretLength {
+		return "", "", types.ErrAPIKeyInvalid
+	}
+	return parts[1], parts[2], nil
+}
+
+// hashAPIKeySecret метод-helper вычисления хеша секрета API-ключа.
+// Секрет генерируется случайно и достаточно длинный, поэтому медленное хеширование не требуется.
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAPIKeyScope(scope string) bool {
+	for _, s := range types.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	prefix := strings.Repeat("p", apiKeyPrefixLength)
+	secret := strings.Repeat("s", apiKeySecretLength)
+	tests := []struct {
+		name       string
+		key        string
+		wantPrefix string
+		wantSecret string
+		wantErr    error
+	}{
+		{"valid", "gm_" + prefix + "_" + secret, prefix, secret, nil},
+		{"other scheme", "xx_" + prefix + "_" + secret, "", "", types.ErrAPIKeyInvalid},
+		{"no secret", "gm_" + prefix, "", "", types.ErrAPIKeyInvalid},
+		{"short prefix", "gm_abc_" + secret, "", "", types.ErrAPIKeyInvalid},
+		{"short secret", "gm_" + prefix + "_abc", "", "", types.ErrAPIKeyInvalid},
+		{"empty", "", "", "", types.ErrAPIKeyInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, secret, err := parseAPIKey(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseAPIKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if prefix != tt.wantPrefix || secret != tt.wantSecret {
+				t.Errorf("parseAPIKey() = %q, %q, want %q, %q", prefix, secret, tt.wantPrefix, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestHashAPIKeySecret(t *testing.T) {
+	// SHA-256("abc") из FIPS 180-2
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := hashAPIKeySecret("abc"); got != want {
+		t.Errorf("hashAPIKeySecret(abc) = %s, want %s", got, want)
+	}
+	if hashAPIKeySecret("abc") == hashAPIKeySecret("abd") {
+		t.Error("different secrets have the same hash")
+	}
+}
+
+func TestIsAPIKeyScope(t *testing.T) {
+	for _, s := range types.APIKeyScopes {
+		if !isAPIKeyScope(s) {
+			t.Errorf("isAPIKeyScope(%q) = false", s)
+		}
+	}
+	for _, s := range []string{types.PermTransfer, types.PermAPIKeys, types.PermRolesManage, ""} {
+		if isAPIKeyScope(s) {
+			t.Errorf("isAPIKeyScope(%q) = true, API keys must not get it", s)
+		}
+	}
+}
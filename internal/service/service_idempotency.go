@@ -0,0 +1,21 @@
+package service
+
+import (
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// BeginIdempotentRequest метод Service начала выполнения запроса с ключом идемпотентности.
+// Возвращает сохраненный ответ, если запрос с этим ключом уже был выполнен.
+func (svc *service) BeginIdempotentRequest(userID int, key, requestHash string) (*types.IdempotentResponse, error) {
+	return svc.dao.BeginIdempotentRequest(userID, key, requestHash, svc.cfg.IdempotencyKeyTTL)
+}
+
+// CompleteIdempotentRequest метод Service сохранения ответа на запрос с ключом идемпотентности.
+func (svc *service) CompleteIdempotentRequest(userID int, key string, resp *types.IdempotentResponse) error {
+	return svc.dao.CompleteIdempotentRequest(userID, key, resp)
+}
+
+// ReleaseIdempotencyKey метод Service освобождения ключа идемпотентности запроса, завершившегося ошибкой сервера.
+func (svc *service) ReleaseIdempotencyKey(userID int, key string) error {
+	return svc.dao.ReleaseIdempotencyKey(userID, key)
+}
@@ -2,9 +2,12 @@ package service
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"net/http"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -18,14 +21,31 @@ func (svc *service) UserRegistration(user *types.UserRequest) (*types.AuthRespon
 		return nil, err
 	}
 	encPass := string(b)
-	_, err = svc.dao.NewUser(user.Login, encPass)
+	_, err = svc.dao.NewUser(user.Login, encPass, types.RoleUser)
 	if err != nil {
 		return nil, types.ErrUsersAlreadyExists
 	}
 	return svc.UserAuthentication(user)
 }
 
+// CreateAdmin метод Service создания оператором учетной записи администратора.
+// Существующие учетные записи администраторами не становятся: их роль меняется только через API администратора.
+func (svc *service) CreateAdmin(user *types.UserRequest) error {
+	if user.Login == "" || user.Password == "" {
+		return types.ErrUsersNotAuthenticated
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if _, err = svc.dao.NewUser(user.Login, string(b), types.RoleAdmin); err != nil {
+		return types.ErrUsersAlreadyExists
+	}
+	return nil
+}
+
 // UserAuthentication метод Service аутентификации существующего пользователя.
+// При включенной двухфакторной аутентификации токен выдается после CompleteTwoFactorLogin.
 func (svc *service) UserAuthentication(user *types.UserRequest) (*types.AuthResponse, error) {
 	u, err := svc.dao.GetUserByLogin(user.Login)
 	if err != nil {
@@ -35,11 +55,16 @@ func (svc *service) UserAuthentication(user *types.UserRequest) (*types.AuthResp
 	if err != nil {
 		return nil, types.ErrUsersNotAuthenticated
 	}
+	return svc.completeLogin(u.ID)
+}
+
+// issueToken метод Service выдачи пользователю нового токена авторизации.
+func (svc *service) issueToken(userID int) (*types.AuthResponse, error) {
 	token, err := svc.generateToken(64)
 	if err != nil {
 		return nil, err
 	}
-	err = svc.dao.SaveToken(u.ID, token)
+	err = svc.dao.SaveToken(userID, token)
 	if err != nil {
 		return nil, err
 	}
@@ -48,13 +73,19 @@ func (svc *service) UserAuthentication(user *types.UserRequest) (*types.AuthResp
 	}, nil
 }
 
-// GetUserIDByToken метод Service получения пользователя по токену.
-func (svc *service) GetUserIDByToken(token string) (int, error) {
+// GetPrincipal метод Service получения пользователя и его роли по токену.
+func (svc *service) GetPrincipal(token string) (*types.Principal, error) {
 	return svc.dao.GetToken(token)
 }
 
+// Ping метод Service проверки доступности хранилища.
+func (svc *service) Ping() error {
+	return svc.dao.Ping()
+}
+
 // ReceiveOrder метод Service добавления нового заказа для расчета начислений.
-func (svc *service) ReceiveOrder(userID int, orderNumber string) error {
+// Если включена регистрация заказов, заказ с составом goods пересылается в систему начислений через outbox.
+func (svc *service) ReceiveOrder(userID int, orderNumber string, goods []types.Good) error {
 	// проверка - были ли списания по заказу
 	if err := svc.dao.IsOrderWithdrawn(orderNumber); err != nil {
 		return err
@@ -63,12 +94,48 @@ func (svc *service) ReceiveOrder(userID int, orderNumber string) error {
 	if err := svc.dao.IsOrderExists(userID, orderNumber); err != nil {
 		return err
 	}
-	if err := svc.dao.NewOrder(userID, orderNumber); err != nil {
+	if err := svc.dao.NewOrder(userID, orderNumber, goods, svc.cfg.AccrualRegisterOrders); err != nil {
 		return err
 	}
 	return nil
 }
 
+// ReceiveOrders метод Service пакетного добавления заказов для расчета начислений.
+func (svc *service) ReceiveOrders(userID int, orderNumbers []string) ([]types.BatchOrderResult, error) {
+	errs, err := svc.dao.NewOrders(userID, orderNumbers, svc.cfg.AccrualRegisterOrders)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]types.BatchOrderResult, len(orderNumbers))
+	for i, orderNumber := range orderNumbers {
+		res[i] = batchOrderResult(orderNumber, errs[i])
+	}
+	return res, nil
+}
+
+// batchOrderResult метод-helper получения результата пакетной загрузки заказа по ошибке его сохранения.
+func batchOrderResult(orderNumber string, err error) types.BatchOrderResult {
+	res := types.BatchOrderResult{
+		Number: orderNumber,
+		Status: http.StatusAccepted,
+		Result: types.BatchOrderAccepted,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, types.ErrOrderUploadedByUser):
+		res.Status = http.StatusOK
+		res.Result = types.BatchOrderUploadedByUser
+	case errors.Is(err, types.ErrOrderUploadedByOtherUser):
+		res.Status = http.StatusConflict
+		res.Result = types.BatchOrderUploadedByAnother
+	default:
+		res.Status = http.StatusUnprocessableEntity
+		res.Result = types.BatchOrderInvalid
+		res.Error = err.Error()
+	}
+	return res
+}
+
 // GetOrders метод Service получения списка заказов для расчета начислений пользователя.
 func (svc *service) GetOrders(userID int) ([]types.Order, error) {
 	orders, err := svc.dao.GetOrderList(userID)
@@ -78,9 +145,26 @@ func (svc *service) GetOrders(userID int) ([]types.Order, error) {
 	return orders, nil
 }
 
-// GetBalance метод Service получения баланса начислений пользователя.
+// GetOrder метод Service получения информации о заказе пользователя.
+func (svc *service) GetOrder(userID int, orderNumber string) (*types.OrderInfo, error) {
+	return svc.dao.GetOrder(userID, orderNumber)
+}
+
+// GetOrderEvents метод Service получения событий по заказам пользователя после указанного.
+func (svc *service) GetOrderEvents(userID int, afterID int64) ([]types.OrderEvent, error) {
+	return svc.dao.GetOrderEvents(userID, afterID)
+}
+
+// SubscribeOrderEvents метод Service подписки на события по заказам пользователя.
+func (svc *service) SubscribeOrderEvents(userID int) (<-chan *types.OrderEvent, func()) {
+	return svc.hub.Subscribe(userID)
+}
+
+// GetBalance метод Service получения доступного для списания баланса пользователя и суммы списаний.
+// Учитываются ручные корректировки, переводы, сгоревшие и отозванные по возвратам баллы,
+// баллы на удержании не учитываются.
 func (svc *service) GetBalance(userID int) (float64, float64, error) {
-	a, err := svc.dao.GetAccruals(userID)
+	b, err := svc.dao.GetAvailableBalance(userID)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -89,7 +173,6 @@ func (svc *service) GetBalance(userID int) (float64, float64, error) {
 		fmt.Println(err)
 		return 0, 0, err
 	}
-	b := math.Round((a-w)*100) / 100
 	return b, w, nil
 }
 
@@ -99,19 +182,27 @@ func (svc *service) WithdrawRequest(userID int, orderNumber string, sum float64)
 	if err := svc.dao.IsOrderWithdrawn(orderNumber); err != nil {
 		return err
 	}
-	b, _, err := svc.GetBalance(userID)
-	if err != nil {
-		return err
-	}
-	if b < sum {
-		return types.ErrInsufficientAccruals
-	}
-	if err = svc.dao.NewWithdrawal(userID, sum, orderNumber); err != nil {
+	// достаточность баланса проверяется в транзакции списания
+	if err := svc.dao.NewWithdrawal(userID, sum, orderNumber); err != nil {
 		return err
 	}
 	return nil
 }
 
+// TransferPoints метод Service перевода баллов пользователя другому пользователю в пределах дневных лимитов.
+func (svc *service) TransferPoints(userID int, req *types.TransferRequest) (*types.Transfer, error) {
+	login := strings.TrimSpace(req.Login)
+	sum := math.Round(req.Sum*100) / 100
+	if login == "" || sum <= 0 {
+		return nil, types.ErrTransferInvalid
+	}
+	limits := types.TransferLimits{
+		Sum:   svc.cfg.TransferDailySum,
+		Count: svc.cfg.TransferDailyCount,
+	}
+	return svc.dao.NewBalanceTransfer(userID, login, sum, strings.TrimSpace(req.Comment), limits)
+}
+
 // GetWithdrawals метод Service получения списка списаний пользователя.
 func (svc *service) GetWithdrawals(userID int) ([]types.Withdraw, error) {
 	res, err := svc.dao.GetWithdrawalsList(userID)
@@ -121,6 +212,30 @@ func (svc *service) GetWithdrawals(userID int) ([]types.Withdraw, error) {
 	return res, nil
 }
 
+// GetPendingPoints метод Service получения баллов пользователя, период удержания которых не истек.
+func (svc *service) GetPendingPoints(userID int) (float64, error) {
+	p, err := svc.dao.GetPendingPoints(userID)
+	if err != nil {
+		return 0, err
+	}
+	return math.Round(p*100) / 100, nil
+}
+
+// GetExpiringPoints метод Service получения баллов пользователя, которые скоро сгорят.
+func (svc *service) GetExpiringPoints(userID int) ([]types.ExpiringPoints, error) {
+	return svc.dao.GetExpiringPoints(userID, svc.cfg.PointsExpiringSoon)
+}
+
+// GetBalanceHistory метод Service получения истории баланса пользователя.
+func (svc *service) GetBalanceHistory(userID int) ([]types.BalanceEntry, error) {
+	return svc.dao.GetBalanceHistory(userID)
+}
+
+// CancelWithdrawal метод Service отмены списания пользователем в течение срока отмены.
+func (svc *service) CancelWithdrawal(userID int, orderNumber string) (*types.Withdraw, error) {
+	return svc.dao.CancelWithdrawal(userID, orderNumber, svc.cfg.WithdrawalGracePeriod)
+}
+
 // generateToken метод Service генерации случайного токена для авторизации пользователя.
 func (svc *service) generateToken(n int) (string, error) {
 	const letters = "zxcvbnmasdfghjklqwertyuiop1234567890"
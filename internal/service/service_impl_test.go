@@ -0,0 +1,33 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestBatchOrderResult(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want types.BatchOrderResult
+	}{
+		{"accepted", nil,
+			types.BatchOrderResult{Number: "79927398713", Status: http.StatusAccepted, Result: types.BatchOrderAccepted}},
+		{"uploaded by user", types.ErrOrderUploadedByUser,
+			types.BatchOrderResult{Number: "79927398713", Status: http.StatusOK, Result: types.BatchOrderUploadedByUser}},
+		{"uploaded by another user", types.ErrOrderUploadedByOtherUser,
+			types.BatchOrderResult{Number: "79927398713", Status: http.StatusConflict, Result: types.BatchOrderUploadedByAnother}},
+		{"already withdrawn", types.ErrOrderAlreadyWithdrawn,
+			types.BatchOrderResult{Number: "79927398713", Status: http.StatusUnprocessableEntity,
+				Result: types.BatchOrderInvalid, Error: types.ErrOrderAlreadyWithdrawn.Error()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchOrderResult("79927398713", tt.err); got != tt.want {
+				t.Errorf("batchOrderResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
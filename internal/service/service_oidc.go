@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/oidc"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const (
+	// oidcTimeout таймаут запросов к внешнему провайдеру.
+	oidcTimeout = 10 * time.Second
+	// oidcStateTTL время, отведенное пользователю на вход у внешнего провайдера.
+	oidcStateTTL = 10 * time.Minute
+)
+
+// OIDCAuthURL метод Service начала входа через внешнего провайдера, возвращает адрес авторизации и state.
+// State должен быть привязан к браузеру, начавшему вход, и сверен при завершении входа.
+// При linkUserID != 0 внешняя учетная запись по завершении входа привязывается к этому пользователю.
+func (svc *service) OIDCAuthURL(linkUserID int) (string, string, error) {
+	if svc.oidc == nil {
+		return "", "", types.ErrOIDCDisabled
+	}
+	state, err := svc.generateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := svc.generateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	st := &types.OIDCState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       linkUserID,
+	}
+	if err = svc.dao.SaveOIDCState(st, oidcStateTTL); err != nil {
+		return "", "", err
+	}
+	u, err := svc.oidc.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		return "", "", err
+	}
+	return u, state, nil
+}
+
+// OIDCCallback метод Service завершения входа через внешнего провайдера.
+// Пользователь находится по привязанной внешней учетной записи либо регистрируется без пароля.
+func (svc *service) OIDCCallback(code, state string) (*types.AuthResponse, error) {
+	if svc.oidc == nil {
+		return nil, types.ErrOIDCDisabled
+	}
+	st, err := svc.dao.TakeOIDCState(state, oidcStateTTL)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := svc.oidc.Exchange(code, st.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := svc.oidc.Verify(idToken, st.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	userID := st.UserID
+	if userID != 0 {
+		err = svc.dao.LinkIdentity(userID, claims.Issuer, claims.Subject, claims.Email)
+	} else {
+		userID, err = svc.dao.GetUserByIdentity(claims.Issuer, claims.Subject)
+		if errors.Is(err, types.ErrUserNotFound) {
+			userID, err = svc.registerExternalUser(claims)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	u, err := svc.dao.GetAdminUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Blocked {
+		return nil, types.ErrUserBlocked
+	}
+	return svc.completeLogin(userID)
+}
+
+// registerExternalUser метод Service регистрации пользователя внешнего провайдера с ролью types.RoleUser.
+// Логином становится первое свободное из preferred_username, email и sub. Эти значения задает
+// сам пользователь у провайдера, поэтому логин не дает никаких прав сверх обычного пользователя.
+func (svc *service) registerExternalUser(claims *oidc.Claims) (int, error) {
+	var last string
+	for _, login := range []string{claims.PreferredUsername, claims.Email, claims.Subject} {
+		if login == "" {
+			continue
+		}
+		last = login
+		id, err := svc.dao.NewExternalUser(login, claims.Issuer, claims.Subject, claims.Email)
+		if !errors.Is(err, types.ErrUsersAlreadyExists) {
+			return id, err
+		}
+	}
+	suffix, err := svc.generateToken(6)
+	if err != nil {
+		return 0, err
+	}
+	return svc.dao.NewExternalUser(last+"-"+suffix, claims.Issuer, claims.Subject, claims.Email)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/totp"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+const (
+	// recoveryCodesCount количество резервных кодов, выдаваемых при включении двухфакторной аутентификации.
+	recoveryCodesCount = 10
+	// recoveryCodeSize длина половины резервного кода.
+	recoveryCodeSize = 5
+	// challengeMaxAttempts количество попыток ввода кода для одного входа.
+	challengeMaxAttempts = 5
+)
+
+// EnrollTwoFactor метод Service подключения двухфакторной аутентификации.
+// Секрет сохраняется зашифрованным и начинает действовать после подтверждения кодом.
+func (svc *service) EnrollTwoFactor(userID int) (*types.TwoFactorEnrollment, error) {
+	if svc.totp == nil {
+		return nil, types.ErrTwoFactorDisabled
+	}
+	u, err := svc.dao.GetAdminUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := svc.totp.Seal([]byte(secret))
+	if err != nil {
+		return nil, err
+	}
+	if err = svc.dao.SaveTOTPSecret(userID, enc); err != nil {
+		return nil, err
+	}
+	return &types.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(svc.cfg.TOTPIssuer, u.Login, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor метод Service подтверждения подключения двухфакторной аутентификации первым кодом.
+// Возвращает резервные коды; в хранилище сохраняются только их хеши.
+func (svc *service) ConfirmTwoFactor(userID int, code string) ([]string, error) {
+	s, err := svc.dao.GetTOTPSecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.Enabled {
+		return nil, types.ErrTwoFactorEnabled
+	}
+	if err = svc.checkTOTP(userID, s, code); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		head, err := svc.generateToken(recoveryCodeSize)
+		if err != nil {
+			return nil, err
+		}
+		tail, err := svc.generateToken(recoveryCodeSize)
+		if err != nil {
+			return nil, err
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(head+tail), bcrypt.MinCost)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, head+"-"+tail)
+		hashes = append(hashes, string(h))
+	}
+	if err = svc.dao.EnableTwoFactor(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor метод Service отключения двухфакторной аутентификации по действующему или резервному коду.
+func (svc *service) DisableTwoFactor(userID int, code string) error {
+	if err := svc.verifyTwoFactor(userID, code); err != nil {
+		return err
+	}
+	return svc.dao.DisableTwoFactor(userID)
+}
+
+// CompleteTwoFactorLogin метод Service завершения входа вторым фактором и выдачи токена авторизации.
+func (svc *service) CompleteTwoFactorLogin(challenge, code string) (*types.AuthResponse, error) {
+	userID, err := svc.dao.AttemptTwoFactorChallenge(challenge, svc.cfg.TwoFactorChallengeTTL, challengeMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if err = svc.verifyTwoFactor(userID, code); err != nil {
+		return nil, err
+	}
+	if err = svc.dao.DeleteTwoFactorChallenge(challenge); err != nil {
+		return nil, err
+	}
+	return svc.issueToken(userID)
+}
+
+// completeLogin метод Service завершения проверки первого фактора.
+// Пользователю с двухфакторной аутентификацией вместо токена выдается короткоживущий challenge.
+func (svc *service) completeLogin(userID int) (*types.AuthResponse, error) {
+	enabled, err := svc.dao.IsTwoFactorEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return svc.issueToken(userID)
+	}
+	challenge, err := svc.generateToken(48)
+	if err != nil {
+		return nil, err
+	}
+	if err = svc.dao.NewTwoFactorChallenge(challenge, userID, svc.cfg.TwoFactorChallengeTTL); err != nil {
+		return nil, err
+	}
+	return &types.AuthResponse{
+		TwoFactorRequired: true,
+		Challenge:         challenge,
+	}, nil
+}
+
+// verifyTwoFactor метод Service проверки одноразового либо резервного кода пользователя с включенной аутентификацией.
+// Резервный код используется однократно.
+func (svc *service) verifyTwoFactor(userID int, code string) error {
+	s, err := svc.dao.GetTOTPSecret(userID)
+	if err != nil {
+		return err
+	}
+	if !s.Enabled {
+		return types.ErrTwoFactorNotEnrolled
+	}
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) == totp.Digits {
+		return svc.checkTOTP(userID, s, code)
+	}
+	codes, err := svc.dao.GetRecoveryCodes(userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(c.Hash), []byte(code)) != nil {
+			continue
+		}
+		ok, err := svc.dao.UseRecoveryCode(c.ID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return types.ErrTwoFactorCodeInvalid
+}
+
+// checkTOTP метод Service проверки одноразового кода по секрету пользователя.
+// Код каждого шага принимается однократно.
+func (svc *service) checkTOTP(userID int, s *types.TOTPSecret, code string) error {
+	if svc.totp == nil {
+		return types.ErrTwoFactorDisabled
+	}
+	secret, err := svc.totp.Open(s.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok || step <= s.LastStep {
+		return types.ErrTwoFactorCodeInvalid
+	}
+	ok, err = svc.dao.UseTOTPStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return types.ErrTwoFactorCodeInvalid
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/secretbox"
+	"github.com/lipandr/yandex-practicum-diploma/internal/totp"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// TestCheckTOTPStepReuse проверяет, что код уже использованного шага и более ранних шагов отклоняется
+// до обращения к хранилищу.
+func TestCheckTOTPStepReuse(t *testing.T) {
+	box, err := secretbox.New(base64.StdEncoding.EncodeToString(make([]byte, secretbox.KeySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &service{totp: box}
+	step := totp.Step(time.Now())
+
+	tests := []struct {
+		name     string
+		lastStep int64
+		codeStep int64
+	}{
+		{"same step", step, step},
+		{"earlier step within skew", step, step - 1},
+		{"step older than the last used", step + 1, step},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := totp.Code(secret, tt.codeStep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &types.TOTPSecret{Secret: sealed, Enabled: true, LastStep: tt.lastStep}
+			if err = svc.checkTOTP(1, s, code); !errors.Is(err, types.ErrTwoFactorCodeInvalid) {
+				t.Errorf("checkTOTP() error = %v, want %v", err, types.ErrTwoFactorCodeInvalid)
+			}
+		})
+	}
+	if err = (&service{}).checkTOTP(1, &types.TOTPSecret{Secret: sealed}, "000000"); !errors.Is(err, types.ErrTwoFactorDisabled) {
+		t.Errorf("checkTOTP() without key error = %v, want %v", err, types.ErrTwoFactorDisabled)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+	"github.com/lipandr/yandex-practicum-diploma/internal/webhook"
+)
+
+const (
+	// webhookDeliveriesLimit количество последних доставок в журнале вебхука.
+	webhookDeliveriesLimit = 100
+	// webhookLookupTimeout таймаут разрешения имени хоста вебхука при регистрации.
+	webhookLookupTimeout = 5 * time.Second
+)
+
+// RegisterWebhook метод Service регистрации нового вебхука пользователя.
+// Адреса, указывающие на loopback, частные и link-local сети, отклоняются (см. webhook.CheckURL).
+func (svc *service) RegisterWebhook(userID int, req *types.WebhookRequest) (*types.Webhook, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, types.ErrWebhookURLInvalid
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookLookupTimeout)
+	defer cancel()
+	if err = webhook.CheckURL(ctx, u); err != nil {
+		return nil, err
+	}
+	events := req.Events
+	if len(events) == 0 {
+		events = types.WebhookEvents
+	}
+	for _, e := range events {
+		if !isWebhookEvent(e) {
+			return nil, types.ErrWebhookEventUnknown
+		}
+	}
+	secret, err := svc.generateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	wh := &types.Webhook{
+		UserID: userID,
+		URL:    u.String(),
+		Events: events,
+		Secret: secret,
+	}
+	if err = svc.dao.NewWebhook(wh); err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+// GetWebhooks метод Service получения списка вебхуков пользователя.
+func (svc *service) GetWebhooks(userID int) ([]types.Webhook, error) {
+	return svc.dao.GetWebhooks(userID)
+}
+
+// DeleteWebhook метод Service удаления вебхука пользователя.
+func (svc *service) DeleteWebhook(userID, webhookID int) error {
+	return svc.dao.DeleteWebhook(userID, webhookID)
+}
+
+// GetWebhookDeliveries метод Service получения журнала доставок вебхука пользователя.
+func (svc *service) GetWebhookDeliveries(userID, webhookID int) ([]types.WebhookDelivery, error) {
+	return svc.dao.GetWebhookDeliveries(userID, webhookID, webhookDeliveriesLimit)
+}
+
+// isWebhookEvent метод-helper проверки поддерживаемого события вебхука.
+func isWebhookEvent(event string) bool {
+	for _, e := range types.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
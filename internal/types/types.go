@@ -5,11 +5,103 @@ import (
 	"encoding/json"
 	"errors"
 	"reflect"
+	"time"
 )
 
 const (
-	WorkersPoolSize int         = 10
-	UserID          UserSession = "userID"
+	PrincipalKey UserSession = "principal"
+)
+
+// Роли пользователей.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+	RoleService = "service"
+)
+
+// Разрешения на выполнение операций API.
+const (
+	PermOrdersRead    = "orders:read"
+	PermOrdersWrite   = "orders:write"
+	PermBalanceRead   = "balance:read"
+	PermBalanceWrite  = "balance:write"
+	PermWebhooks      = "webhooks:manage"
+	PermSupportRead   = "support:read"
+	PermSupportOrders = "support:orders"
+	PermSupportUsers  = "support:users"
+	PermBalanceAdjust = "balance:adjust"
+	PermRolesManage   = "roles:manage"
+	PermAPIKeys       = "apikeys:manage"
+	PermIdentities    = "identities:manage"
+	PermTwoFactor     = "twofactor:manage"
+	PermOrdersReturn  = "orders:return"
+	PermTransfer      = "balance:transfer"
+)
+
+// APIKeyScopes разрешения, которые могут быть выданы API-ключу.
+// Возврат заказов доступен только ключам партнеров с ролью RoleService.
+// Перевод баллов PermTransfer в список не входит: переводить баллы может только сам пользователь.
+var APIKeyScopes = []string{PermOrdersRead, PermOrdersWrite, PermBalanceRead, PermBalanceWrite, PermOrdersReturn}
+
+var userPermissions = []string{
+	PermOrdersRead, PermOrdersWrite, PermBalanceRead, PermBalanceWrite, PermWebhooks, PermAPIKeys, PermIdentities,
+	PermTwoFactor, PermTransfer,
+}
+
+var supportPermissions = append(append([]string{}, userPermissions...),
+	PermSupportRead, PermSupportOrders, PermSupportUsers)
+
+// RolePermissions разрешения, предоставляемые ролями.
+var RolePermissions = map[string][]string{
+	RoleUser:    userPermissions,
+	RoleService: {PermOrdersRead, PermOrdersWrite, PermBalanceRead, PermOrdersReturn},
+	RoleSupport: supportPermissions,
+	RoleAdmin:   append(append([]string{}, supportPermissions...), PermBalanceAdjust, PermRolesManage, PermOrdersReturn),
+}
+
+// Доменные события, публикуемые во внешнюю шину через outbox.
+const (
+	EventUserRegistered      = "user.registered"
+	EventOrderUploaded       = "order.uploaded"
+	EventOrderStatusChanged  = "order.status_changed"
+	EventAccrualCredited     = "accrual.credited"
+	EventWithdrawalMade      = "withdrawal.created"
+	EventBalanceAdjusted     = "balance.adjusted"
+	EventWithdrawalCompleted = "withdrawal.completed"
+	EventWithdrawalCancelled = "withdrawal.cancelled"
+	EventWithdrawalReversed  = "withdrawal.reversed"
+	EventPointsExpired       = "points.expired"
+	EventOrderReturned       = "order.returned"
+	EventPointsTransferred   = "points.transferred"
+)
+
+// События, о которых оповещают вебхуки.
+const (
+	WebhookOrderProcessed  = "order.processed"
+	WebhookOrderInvalid    = "order.invalid"
+	WebhookWithdrawalMade  = "withdrawal.created"
+	WebhookDeliveryPending = "PENDING"
+	WebhookDeliverySent    = "DELIVERED"
+	WebhookDeliveryFailed  = "FAILED"
+)
+
+// WebhookEvents список поддерживаемых событий вебхуков.
+var WebhookEvents = []string{WebhookOrderProcessed, WebhookOrderInvalid, WebhookWithdrawalMade}
+
+// Статусы регистрации заказа в системе начислений.
+const (
+	AccrualRegistrationPending = "PENDING"
+	AccrualRegistrationDone    = "REGISTERED"
+	AccrualRegistrationFailed  = "FAILED"
+)
+
+// Результаты обработки заказа в пакетной загрузке.
+const (
+	BatchOrderAccepted          = "accepted"
+	BatchOrderUploadedByUser    = "already_uploaded"
+	BatchOrderUploadedByAnother = "uploaded_by_other_user"
+	BatchOrderInvalid           = "invalid"
 )
 
 var (
@@ -20,6 +112,50 @@ var (
 	ErrOrderAlreadyWithdrawn    = errors.New("order already withdrawn")
 	ErrInsufficientAccruals     = errors.New("insufficient accruals on the account")
 	ErrOrderNumberInvalid       = errors.New("invalid order number")
+	ErrOrderNotFound            = errors.New("order not found")
+	ErrOrdersBatchEmpty         = errors.New("orders batch is empty")
+	ErrOrdersBatchTooLarge      = errors.New("orders batch is too large")
+	ErrWebhookNotFound          = errors.New("webhook not found")
+	ErrWebhookURLInvalid        = errors.New("invalid webhook url")
+	ErrWebhookAddressForbidden  = errors.New("webhook address is not public")
+	ErrWebhookEventUnknown      = errors.New("unknown webhook event")
+	ErrSignatureInvalid         = errors.New("invalid request signature")
+	ErrSignatureExpired         = errors.New("request signature expired")
+	ErrAccrualStateInvalid      = errors.New("invalid accrual order state")
+	ErrGoodsInvalid             = errors.New("invalid order goods")
+	ErrUserBlocked              = errors.New("user is blocked")
+	ErrUserNotFound             = errors.New("user not found")
+	ErrForbidden                = errors.New("access denied")
+	ErrRoleUnknown              = errors.New("unknown role")
+	ErrAPIKeyInvalid            = errors.New("invalid api key")
+	ErrAPIKeyExpired            = errors.New("api key expired")
+	ErrAPIKeyNotFound           = errors.New("api key not found")
+	ErrAPIKeyScopeUnknown       = errors.New("unknown api key scope")
+	ErrAPIKeyExpiryInvalid      = errors.New("invalid api key expiry")
+	ErrTooManyRequests          = errors.New("too many requests")
+	ErrOIDCDisabled             = errors.New("external login is not configured")
+	ErrOIDCStateInvalid         = errors.New("invalid or expired login state")
+	ErrIdentityLinked           = errors.New("external identity is linked to another user")
+	ErrTwoFactorDisabled        = errors.New("two-factor authentication is not configured")
+	ErrTwoFactorEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled     = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorCodeInvalid     = errors.New("invalid two-factor code")
+	ErrChallengeInvalid         = errors.New("invalid or expired two-factor challenge")
+	ErrWithdrawalNotFound       = errors.New("withdrawal not found")
+	ErrWithdrawalNotCancellable = errors.New("withdrawal can no longer be cancelled")
+	ErrWithdrawalNotReversible  = errors.New("only completed withdrawals can be reversed")
+	ErrReversalInvalid          = errors.New("reversal reason is required")
+	ErrReturnInvalid            = errors.New("revised accrual must be less than the current one")
+	ErrOrderNotProcessed        = errors.New("order has no accrual to return")
+	ErrGoodsUnavailable         = errors.New("order goods are unknown")
+	ErrGoodsReturned            = errors.New("goods already returned")
+	ErrTransferInvalid          = errors.New("transfer sum must be positive and recipient must be another user")
+	ErrTransferLimitExceeded    = errors.New("daily transfer limit exceeded")
+	ErrIdempotencyKeyInvalid    = errors.New("invalid idempotency key")
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key was used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
+	ErrAdjustmentInvalid        = errors.New("adjustment amount and reason are required")
+	ErrOrderAlreadyProcessed    = errors.New("order already processed")
 )
 
 type UserSession string
@@ -30,13 +166,152 @@ type TUser struct {
 	EncryptedPassword string `db:"encrypted_password"`
 }
 
+// Principal аутентифицированный субъект запроса.
+// При аутентификации по API-ключу заполнены APIKeyID и Scopes.
+type Principal struct {
+	UserID   int
+	Login    string
+	Role     string
+	APIKeyID int
+	Scopes   []string
+}
+
+// Can метод проверки наличия у субъекта разрешения perm.
+// Разрешения API-ключа ограничены как ролью владельца, так и областями действия ключа.
+func (p *Principal) Can(perm string) bool {
+	if p.APIKeyID != 0 && !contains(p.Scopes, perm) {
+		return false
+	}
+	return contains(RolePermissions[p.Role], perm)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyRequest запрос выпуска API-ключа. ExpiresAt в формате RFC3339, пустое значение — бессрочный ключ.
+type APIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+}
+
+// APIKey API-ключ пользователя для интеграций. Ключ целиком возвращается только при выпуске.
+type APIKey struct {
+	ID         int      `json:"id"`
+	UserID     int      `json:"-"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	Key        string   `json:"key,omitempty"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// RoleRequest запрос назначения роли пользователю.
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// AdminUser сведения о пользователе для службы поддержки.
+type AdminUser struct {
+	ID      int    `json:"id"`
+	Login   string `json:"login"`
+	Role    string `json:"role"`
+	Blocked bool   `json:"blocked"`
+}
+
+// AdjustmentRequest запрос ручной корректировки баланса пользователя.
+type AdjustmentRequest struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// BalanceAdjustment ручная корректировка баланса пользователя с указанием причины и оператора.
+type BalanceAdjustment struct {
+	ID         int64   `json:"id"`
+	UserID     int     `json:"user_id"`
+	Amount     float64 `json:"amount"`
+	Reason     string  `json:"reason"`
+	OperatorID int     `json:"operator_id"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+// OIDCState параметры начатого входа через внешнего провайдера.
+// UserID заполнен, если вход выполняется для привязки внешней учетной записи к пользователю.
+type OIDCState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	UserID       int
+}
+
+// IdempotentResponse сохраненный ответ на запрос с ключом идемпотентности.
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// AuthURLResponse ответ с адресом авторизации у внешнего провайдера.
+type AuthURLResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
 type UserRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
 
+// AuthResponse ответ на вход пользователя.
+// Если у пользователя включена двухфакторная аутентификация, вместо токена возвращается Challenge,
+// который обменивается на токен вместе с одноразовым кодом.
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+}
+
+// TOTPSecret параметры двухфакторной аутентификации пользователя.
+// Secret хранится зашифрованным, LastStep - шаг последнего принятого кода.
+type TOTPSecret struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// RecoveryCode неиспользованный резервный код двухфакторной аутентификации.
+type RecoveryCode struct {
+	ID   int
+	Hash string
+}
+
+// TwoFactorEnrollment ответ на подключение двухфакторной аутентификации.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorCodeRequest запрос с одноразовым или резервным кодом.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest запрос завершения входа вторым фактором.
+type TwoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// RecoveryCodesResponse ответ с резервными кодами, которые показываются пользователю однократно.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type Order struct {
@@ -46,18 +321,157 @@ type Order struct {
 	Status      string       `json:"status" db:"status"`
 	Accrual     *NullFloat64 `json:"accrual,omitempty" db:"accrual"`
 	UploadedAt  string       `json:"uploaded_at" db:"uploaded_at"`
+	Return      *OrderReturn `json:"return,omitempty"`
 }
 
+// Виды возврата заказа.
+const (
+	OrderReturnFull    = "FULL"
+	OrderReturnPartial = "PARTIAL"
+)
+
+// OrderReturn сведения о возврате заказа: пересчитанное начисление и отозванные баллы.
+// WrittenOff - часть отзыва, не списанная с баланса, чтобы он не стал отрицательным.
+type OrderReturn struct {
+	Status     string  `json:"status"`
+	Accrual    float64 `json:"accrual"`
+	Clawback   float64 `json:"clawback"`
+	WrittenOff float64 `json:"written_off,omitempty"`
+	ReturnedAt string  `json:"returned_at"`
+}
+
+// ReturnRequest запрос возврата заказа. Новое начисление задается одним из способов:
+// Full - полный возврат, Accrual - пересчитанное начисление, Goods - возвращенные товары,
+// по доле стоимости которых в составе заказа начисление пересчитывается.
+type ReturnRequest struct {
+	Full    bool     `json:"full"`
+	Accrual *float64 `json:"accrual,omitempty"`
+	Goods   []Good   `json:"goods,omitempty"`
+	Reason  string   `json:"reason"`
+}
+
+// ReturnableOrder обработанный заказ с исходным и действующим начислением, составом, если он известен,
+// и товарами, возвращенными ранее.
+type ReturnableOrder struct {
+	UserID   int
+	Original float64
+	Accrual  float64
+	Goods    []Good
+	Returned []Good
+}
+
+// OrderInfo подробная информация о заказе с данными опроса системы начислений.
+type OrderInfo struct {
+	Order
+	PolledAt        string `json:"polled_at,omitempty"`
+	AccrualAttempts int    `json:"accrual_attempts"`
+}
+
+// BatchOrderResult результат обработки одного заказа из пакетной загрузки.
+type BatchOrderResult struct {
+	Number string `json:"number"`
+	Status int    `json:"status"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Статусы списаний. Списание можно отменить, пока оно в статусе WithdrawalPending.
+const (
+	WithdrawalPending   = "PENDING"
+	WithdrawalCompleted = "COMPLETED"
+	WithdrawalCancelled = "CANCELLED"
+	WithdrawalReversed  = "REVERSED"
+)
+
 type Withdraw struct {
-	ID          int     `json:"-" db:"id"`
-	OrderNumber string  `json:"order" db:"order_number"`
-	Sum         float64 `json:"sum" db:"sum"`
-	ProcessedAt string  `json:"processed_at" db:"processed_at"`
+	ID          int                 `json:"-" db:"id"`
+	OrderNumber string              `json:"order" db:"order_number"`
+	Sum         float64             `json:"sum" db:"sum"`
+	ProcessedAt string              `json:"processed_at" db:"processed_at"`
+	Status      string              `json:"status" db:"status"`
+	CancelledAt string              `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	Reversal    *WithdrawalReversal `json:"reversal,omitempty"`
+}
+
+// WithdrawalReversal сторнирование списания: баллы возвращаются корректировкой баланса AdjustmentID.
+type WithdrawalReversal struct {
+	AdjustmentID int64  `json:"adjustment_id"`
+	Reason       string `json:"reason"`
+	OperatorID   int    `json:"operator_id"`
+	ReversedAt   string `json:"reversed_at"`
+}
+
+// ReversalRequest запрос администратора на сторнирование списания.
+type ReversalRequest struct {
+	Reason string `json:"reason"`
 }
 
+// JSONBalance баланс пользователя. Current - доступные для списания баллы,
+// Pending - начисленные баллы, которые станут доступны по окончании периода удержания.
 type JSONBalance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current      float64          `json:"current"`
+	Pending      float64          `json:"pending"`
+	Withdrawn    float64          `json:"withdrawn"`
+	ExpiringSoon []ExpiringPoints `json:"expiring_soon,omitempty"`
+}
+
+// LotPolicy правила для партий начисленных баллов.
+type LotPolicy struct {
+	// ExpiryMonths срок сгорания баллов в месяцах с момента начисления, 0 - баллы не сгорают.
+	ExpiryMonths int
+	// HoldPeriod время, в течение которого начисленные баллы нельзя потратить.
+	HoldPeriod time.Duration
+}
+
+// ExpiringPoints баллы, сгорающие в указанный день.
+type ExpiringPoints struct {
+	Amount    float64 `json:"amount"`
+	ExpiresAt string  `json:"expires_at"`
+}
+
+// Виды записей истории баланса.
+const (
+	BalanceEntryAccrual     = "ACCRUAL"
+	BalanceEntryWithdrawal  = "WITHDRAWAL"
+	BalanceEntryAdjustment  = "ADJUSTMENT"
+	BalanceEntryExpiration  = "EXPIRATION"
+	BalanceEntryClawback    = "CLAWBACK"
+	BalanceEntryTransferIn  = "TRANSFER_IN"
+	BalanceEntryTransferOut = "TRANSFER_OUT"
+)
+
+// BalanceEntry запись истории баланса; списания и сгорания имеют отрицательную сумму.
+// Для переводов Counterparty - логин другого участника перевода.
+type BalanceEntry struct {
+	Type         string  `json:"type"`
+	Amount       float64 `json:"amount"`
+	Order        string  `json:"order,omitempty"`
+	Description  string  `json:"description,omitempty"`
+	Counterparty string  `json:"counterparty,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// TransferRequest запрос перевода баллов пользователю с логином Login.
+type TransferRequest struct {
+	Login   string  `json:"login"`
+	Sum     float64 `json:"sum"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// TransferLimits дневные ограничения переводов баллов одного пользователя; нулевое значение снимает ограничение.
+type TransferLimits struct {
+	Sum   float64
+	Count int
+}
+
+// Transfer перевод баллов между пользователями.
+type Transfer struct {
+	ID        int     `json:"id"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Sum       float64 `json:"sum"`
+	Comment   string  `json:"comment,omitempty"`
+	CreatedAt string  `json:"created_at"`
 }
 
 type JSONWithdrawRequest struct {
@@ -65,12 +479,90 @@ type JSONWithdrawRequest struct {
 	Sum   float64 `json:"sum"`
 }
 
+// Good товар в составе заказа.
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// OrderUpload запрос загрузки заказа в формате JSON с необязательным составом заказа.
+type OrderUpload struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods,omitempty"`
+}
+
+// AccrualRegistration запись outbox регистрации заказа в системе начислений.
+type AccrualRegistration struct {
+	ID          int64
+	OrderNumber string
+	Goods       []Good
+	Attempts    int
+}
+
 type AccrualOrderState struct {
 	Order   string  `json:"order"`
 	Status  string  `json:"status"`
 	Accrual float64 `json:"accrual"`
 }
 
+// OrderEvent событие изменения статуса или начисления по заказу пользователя.
+type OrderEvent struct {
+	ID          int64   `json:"id"`
+	UserID      int     `json:"-"`
+	OrderNumber string  `json:"number"`
+	Status      string  `json:"status"`
+	Accrual     float64 `json:"accrual,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// WebhookRequest запрос регистрации вебхука.
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// Webhook зарегистрированный пользователем вебхук. Секрет возвращается только при регистрации.
+type Webhook struct {
+	ID        int      `json:"id"`
+	UserID    int      `json:"-"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// WebhookPayload тело запроса, отправляемого на адрес вебхука.
+type WebhookPayload struct {
+	Event      string      `json:"event"`
+	OccurredAt string      `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// WebhookDelivery запись журнала доставки вебхука.
+type WebhookDelivery struct {
+	ID           int64  `json:"id"`
+	WebhookID    int    `json:"webhook_id"`
+	Event        string `json:"event"`
+	Payload      string `json:"-"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	ResponseCode int    `json:"response_code,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	DeliveredAt  string `json:"delivered_at,omitempty"`
+	URL          string `json:"-"`
+	Secret       string `json:"-"`
+}
+
+// DomainEvent доменное событие из outbox.
+type DomainEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    int             `json:"user_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt string          `json:"created_at"`
+}
+
 // NullFloat64 is an alias for sql.NullInt64 data type
 type NullFloat64 sql.NullFloat64
 
@@ -0,0 +1,29 @@
+package types
+
+import "testing"
+
+func TestPrincipalCan(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Principal
+		perm string
+		want bool
+	}{
+		{"user transfers points", Principal{UserID: 1, Role: RoleUser}, PermTransfer, true},
+		{"api key with all scopes cannot transfer",
+			Principal{UserID: 1, Role: RoleUser, APIKeyID: 7, Scopes: APIKeyScopes}, PermTransfer, false},
+		{"api key withdraws within scope",
+			Principal{UserID: 1, Role: RoleUser, APIKeyID: 7, Scopes: []string{PermBalanceWrite}}, PermBalanceWrite, true},
+		{"api key outside scope",
+			Principal{UserID: 1, Role: RoleUser, APIKeyID: 7, Scopes: []string{PermOrdersRead}}, PermBalanceWrite, false},
+		{"service role cannot transfer", Principal{UserID: 2, Role: RoleService}, PermTransfer, false},
+		{"user cannot return orders", Principal{UserID: 1, Role: RoleUser}, PermOrdersReturn, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.Can(tt.perm); got != tt.want {
+				t.Errorf("Can(%q) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// cgnat адреса разделяемого пространства провайдеров (RFC 6598), недоступные из интернета.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// NewClient метод-конструктор HTTP-клиента доставки вебхуков, который соединяется только с публичными адресами.
+// Адрес проверяется при каждом соединении, в том числе после перенаправления, поэтому DNS-имя,
+// которое после регистрации стало указывать на внутренний адрес, тоже будет отклонено.
+// Прокси из окружения не используются: через них проверка адреса потеряла бы смысл.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: publicOnly,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// CheckURL метод проверки адреса вебхука при регистрации: схема http или https и хост,
+// все адреса которого публичные. Для недопустимого адреса возвращает ErrWebhookURLInvalid.
+func CheckURL(ctx context.Context, u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return types.ErrWebhookURLInvalid
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return types.ErrWebhookURLInvalid
+	}
+	for _, a := range addrs {
+		if !IsPublicIP(a.IP) {
+			return types.ErrWebhookURLInvalid
+		}
+	}
+	return nil
+}
+
+// IsPublicIP метод проверки, что адрес доступен из интернета: не loopback, не частный,
+// не link-local (в том числе 169.254.169.254 облачных метаданных), не multicast и не неопределенный.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil && (ip4[0] == 0 || cgnat.Contains(ip4) || ip4.Equal(net.IPv4bcast)) {
+		return false
+	}
+	return true
+}
+
+// publicOnly метод-helper проверки адреса соединения перед его установкой.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", types.ErrWebhookAddressForbidden, host)
+	}
+	return nil
+}
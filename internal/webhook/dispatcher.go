@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/dao"
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// Заголовки запроса доставки вебхука.
+const (
+	SignatureHeader  = "X-Gophermart-Signature"
+	EventHeader      = "X-Gophermart-Event"
+	DeliveryIDHeader = "X-Gophermart-Delivery"
+)
+
+const (
+	batchSize    = 50
+	pollInterval = time.Second
+	maxBackoff   = time.Hour
+)
+
+// Dispatcher интерфейс фоновой доставки вебхуков из outbox.
+type Dispatcher interface {
+	Run()
+}
+
+// store хранилище доставок вебхуков; реализуется *dao.DAO.
+type store interface {
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]types.WebhookDelivery, error)
+	MarkWebhookDelivered(id int64, responseCode int) error
+	MarkWebhookFailed(id int64, responseCode int, lastErr string, retryAfter time.Duration) error
+}
+
+type dispatcher struct {
+	dao         store
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	lease       time.Duration
+}
+
+// NewDispatcher метод-конструктор доставки вебхуков. Клиент client создается NewClient,
+// чтобы вебхуки не доставлялись на внутренние адреса.
+func NewDispatcher(dao *dao.DAO, client *http.Client, maxAttempts int, backoff time.Duration) Dispatcher {
+	return &dispatcher{
+		dao:         dao,
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		// пачка доставок отправляется параллельно и укладывается в таймаут запроса
+		lease: 2*client.Timeout + time.Minute,
+	}
+}
+
+// Run метод запуска фоновой доставки вебхуков.
+func (d *dispatcher) Run() {
+	go func() {
+		for {
+			n, err := d.dispatch()
+			if err != nil {
+				log.Println("webhook dispatcher:", err)
+			}
+			if err != nil || n == 0 {
+				time.Sleep(pollInterval)
+			}
+		}
+	}()
+}
+
+// dispatch метод доставки пачки вебхуков, срок которых наступил. Доставки пачки отправляются
+// параллельно, чтобы медленные адреса не задерживали остальные дольше срока аренды.
+func (d *dispatcher) dispatch() (int, error) {
+	deliveries, err := d.dao.ClaimWebhookDeliveries(batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(wd *types.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(wd)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// deliver метод отправки одной доставки вебхука и фиксации результата.
+func (d *dispatcher) deliver(wd *types.WebhookDelivery) {
+	code, err := d.send(wd)
+	if err == nil {
+		if err = d.dao.MarkWebhookDelivered(wd.ID, code); err != nil {
+			log.Println("webhook dispatcher:", err)
+		}
+		return
+	}
+	var retryAfter time.Duration
+	if wd.Attempts+1 < d.maxAttempts {
+		retryAfter = Backoff(d.backoff, wd.Attempts)
+	}
+	if err = d.dao.MarkWebhookFailed(wd.ID, code, err.Error(), retryAfter); err != nil {
+		log.Println("webhook dispatcher:", err)
+	}
+}
+
+// send метод отправки подписанного запроса на адрес вебхука.
+func (d *dispatcher) send(wd *types.WebhookDelivery) (int, error) {
+	body := []byte(wd.Payload)
+	req, err := http.NewRequest(http.MethodPost, wd.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, wd.Event)
+	req.Header.Set(DeliveryIDHeader, strconv.FormatInt(wd.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(wd.Secret, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Sign метод вычисления подписи HMAC-SHA256 тела запроса в формате "sha256=<hex>".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify метод проверки подписи тела запроса, полученной в заголовке SignatureHeader.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Backoff метод расчета экспоненциальной задержки перед повторной попыткой.
+func Backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
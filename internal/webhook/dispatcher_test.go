@@ -0,0 +1,341 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// deliveryResult запись журнала доставок в memStore.
+type deliveryResult struct {
+	id         int64
+	delivered  bool
+	code       int
+	lastErr    string
+	retryAfter time.Duration
+}
+
+// memStore хранилище доставок в памяти. Ожидающие доставки pending выдаются так же, как
+// ClaimWebhookDeliveries: по наступлении срока, который при выдаче сдвигается на время аренды.
+type memStore struct {
+	mu      sync.Mutex
+	log     []deliveryResult
+	pending []types.WebhookDelivery
+	due     map[int64]time.Time
+	claims  map[int64]int
+}
+
+func (s *memStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]types.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.due == nil {
+		s.due = make(map[int64]time.Time)
+		s.claims = make(map[int64]int)
+	}
+	var res []types.WebhookDelivery
+	now := time.Now()
+	for _, wd := range s.pending {
+		if len(res) == limit {
+			break
+		}
+		if now.Before(s.due[wd.ID]) {
+			continue
+		}
+		s.due[wd.ID] = now.Add(lease)
+		s.claims[wd.ID]++
+		res = append(res, wd)
+	}
+	return res, nil
+}
+
+func (s *memStore) MarkWebhookDelivered(id int64, responseCode int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, deliveryResult{id: id, delivered: true, code: responseCode})
+	s.remove(id)
+	return nil
+}
+
+func (s *memStore) MarkWebhookFailed(id int64, responseCode int, lastErr string, retryAfter time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, deliveryResult{id: id, code: responseCode, lastErr: lastErr, retryAfter: retryAfter})
+	if retryAfter == 0 {
+		s.remove(id)
+	} else if s.due != nil {
+		s.due[id] = time.Now().Add(retryAfter)
+	}
+	return nil
+}
+
+func (s *memStore) remove(id int64) {
+	for i, wd := range s.pending {
+		if wd.ID == id {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *memStore) last(t *testing.T) deliveryResult {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.log) == 0 {
+		t.Fatal("delivery log is empty")
+	}
+	return s.log[len(s.log)-1]
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	const secret = "webhook-secret"
+	payload := `{"number":"79927398713","status":"PROCESSED","accrual":500}`
+
+	var mu sync.Mutex
+	failures := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, body, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(EventHeader) != types.WebhookOrderProcessed || r.Header.Get(DeliveryIDHeader) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	st := &memStore{}
+	d := &dispatcher{dao: st, client: ts.Client(), maxAttempts: 3, backoff: time.Second}
+	delivery := func(id int64, attempts int, secret string) *types.WebhookDelivery {
+		return &types.WebhookDelivery{
+			ID:       id,
+			Event:    types.WebhookOrderProcessed,
+			Payload:  payload,
+			Attempts: attempts,
+			URL:      ts.URL,
+			Secret:   secret,
+		}
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		d.deliver(delivery(1, 0, secret))
+		if got := st.last(t); !got.delivered || got.code != http.StatusNoContent || got.id != 1 {
+			t.Errorf("log = %+v, want delivery 1 with %d", got, http.StatusNoContent)
+		}
+	})
+	t.Run("wrong signature", func(t *testing.T) {
+		d.deliver(delivery(2, 0, "other"))
+		if got := st.last(t); got.delivered || got.code != http.StatusUnauthorized {
+			t.Errorf("log = %+v, want failure with %d", got, http.StatusUnauthorized)
+		}
+	})
+	t.Run("retry with backoff", func(t *testing.T) {
+		mu.Lock()
+		failures = 3
+		mu.Unlock()
+		for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 0} {
+			d.deliver(delivery(3, attempt, secret))
+			got := st.last(t)
+			if got.delivered || got.code != http.StatusServiceUnavailable || got.retryAfter != want {
+				t.Errorf("attempt %d: log = %+v, want failure retried after %v", attempt, got, want)
+			}
+		}
+	})
+}
+
+func TestDispatcherLease(t *testing.T) {
+	const (
+		deliveries = 10
+		delay      = 100 * time.Millisecond
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	st := &memStore{}
+	for i := 1; i <= deliveries; i++ {
+		st.pending = append(st.pending, types.WebhookDelivery{
+			ID: int64(i), Event: types.WebhookOrderProcessed, Payload: "{}", URL: ts.URL, Secret: "secret",
+		})
+	}
+	client := ts.Client()
+	client.Timeout = 2 * delay
+	// аренда меньше суммарного времени последовательной доставки пачки
+	d := &dispatcher{dao: st, client: client, maxAttempts: 3, backoff: time.Second, lease: 2 * client.Timeout}
+
+	// другая реплика забирает доставки, срок аренды которых истек
+	stop := make(chan struct{})
+	replica := make(chan []types.WebhookDelivery)
+	go func() {
+		var claimed []types.WebhookDelivery
+		defer func() { replica <- claimed }()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			wds, _ := st.ClaimWebhookDeliveries(batchSize, time.Hour)
+			claimed = append(claimed, wds...)
+		}
+	}()
+
+	n, err := d.dispatch()
+	close(stop)
+	if claimed := <-replica; len(claimed) > 0 {
+		t.Errorf("replica claimed %d deliveries still being delivered", len(claimed))
+	}
+	if err != nil || n != deliveries {
+		t.Fatalf("dispatch() = %d, %v, want %d", n, err, deliveries)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.pending) != 0 {
+		t.Errorf("%d deliveries left pending", len(st.pending))
+	}
+	for id, n := range st.claims {
+		if n != 1 {
+			t.Errorf("delivery %d claimed %d times, want once", id, n)
+		}
+	}
+}
+
+func TestDispatcherRefusesPrivateAddress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback receiver")
+	}))
+	defer ts.Close()
+
+	st := &memStore{}
+	d := &dispatcher{dao: st, client: NewClient(time.Second), maxAttempts: 1, backoff: time.Second}
+	d.deliver(&types.WebhookDelivery{ID: 1, Event: types.WebhookOrderProcessed, Payload: "{}", URL: ts.URL})
+	if got := st.last(t); got.delivered || got.lastErr == "" {
+		t.Errorf("log = %+v, want refused delivery", got)
+	}
+	_, err := NewClient(time.Second).Get(ts.URL)
+	if !errors.Is(err, types.ErrWebhookAddressForbidden) {
+		t.Errorf("Get(%s) error = %v, want %v", ts.URL, err, types.ErrWebhookAddressForbidden)
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		want   string
+	}{
+		// RFC 4231, test case 2.
+		{"rfc 4231", "Jefe", "what do ya want for nothing?",
+			"sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"empty body", "key", "",
+			"sha256=5d5d139563c95b5967b9bd9a8c9b233a9dedb45072794cd232dc1b74832607d0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "secret"
+	body := []byte(`{"event":"order.processed","order":"79927398713"}`)
+	valid := Sign(secret, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", secret, body, valid, true},
+		{"wrong secret", "other", body, valid, false},
+		{"tampered body", secret, []byte(`{"event":"order.processed","order":"12345678903"}`), valid, false},
+		{"without scheme", secret, body, valid[len("sha256="):], false},
+		{"upper case hex", secret, body, "sha256=" + strings.ToUpper(valid[len("sha256="):]), false},
+		{"empty", secret, body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.body, tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			if got := Backoff(30*time.Second, tt.attempt); got != tt.want {
+				t.Errorf("Backoff(30s, %d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+// SignTimestamped метод вычисления подписи HMAC-SHA256 тела запроса вместе с меткой времени t
+// в формате "t=<unix>,sha256=<hex>". Подписывается строка "<unix>.<тело>".
+func SignTimestamped(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + "," + Sign(secret, append([]byte(ts+"."), body...))
+}
+
+// VerifyTimestamped метод проверки подписи с меткой времени, полученной в формате SignTimestamped.
+// Подпись с меткой, отличающейся от now больше чем на tolerance, отклоняется с ErrSignatureExpired,
+// чтобы перехваченный запрос нельзя было повторить позже.
+func VerifyTimestamped(secret string, body []byte, signature string, tolerance time.Duration, now time.Time) error {
+	parts := strings.SplitN(signature, ",", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "t=") {
+		return types.ErrSignatureInvalid
+	}
+	ts := strings.TrimPrefix(parts[0], "t=")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return types.ErrSignatureInvalid
+	}
+	if !Verify(secret, append([]byte(ts+"."), body...), parts[1]) {
+		return types.ErrSignatureInvalid
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return types.ErrSignatureExpired
+	}
+	return nil
+}
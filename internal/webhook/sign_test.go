@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lipandr/yandex-practicum-diploma/internal/types"
+)
+
+func TestVerifyTimestamped(t *testing.T) {
+	const secret = "secret"
+	body := []byte(`{"order":"79927398713","status":"PROCESSED","accrual":500}`)
+	now := time.Unix(1700000000, 0)
+	valid := SignTimestamped(secret, body, now)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		now       time.Time
+		want      error
+	}{
+		{"valid", secret, body, valid, now, nil},
+		{"within tolerance", secret, body, valid, now.Add(4 * time.Minute), nil},
+		{"replayed later", secret, body, valid, now.Add(6 * time.Minute), types.ErrSignatureExpired},
+		{"from the future", secret, body, valid, now.Add(-6 * time.Minute), types.ErrSignatureExpired},
+		{"wrong secret", "other", body, valid, now, types.ErrSignatureInvalid},
+		{"tampered body", secret, []byte(`{"order":"79927398713","status":"PROCESSED","accrual":0}`),
+			valid, now, types.ErrSignatureInvalid},
+		{"tampered timestamp", secret, body, "t=1700000300" + valid[len("t=1700000000"):],
+			now.Add(5 * time.Minute), types.ErrSignatureInvalid},
+		{"without timestamp", secret, body, Sign(secret, body), now, types.ErrSignatureInvalid},
+		{"empty", secret, body, "", now, types.ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyTimestamped(tt.secret, tt.body, tt.signature, 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("VerifyTimestamped() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}